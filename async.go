@@ -13,12 +13,35 @@ type asyncJob struct {
 	fn   func(context.Context) error
 }
 
+var asyncHeldDroppedTotal = newCounter("recorder_async_held_dropped_total", "Jobs dropped because a paused sink's backlog was full.")
+
 type asyncDispatcher struct {
 	ch              chan asyncJob
 	workerCount     int
 	dropOnQueueFull bool
 	baseCtx         context.Context
 	startOnce       sync.Once
+
+	// pauseBacklog caps the jobs held per paused sink (0 = unlimited); the oldest are dropped.
+	pauseBacklog int
+
+	mu     sync.Mutex
+	quits  []chan struct{}        // one per running worker
+	paused map[string]*pausedJobs // jobs held by paused job name
+}
+
+// pausedJobs are the jobs held for a paused job name, and how many were dropped from the
+// front of its backlog.
+type pausedJobs struct {
+	jobs    []asyncJob
+	dropped int
+
+	// draining is set from resume until the backlog has been requeued; new jobs are still
+	// held behind it meanwhile. stop is closed when the name is paused again mid-drain, and
+	// drainer is set while a drain goroutine runs.
+	draining bool
+	stop     chan struct{}
+	drainer  bool
 }
 
 func newAsyncDispatcher(baseCtx context.Context, queueSize, workerCount int, dropOnQueueFull bool) *asyncDispatcher {
@@ -31,37 +54,218 @@ func newAsyncDispatcher(baseCtx context.Context, queueSize, workerCount int, dro
 	if baseCtx == nil {
 		baseCtx = context.Background()
 	}
-	return &asyncDispatcher{ch: make(chan asyncJob, queueSize), workerCount: workerCount, dropOnQueueFull: dropOnQueueFull, baseCtx: baseCtx}
+	return &asyncDispatcher{ch: make(chan asyncJob, queueSize), workerCount: workerCount, dropOnQueueFull: dropOnQueueFull, baseCtx: baseCtx, pauseBacklog: 10000}
 }
 
 func (d *asyncDispatcher) start() {
 	d.startOnce.Do(func() {
-		for i := 0; i < d.workerCount; i++ {
-			go func() {
-				for job := range d.ch {
-					log.Infof(d.baseCtx, "[ASYNC] Starting job: %s", job.name)
-					start := time.Now()
-					ctx, cancel := context.WithTimeout(d.baseCtx, 15*time.Second)
-					err := job.fn(ctx)
-					cancel()
-					duration := time.Since(start)
-					if err != nil {
-						log.Warnf(d.baseCtx, "[ASYNC] Job %s failed after %v: %v", job.name, duration, err)
-					} else {
-						log.Infof(d.baseCtx, "[ASYNC] Job %s completed successfully in %v", job.name, duration)
-					}
-				}
-			}()
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		for len(d.quits) < d.workerCount {
+			d.spawnWorker()
 		}
 	})
 }
 
+// spawnWorker starts a worker; d.mu must be held.
+func (d *asyncDispatcher) spawnWorker() {
+	quit := make(chan struct{})
+	d.quits = append(d.quits, quit)
+	go func() {
+		for {
+			select {
+			case <-quit:
+				return
+			case job := <-d.ch:
+				d.run(job)
+			}
+		}
+	}()
+}
+
+func (d *asyncDispatcher) run(job asyncJob) {
+	log.Infof(d.baseCtx, "[ASYNC] Starting job: %s", job.name)
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(d.baseCtx, 15*time.Second)
+	err := job.fn(ctx)
+	cancel()
+	duration := time.Since(start)
+	if err != nil {
+		log.Warnf(d.baseCtx, "[ASYNC] Job %s failed after %v: %v", job.name, duration, err)
+	} else {
+		log.Infof(d.baseCtx, "[ASYNC] Job %s completed successfully in %v", job.name, duration)
+	}
+}
+
+// setWorkers grows or shrinks the worker pool to n (at least 1). Stopped workers finish their
+// current job first.
+func (d *asyncDispatcher) setWorkers(n int) {
+	d.start()
+	n = max(n, 1)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for len(d.quits) < n {
+		d.spawnWorker()
+	}
+	for len(d.quits) > n {
+		close(d.quits[len(d.quits)-1])
+		d.quits = d.quits[:len(d.quits)-1]
+	}
+	d.workerCount = n
+}
+
+func (d *asyncDispatcher) workers() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.workerCount
+}
+
+// pause holds new jobs named name until resume. It returns false if already paused. Pausing a
+// sink whose backlog is still being requeued stops the requeue and keeps the rest held.
+func (d *asyncDispatcher) pause(name string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if p, ok := d.paused[name]; ok {
+		if !p.draining {
+			return false
+		}
+		p.draining = false
+		close(p.stop)
+		return true
+	}
+	if d.paused == nil {
+		d.paused = map[string]*pausedJobs{}
+	}
+	d.paused[name] = &pausedJobs{}
+	return true
+}
+
+// resume starts requeueing the jobs held for name, in order, in the background, and returns
+// how many jobs it is requeueing and how many were dropped from the backlog while paused. New
+// jobs for name stay held behind the backlog until it has been requeued. The requeue waits for
+// queue room rather than dropping jobs whatever dropOnQueueFull says; only a shutdown or
+// another pause stops it early. ok is false if name was not paused.
+func (d *asyncDispatcher) resume(name string) (requeued, dropped int, ok bool) {
+	d.start()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	p, ok := d.paused[name]
+	if !ok || p.draining {
+		return 0, 0, false
+	}
+	requeued, dropped = len(p.jobs), p.dropped
+	p.dropped = 0
+	if d.baseCtx.Err() != nil {
+		delete(d.paused, name)
+		asyncHeldDroppedTotal.Add(int64(requeued))
+		log.Warnf(d.baseCtx, "[ASYNC] Shutting down; dropping %d held jobs for %s", requeued, name)
+		return 0, dropped + requeued, true
+	}
+	p.draining = true
+	p.stop = make(chan struct{})
+	if !p.drainer {
+		p.drainer = true
+		go d.drain(name, p)
+	}
+	return requeued, dropped, true
+}
+
+// drain requeues p's held jobs, including any held since resume, and then unpauses name. A
+// job taken off the backlog when name is paused again goes back to its front.
+func (d *asyncDispatcher) drain(name string, p *pausedJobs) {
+	requeued := 0
+	for {
+		d.mu.Lock()
+		if !p.draining {
+			p.drainer = false
+			d.mu.Unlock()
+			log.Infof(d.baseCtx, "[ASYNC] Sink %s paused again; %d held jobs requeued, %d still held", name, requeued, len(p.jobs))
+			return
+		}
+		if len(p.jobs) == 0 {
+			delete(d.paused, name)
+			d.mu.Unlock()
+			log.Infof(d.baseCtx, "[ASYNC] Sink %s resumed; %d held jobs requeued", name, requeued)
+			return
+		}
+		job, stop := p.jobs[0], p.stop
+		p.jobs = p.jobs[1:]
+		d.mu.Unlock()
+
+		select {
+		case d.ch <- job:
+			requeued++
+		case <-stop:
+			d.mu.Lock()
+			p.jobs = append([]asyncJob{job}, p.jobs...)
+			d.mu.Unlock()
+		case <-d.baseCtx.Done():
+			d.mu.Lock()
+			lost := len(p.jobs) + 1
+			p.jobs = nil
+			if d.paused[name] == p {
+				delete(d.paused, name)
+			}
+			d.mu.Unlock()
+			asyncHeldDroppedTotal.Add(int64(lost))
+			log.Warnf(d.baseCtx, "[ASYNC] Shutting down; dropping %d held jobs for %s", lost, name)
+			return
+		}
+	}
+}
+
+// held returns, for each paused job name, how many jobs it is holding.
+func (d *asyncDispatcher) held() map[string]int {
+	return d.heldWhere(false)
+}
+
+// requeuing returns, for each resumed job name whose backlog is still being requeued, how many
+// jobs are left in it.
+func (d *asyncDispatcher) requeuing() map[string]int {
+	return d.heldWhere(true)
+}
+
+func (d *asyncDispatcher) heldWhere(draining bool) map[string]int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	res := make(map[string]int, len(d.paused))
+	for name, p := range d.paused {
+		if p.draining == draining {
+			res[name] = len(p.jobs)
+		}
+	}
+	return res
+}
+
+// hold keeps job if its sink is paused, or resumed with its backlog not yet requeued, and
+// reports whether it did.
+func (d *asyncDispatcher) hold(ctx context.Context, job asyncJob) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	p, ok := d.paused[job.name]
+	if !ok {
+		return false
+	}
+	if d.pauseBacklog > 0 && len(p.jobs) >= d.pauseBacklog {
+		p.jobs = p.jobs[1:]
+		p.dropped++
+		asyncHeldDroppedTotal.Inc()
+		log.Warnf(ctx, "[ASYNC] Sink %s paused with a full backlog (%d); dropping its oldest job", job.name, d.pauseBacklog)
+	}
+	p.jobs = append(p.jobs, job)
+	log.Infof(ctx, "[ASYNC] Sink %s paused or requeuing; holding job (%d held)", job.name, len(p.jobs))
+	return true
+}
+
 func (d *asyncDispatcher) enqueue(ctx context.Context, name string, fn func(context.Context) error) {
 	if d == nil {
 		return
 	}
 	d.start()
 	job := asyncJob{name: name, fn: fn}
+	if d.hold(ctx, job) {
+		return
+	}
 	select {
 	case d.ch <- job:
 		log.Infof(ctx, "[ASYNC] Job %s enqueued (queue depth: %d/%d)", name, len(d.ch), cap(d.ch))
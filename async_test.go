@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -268,3 +269,165 @@ func TestAsyncDispatcherContextTimeout(t *testing.T) {
 	// This test validates that context is passed to the job function
 	// The actual timeout test would take 15+ seconds
 }
+
+func TestAsyncDispatcherPauseHoldsJobsUpToBacklog(t *testing.T) {
+	d := newAsyncDispatcher(context.Background(), 10, 1, false)
+	d.pauseBacklog = 2
+	if !d.pause("db-save") || d.pause("db-save") {
+		t.Fatal("pause() should succeed once")
+	}
+
+	var mu sync.Mutex
+	var ran []int
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		d.enqueue(context.Background(), "db-save", func(context.Context) error {
+			defer wg.Done()
+			mu.Lock()
+			ran = append(ran, i)
+			mu.Unlock()
+			return nil
+		})
+	}
+	if n := d.held()["db-save"]; n != 2 {
+		t.Fatalf("held = %d, want 2 (oldest dropped)", n)
+	}
+	wg.Done() // the dropped job never runs
+
+	if requeued, dropped, ok := d.resume("db-save"); !ok || requeued != 2 || dropped != 1 {
+		t.Fatalf("resume() = %d, %d, %v; want 2, 1, true", requeued, dropped, ok)
+	}
+	wg.Wait()
+	if len(ran) != 2 || ran[0] != 1 || ran[1] != 2 {
+		t.Errorf("ran = %v, want [1 2]", ran)
+	}
+}
+
+func TestAsyncDispatcherResumeWaitsForQueueRoom(t *testing.T) {
+	// A backlog far larger than the queue is requeued in full even with drop-on-full set.
+	d := newAsyncDispatcher(context.Background(), 1, 1, true)
+	d.pauseBacklog = 0
+	d.pause("db-save")
+	var ran atomic.Int32
+	for i := 0; i < 50; i++ {
+		d.enqueue(context.Background(), "db-save", func(context.Context) error {
+			ran.Add(1)
+			return nil
+		})
+	}
+	if requeued, dropped, _ := d.resume("db-save"); requeued != 50 || dropped != 0 {
+		t.Fatalf("resume() = %d requeued, %d dropped; want 50, 0", requeued, dropped)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for ran.Load() < 50 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := ran.Load(); n != 50 {
+		t.Errorf("ran = %d, want 50", n)
+	}
+
+	// At shutdown the rest of the backlog is reported as dropped.
+	ctx, cancel := context.WithCancel(context.Background())
+	d = newAsyncDispatcher(ctx, 1, 1, true)
+	block := make(chan struct{})
+	defer close(block)
+	d.pause("db-save")
+	for i := 0; i < 5; i++ {
+		d.enqueue(ctx, "db-save", func(context.Context) error { <-block; return nil })
+	}
+	cancel()
+	if requeued, dropped, _ := d.resume("db-save"); requeued+dropped != 5 || dropped < 3 {
+		t.Errorf("resume() after shutdown = %d requeued, %d dropped; want most dropped", requeued, dropped)
+	}
+}
+
+func TestAsyncDispatcherResumeKeepsOrderAndStopsOnPause(t *testing.T) {
+	d := newAsyncDispatcher(context.Background(), 1, 1, false)
+	gate := make(chan struct{})
+	d.enqueue(context.Background(), "other", func(context.Context) error { <-gate; return nil })
+
+	var mu sync.Mutex
+	var ran []int
+	done := make(chan struct{}, 6)
+	job := func(i int) func(context.Context) error {
+		return func(context.Context) error {
+			mu.Lock()
+			ran = append(ran, i)
+			mu.Unlock()
+			done <- struct{}{}
+			return nil
+		}
+	}
+	d.pause("db-save")
+	for i := 0; i < 5; i++ {
+		d.enqueue(context.Background(), "db-save", job(i))
+	}
+	if requeued, dropped, ok := d.resume("db-save"); !ok || requeued != 5 || dropped != 0 {
+		t.Fatalf("resume() = %d, %d, %v; want 5, 0, true", requeued, dropped, ok)
+	}
+	// The worker is blocked, so the drain fills the one queue slot and waits to send job 1.
+	deadline := time.Now().Add(2 * time.Second)
+	for d.requeuing()["db-save"] != 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := d.requeuing()["db-save"]; n != 3 {
+		t.Fatalf("requeuing = %d, want 3", n)
+	}
+
+	// A new job waits behind the backlog, and pausing again keeps the rest of it held.
+	d.enqueue(context.Background(), "db-save", job(5))
+	if !d.pause("db-save") {
+		t.Fatal("pause() during requeue = false, want true")
+	}
+	deadline = time.Now().Add(2 * time.Second)
+	for d.held()["db-save"] != 5 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := d.held()["db-save"]; n != 5 {
+		t.Fatalf("held after pausing again = %d, want 5", n)
+	}
+
+	close(gate)
+	<-done
+	if _, _, ok := d.resume("db-save"); !ok {
+		t.Fatal("resume() = false, want true")
+	}
+	for i := 0; i < 5; i++ {
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("only %d jobs ran", len(ran))
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for i, n := range ran {
+		if n != i {
+			t.Fatalf("ran = %v, want jobs in order 0..5", ran)
+		}
+	}
+}
+
+func TestAsyncDispatcherSetWorkers(t *testing.T) {
+	d := newAsyncDispatcher(context.Background(), 10, 2, false)
+	d.setWorkers(5)
+	if d.workers() != 5 || len(d.quits) != 5 {
+		t.Fatalf("workers = %d (%d running), want 5", d.workers(), len(d.quits))
+	}
+	d.setWorkers(0)
+	if d.workers() != 1 || len(d.quits) != 1 {
+		t.Fatalf("workers = %d (%d running), want 1", d.workers(), len(d.quits))
+	}
+
+	done := make(chan struct{})
+	d.enqueue(context.Background(), "job", func(context.Context) error {
+		close(done)
+		return nil
+	})
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("job did not run after shrinking the pool")
+	}
+}
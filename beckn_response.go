@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+)
+
+// Beckn ACK statuses as found in responseBody.message.ack.status.
+const (
+	ackStatusACK  = "ACK"
+	ackStatusNACK = "NACK"
+)
+
+// extractAck reads message.ack.status and the error object (code, type, message, path) from a
+// Beckn response. Both are empty/nil when the response does not carry them.
+func extractAck(responseBody map[string]any) (string, map[string]any) {
+	var status string
+	if msg, _ := responseBody["message"].(map[string]any); msg != nil {
+		if ack, _ := msg["ack"].(map[string]any); ack != nil {
+			status = strings.ToUpper(strings.TrimSpace(getString(ack, "status")))
+		}
+	}
+
+	var becknErr map[string]any
+	if errObj, _ := responseBody["error"].(map[string]any); errObj != nil {
+		becknErr = map[string]any{}
+		for _, k := range []string{"code", "type", "message", "path"} {
+			if v, ok := errObj[k]; ok && v != nil {
+				becknErr[k] = v
+			}
+		}
+		if len(becknErr) == 0 {
+			becknErr = nil
+		}
+	}
+	return status, becknErr
+}
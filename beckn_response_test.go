@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestExtractAck(t *testing.T) {
+	tests := []struct {
+		name       string
+		response   map[string]any
+		wantStatus string
+		wantErr    map[string]any
+	}{
+		{"ack", map[string]any{"message": map[string]any{"ack": map[string]any{"status": "ACK"}}}, "ACK", nil},
+		{"lowercase nack with error", map[string]any{
+			"message": map[string]any{"ack": map[string]any{"status": "nack"}},
+			"error":   map[string]any{"code": "30016", "type": "DOMAIN-ERROR", "message": "Invalid signature", "path": "context", "extra": "dropped"},
+		}, "NACK", map[string]any{"code": "30016", "type": "DOMAIN-ERROR", "message": "Invalid signature", "path": "context"}},
+		{"empty error object", map[string]any{"error": map[string]any{"other": 1}}, "", nil},
+		{"no ack", map[string]any{"ok": true}, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, becknErr := extractAck(tt.response)
+			if status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", status, tt.wantStatus)
+			}
+			if !reflect.DeepEqual(becknErr, tt.wantErr) {
+				t.Errorf("error = %#v, want %#v", becknErr, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUpdateTransactionAtomicallyAckCounters(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	key := createTransactionKey("t1", "https://s")
+	mr.Set(key, `{"apiList":[]}`)
+
+	events := []cacheAppendInput{
+		{PayloadID: "p1", Action: "search", AckStatus: ackStatusACK},
+		{PayloadID: "p2", Action: "on_search", AckStatus: ackStatusNACK, ResponseError: map[string]any{"code": "30016"}},
+		{PayloadID: "p3", Action: "select", AckStatus: ackStatusACK},
+	}
+	for i := range events {
+		if err := updateTransactionAtomically(ctx, rdb, key, &events[i], 0); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+	}
+
+	txn, _ := loadTransactionMap(ctx, rdb, key)
+	if txn["ackCount"] != float64(2) || txn["nackCount"] != float64(1) {
+		t.Errorf("ackCount/nackCount = %v/%v, want 2/1", txn["ackCount"], txn["nackCount"])
+	}
+	nacked := txn["apiList"].([]any)[1].(map[string]any)
+	if nacked["ackStatus"] != "NACK" {
+		t.Errorf("ackStatus = %v, want NACK", nacked["ackStatus"])
+	}
+	if errObj, _ := nacked["responseError"].(map[string]any); errObj["code"] != "30016" {
+		t.Errorf("responseError = %#v", nacked["responseError"])
+	}
+}
+
+func TestSendLogsToNOIncludesAck(t *testing.T) {
+	var mu sync.Mutex
+	var logs []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		logs = append(logs, body)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	cfg := config{Env: "test", NOURL: srv.URL, NOTimeout: 2 * time.Second}
+	d := derivedFields{TransactionID: "t1", SubscriberURL: "https://s", Action: "on_search", AckStatus: ackStatusNACK, ResponseError: map[string]any{"code": "30016"}}
+	if err := sendLogsToNO(context.Background(), cfg, srv.Client(), d, map[string]any{}, map[string]any{}); err != nil {
+		t.Fatalf("sendLogsToNO() error = %v", err)
+	}
+
+	if len(logs) != 2 {
+		t.Fatalf("got %d logs, want request and response", len(logs))
+	}
+	if _, ok := logs[0]["ackStatus"]; ok {
+		t.Errorf("request log should not carry ackStatus: %#v", logs[0])
+	}
+	if logs[1]["ackStatus"] != "NACK" || logs[1]["responseError"] == nil {
+		t.Errorf("response log = %#v", logs[1])
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
@@ -13,8 +14,9 @@ import (
 )
 
 var (
-	errNotFound = errors.New("transaction not found")
-	errAborted  = errors.New("aborted")
+	errNotFound  = errors.New("transaction not found")
+	errAborted   = errors.New("aborted")
+	errDuplicate = errors.New("duplicate event")
 )
 
 func createTransactionKey(transactionID, subscriberURL string) string {
@@ -36,6 +38,44 @@ type cacheAppendInput struct {
 	Timestamp     string
 	TTLSecs       int64
 	Response      any
+
+	// Dedupe makes the append a no-op (errDuplicate) when apiList already holds
+	// an entry with the same payloadId. With DedupeByMessage set, an API entry
+	// with the same messageId, action and sender also counts; callers set it when
+	// the payload_id was generated locally and so cannot identify a retry.
+	Dedupe          bool
+	DedupeByMessage bool
+
+	// OrderByTimestamp inserts the entry by its Beckn timestamp instead of appending it, and
+	// only moves latestAction/latestTimestamp forward when the event is newer.
+	OrderByTimestamp bool
+
+	// ContextMismatches are recorded on the entry as contextMismatches when non-empty.
+	ContextMismatches []contextMismatch
+
+	// SchemaValidation is recorded on the entry as schemaValidation when non-nil.
+	SchemaValidation *schemaValidationResult
+
+	// Flows, when set, recomputes the transaction's flowProgress for its flowId after the append.
+	Flows flowCatalog
+
+	// TrackCallbackTTL pairs callbacks with their requests (withinTtl, latencyMs, deadline)
+	// and refreshes the transaction's missingCallbacks.
+	TrackCallbackTTL bool
+
+	// AckStatus and ResponseError are stored on the entry; ACK/NACK also bump the
+	// transaction's ackCount/nackCount.
+	AckStatus     string
+	ResponseError map[string]any
+
+	// IsMock tags the entry as mock traffic (additionalData.is_mock).
+	IsMock bool
+
+	// Caller is the authenticated gRPC caller (e.g. "mtls:api-service"), when auth is enabled.
+	Caller string
+
+	// Sender is the BPP that sent the event (context bpp_id or bpp_uri), stored on the entry.
+	Sender string
 }
 
 func updateTransactionAtomically(ctx context.Context, rdb *redis.Client, key string, in *cacheAppendInput, cacheTTL time.Duration) error {
@@ -66,11 +106,17 @@ func updateTransactionAtomically(ctx context.Context, rdb *redis.Client, key str
 				txn = map[string]any{}
 			}
 
+			if in.Dedupe {
+				existing, _ := txn["apiList"].([]any)
+				if hasDuplicateAPIEntry(existing, in) {
+					fmt.Printf("[CACHE] Duplicate event for key: %s (payloadId: %s), skipping append\n", key, in.PayloadID)
+					return errDuplicate
+				}
+			}
+
 			// IMPORTANT: Keep cache JSON compatible with the shared TS/Go cache types.
 			// Key is: transactionId::subscriberUrl
 			// Value is a TransactionCache containing apiList entries shaped like ApiData.
-			txn["latestAction"] = strings.TrimSpace(in.Action)
-			txn["latestTimestamp"] = strings.TrimSpace(in.Timestamp)
 
 			// Maintain messageIds (used for duplicate message_id checks).
 			messageID := strings.TrimSpace(in.MessageID)
@@ -121,9 +167,65 @@ func updateTransactionAtomically(ctx context.Context, rdb *redis.Client, key str
 			if in.TTLSecs > 0 {
 				apiEntry["ttl"] = in.TTLSecs
 			}
-			apiList = append(apiList, apiEntry)
+			if len(in.ContextMismatches) > 0 {
+				apiEntry["contextMismatches"] = in.ContextMismatches
+			}
+			if in.SchemaValidation != nil {
+				apiEntry["schemaValidation"] = in.SchemaValidation
+			}
+			if in.IsMock {
+				apiEntry["isMock"] = true
+			}
+			if in.Caller != "" {
+				apiEntry["caller"] = in.Caller
+			}
+			if in.Sender != "" {
+				apiEntry["sender"] = in.Sender
+			}
+			if in.AckStatus != "" {
+				apiEntry["ackStatus"] = in.AckStatus
+			}
+			if in.ResponseError != nil {
+				apiEntry["responseError"] = in.ResponseError
+			}
+			switch in.AckStatus {
+			case ackStatusACK:
+				txn["ackCount"] = getInt64(txn, "ackCount") + 1
+			case ackStatusNACK:
+				txn["nackCount"] = getInt64(txn, "nackCount") + 1
+			}
+			if in.OrderByTimestamp {
+				idx := timestampInsertIndex(apiList, apiEntry)
+				if idx < len(apiList) {
+					fmt.Printf("[CACHE] Out-of-order %s (timestamp %s) inserted at %d/%d for key: %s\n", in.Action, in.Timestamp, idx, len(apiList), key)
+					apiEntry["outOfOrder"] = true
+				}
+				apiList = slices.Insert(apiList, idx, any(apiEntry))
+				if isNewerThanLatest(txn, apiEntry) {
+					txn["latestAction"] = strings.TrimSpace(in.Action)
+					txn["latestTimestamp"] = strings.TrimSpace(in.Timestamp)
+				}
+			} else {
+				apiList = append(apiList, apiEntry)
+				txn["latestAction"] = strings.TrimSpace(in.Action)
+				txn["latestTimestamp"] = strings.TrimSpace(in.Timestamp)
+			}
 			txn["apiList"] = apiList
 
+			if in.TrackCallbackTTL {
+				paired := annotateCallbackTTL(apiList, apiEntry)
+				updateMissingCallbacks(txn, apiEntry, paired, time.Now())
+			}
+
+			if in.Flows != nil {
+				if fp := in.Flows.progress(getString(txn, "flowId"), apiList); fp != nil {
+					txn["flowProgress"] = fp
+					if len(fp.Missing)+len(fp.Duplicated)+len(fp.Unexpected)+len(fp.OutOfSequence) > 0 {
+						fmt.Printf("[CACHE] Flow %s deviations for key %s: missing=%v outOfSequence=%v duplicated=%v unexpected=%v\n", fp.FlowID, key, fp.Missing, fp.OutOfSequence, fp.Duplicated, fp.Unexpected)
+					}
+				}
+			}
+
 			updated, err := json.Marshal(txn)
 			if err != nil {
 				return err
@@ -142,7 +244,7 @@ func updateTransactionAtomically(ctx context.Context, rdb *redis.Client, key str
 		if err == nil {
 			return nil
 		}
-		if errors.Is(err, errNotFound) {
+		if errors.Is(err, errNotFound) || errors.Is(err, errDuplicate) {
 			return err
 		}
 		// Conflict retry.
@@ -159,36 +261,188 @@ func updateTransactionAtomically(ctx context.Context, rdb *redis.Client, key str
 	return errAborted
 }
 
-func createFlowStatusCacheKey(transactionID, subscriberURL string) string {
-	transactionID = strings.TrimSpace(transactionID)
-	subscriberURL = strings.TrimSpace(subscriberURL)
-	if transactionID == "" || subscriberURL == "" {
-		return ""
+// patchAPIEntryAtomically sets fields on the apiList entry with the given payloadId, keeping the
+// key's TTL. It is used to attach results computed after the entry was appended.
+func patchAPIEntryAtomically(ctx context.Context, rdb *redis.Client, key, payloadID string, fields map[string]any) error {
+	payloadID = strings.TrimSpace(payloadID)
+	if payloadID == "" {
+		return fmt.Errorf("invalid payloadId")
 	}
-	// Matches TS: `FLOW_STATUS_${transactionId}::${subscriberUrl}` (no trailing-slash trimming)
-	return "FLOW_STATUS_" + transactionID + "::" + subscriberURL
+	return mutateTransactionAtomically(ctx, rdb, key, func(txn map[string]any) error {
+		apiList, _ := txn["apiList"].([]any)
+		for _, it := range apiList {
+			if e, ok := it.(map[string]any); ok && getString(e, "payloadId") == payloadID {
+				for k, v := range fields {
+					e[k] = v
+				}
+				return nil
+			}
+		}
+		return errNotFound
+	})
 }
 
-func setFlowStatusIfExists(ctx context.Context, rdb *redis.Client, transactionID, subscriberURL, statusValue string, ttl time.Duration) error {
-	if rdb == nil {
-		return nil
+// mutateTransactionAtomically applies fn to the stored transaction under WATCH and writes it
+// back with its TTL preserved. fn's error aborts the write and is returned unchanged.
+func mutateTransactionAtomically(ctx context.Context, rdb *redis.Client, key string, fn func(txn map[string]any) error) error {
+	if rdb == nil || key == "" {
+		return fmt.Errorf("invalid key")
 	}
-	key := createFlowStatusCacheKey(transactionID, subscriberURL)
-	if key == "" {
-		return nil
+
+	const maxAttempts = 8
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		var fnErr error
+		err := rdb.Watch(ctx, func(tx *redis.Tx) error {
+			val, err := tx.Get(ctx, key).Result()
+			if err != nil {
+				if errors.Is(err, redis.Nil) {
+					return errNotFound
+				}
+				return err
+			}
+			ttl, _ := tx.TTL(ctx, key).Result()
+
+			var txn map[string]any
+			if err := json.Unmarshal([]byte(val), &txn); err != nil {
+				return err
+			}
+			if txn == nil {
+				txn = map[string]any{}
+			}
+			if fnErr = fn(txn); fnErr != nil {
+				return fnErr
+			}
+
+			updated, err := json.Marshal(txn)
+			if err != nil {
+				return err
+			}
+			if ttl < 0 {
+				// -1 means persistent key; -2 shouldn't happen because GET succeeded.
+				ttl = 0
+			}
+			pipe := tx.TxPipeline()
+			pipe.Set(ctx, key, string(updated), ttl)
+			_, err = pipe.Exec(ctx)
+			return err
+		}, key)
+
+		if err == nil {
+			return nil
+		}
+		if fnErr != nil || errors.Is(err, errNotFound) {
+			return err
+		}
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		return err
+	}
+	return errAborted
+}
+
+// entryOrderTime is the time an apiList entry sorts by: its Beckn timestamp, falling back to
+// realTimestamp (arrival time). The zero time means neither could be parsed.
+func entryOrderTime(entry map[string]any) time.Time {
+	for _, k := range []string{"timestamp", "realTimestamp"} {
+		if ts, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(getString(entry, k))); err == nil {
+			return ts
+		}
+	}
+	return time.Time{}
+}
+
+// timestampInsertIndex returns where entry belongs in apiList so that entries stay ordered by
+// entryOrderTime. Entries with equal times keep arrival order; unparseable entries are not passed.
+func timestampInsertIndex(apiList []any, entry map[string]any) int {
+	at := entryOrderTime(entry)
+	idx := len(apiList)
+	for idx > 0 {
+		prev, _ := apiList[idx-1].(map[string]any)
+		if prev == nil || !entryOrderTime(prev).After(at) {
+			break
+		}
+		idx--
 	}
-	exists, err := rdb.Exists(ctx, key).Result()
+	return idx
+}
+
+// isNewerThanLatest reports whether entry is at least as recent as the transaction's
+// latestTimestamp. A missing or unparseable latestTimestamp always counts as older.
+func isNewerThanLatest(txn map[string]any, entry map[string]any) bool {
+	latest, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(getString(txn, "latestTimestamp")))
 	if err != nil {
-		return err
+		return true
 	}
-	if exists == 0 {
-		return nil
+	return !entryOrderTime(entry).Before(latest)
+}
+
+// hasDuplicateAPIEntry reports whether apiList already records the event described by in.
+func hasDuplicateAPIEntry(apiList []any, in *cacheAppendInput) bool {
+	payloadID := strings.TrimSpace(in.PayloadID)
+	messageID := strings.TrimSpace(in.MessageID)
+	action := strings.TrimSpace(in.Action)
+	sender := strings.TrimSpace(in.Sender)
+	for _, it := range apiList {
+		entry, ok := it.(map[string]any)
+		if !ok {
+			continue
+		}
+		if payloadID != "" && getString(entry, "payloadId") == payloadID {
+			return true
+		}
+		if in.DedupeByMessage && messageID != "" &&
+			getString(entry, "entryType") == "API" &&
+			getString(entry, "messageId") == messageID &&
+			getString(entry, "action") == action &&
+			getString(entry, "sender") == sender {
+			return true
+		}
+	}
+	return false
+}
+
+// newTransactionSeed builds the minimal TransactionCache used when a transaction is auto-created
+// for an event whose key does not exist yet. subscriberType is inferred from the request context.
+func newTransactionSeed(transactionID, subscriberURL string, requestBody map[string]any) map[string]any {
+	return map[string]any{
+		"transactionId":   strings.TrimSpace(transactionID),
+		"subscriberUrl":   strings.TrimRight(strings.TrimSpace(subscriberURL), "/"),
+		"subscriberType":  subscriberRole(requestBody, subscriberURL),
+		"latestAction":    "",
+		"latestTimestamp": "",
+		"type":            "",
+		"messageIds":      []any{},
+		"apiList":         []any{},
+		"referenceData":   map[string]any{},
+		"autoCreated":     true,
+	}
+}
+
+// createTransactionIfMissing stores seed under key unless the key already exists, and reports
+// whether it was created. Losing a race to the API service is not an error.
+func createTransactionIfMissing(ctx context.Context, rdb *redis.Client, key string, seed map[string]any, ttl time.Duration) (bool, error) {
+	if rdb == nil || key == "" {
+		return false, fmt.Errorf("invalid key")
 	}
-	b, err := json.Marshal(map[string]any{"status": statusValue})
+	b, err := json.Marshal(seed)
 	if err != nil {
-		return err
+		return false, err
 	}
-	return rdb.Set(ctx, key, string(b), ttl).Err()
+	if ttl < 0 {
+		ttl = 0
+	}
+	return rdb.SetNX(ctx, key, string(b), ttl).Result()
+}
+
+func createFlowStatusCacheKey(transactionID, subscriberURL string) string {
+	transactionID = strings.TrimSpace(transactionID)
+	subscriberURL = strings.TrimSpace(subscriberURL)
+	if transactionID == "" || subscriberURL == "" {
+		return ""
+	}
+	// Matches TS: `FLOW_STATUS_${transactionId}::${subscriberUrl}` (no trailing-slash trimming)
+	return "FLOW_STATUS_" + transactionID + "::" + subscriberURL
 }
 
 func createExtraFlowStatusCacheKey(transactionID, subscriberURL, extraStepKey string) string {
@@ -201,26 +455,24 @@ func createExtraFlowStatusCacheKey(transactionID, subscriberURL, extraStepKey st
 	return "EXTRA_FLOW_STATUS_" + transactionID + "::" + subscriberURL + "::" + extraStepKey
 }
 
-func setExtraFlowStatusIfExists(ctx context.Context, rdb *redis.Client, transactionID, subscriberURL, extraStepKey, statusValue string, ttl time.Duration) error {
-	if rdb == nil {
-		return nil
-	}
-	key := createExtraFlowStatusCacheKey(transactionID, subscriberURL, extraStepKey)
-	if key == "" {
-		return nil
-	}
-	exists, err := rdb.Exists(ctx, key).Result()
-	if err != nil {
-		return err
-	}
-	if exists == 0 {
-		return nil
+// createEventMarkerKey returns the short-lived key that records an event's side effects were
+// already enqueued. eventID is the payload_id, or messageId::action::sender when none was
+// sent (messageId::action for events without a BPP sender); see eventIdempotencyID.
+func createEventMarkerKey(transactionKey, eventID string) string {
+	transactionKey = strings.TrimSpace(transactionKey)
+	eventID = strings.TrimSpace(eventID)
+	if transactionKey == "" || eventID == "" {
+		return ""
 	}
-	b, err := json.Marshal(map[string]any{"status": statusValue})
-	if err != nil {
-		return err
+	return "RECORDER_EVENT_" + transactionKey + "::" + eventID
+}
+
+// claimEventMarker sets the marker key if it is absent and reports whether this call set it.
+func claimEventMarker(ctx context.Context, rdb *redis.Client, key string, ttl time.Duration) (bool, error) {
+	if rdb == nil || key == "" {
+		return true, nil
 	}
-	return rdb.Set(ctx, key, string(b), ttl).Err()
+	return rdb.SetNX(ctx, key, tsISOStringNow(), ttl).Result()
 }
 
 func loadTransactionMap(ctx context.Context, rdb *redis.Client, key string) (map[string]any, error) {
@@ -238,7 +238,7 @@ func TestLoadTransactionMapInvalidJSON(t *testing.T) {
 	}
 }
 
-func TestSetFlowStatusIfExistsCreatesNewKey(t *testing.T) {
+func TestApplyFlowStatusUpdatesExistingKey(t *testing.T) {
 	mr := miniredis.RunT(t)
 	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
 	ctx := context.Background()
@@ -252,8 +252,8 @@ func TestSetFlowStatusIfExistsCreatesNewKey(t *testing.T) {
 	}
 
 	// Update it
-	if err := setFlowStatusIfExists(ctx, rdb, "t1", "https://s", "COMPLETED", 1*time.Hour); err != nil {
-		t.Fatalf("setFlowStatusIfExists() error = %v", err)
+	if err := applyFlowStatus(ctx, rdb, nil, "t1", "https://s", flowStatusEvent{EntryType: "FORM", FormID: "f1"}); err != nil {
+		t.Fatalf("applyFlowStatus() error = %v", err)
 	}
 
 	val, err := rdb.Get(ctx, key).Result()
@@ -266,8 +266,8 @@ func TestSetFlowStatusIfExistsCreatesNewKey(t *testing.T) {
 		t.Fatalf("unmarshal: %v", err)
 	}
 
-	if got["status"] != "COMPLETED" {
-		t.Errorf("status = %v, want COMPLETED", got["status"])
+	if got["status"] != "AVAILABLE" {
+		t.Errorf("status = %v, want AVAILABLE", got["status"])
 	}
 
 	// Check TTL was set
@@ -275,8 +275,8 @@ func TestSetFlowStatusIfExistsCreatesNewKey(t *testing.T) {
 	if err != nil {
 		t.Fatalf("ttl: %v", err)
 	}
-	if ttl <= 0 || ttl > 1*time.Hour {
-		t.Errorf("TTL = %v, want between 0 and 1 hour", ttl)
+	if ttl != defaultFlowStatusTTL {
+		t.Errorf("TTL = %v, want %v", ttl, defaultFlowStatusTTL)
 	}
 }
 
@@ -319,3 +319,187 @@ func TestUpdateTransactionAtomicallyRetry(t *testing.T) {
 		t.Fatalf("update: %v", err)
 	}
 }
+
+func TestUpdateTransactionAtomicallyDuplicatePayloadID(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+
+	key := createTransactionKey("t1", "https://s")
+	seed := map[string]any{"apiList": []any{}}
+	seedB, _ := json.Marshal(seed)
+	if err := rdb.Set(ctx, key, string(seedB), 0).Err(); err != nil {
+		t.Fatalf("seed set: %v", err)
+	}
+
+	req := &cacheAppendInput{
+		PayloadID:     "pid-1",
+		TransactionID: "t1",
+		SubscriberURL: "https://s",
+		MessageID:     "m1",
+		Action:        "on_search",
+		Timestamp:     "2026-01-07T00:00:00Z",
+		Dedupe:        true,
+	}
+	if err := updateTransactionAtomically(ctx, rdb, key, req, 0); err != nil {
+		t.Fatalf("first update: %v", err)
+	}
+	if err := updateTransactionAtomically(ctx, rdb, key, req, 0); err != errDuplicate {
+		t.Fatalf("second update: expected errDuplicate, got %v", err)
+	}
+
+	txn, err := loadTransactionMap(ctx, rdb, key)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if apiList := txn["apiList"].([]any); len(apiList) != 1 {
+		t.Errorf("apiList length = %d, want 1", len(apiList))
+	}
+}
+
+func TestUpdateTransactionAtomicallyDuplicateByMessage(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+
+	key := createTransactionKey("t1", "https://s")
+	seed := map[string]any{"apiList": []any{
+		map[string]any{"entryType": "API", "action": "on_search", "payloadId": "generated-1", "messageId": "m1"},
+	}}
+	seedB, _ := json.Marshal(seed)
+	if err := rdb.Set(ctx, key, string(seedB), 0).Err(); err != nil {
+		t.Fatalf("seed set: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		in      cacheAppendInput
+		wantErr error
+	}{
+		{"same message and action without payload id", cacheAppendInput{PayloadID: "generated-2", MessageID: "m1", Action: "on_search", Dedupe: true, DedupeByMessage: true}, errDuplicate},
+		{"same message, different action", cacheAppendInput{PayloadID: "generated-3", MessageID: "m1", Action: "search", Dedupe: true, DedupeByMessage: true}, nil},
+		{"same message and action from another sender", cacheAppendInput{PayloadID: "generated-4", MessageID: "m1", Action: "on_search", Sender: "seller-b", Dedupe: true, DedupeByMessage: true}, nil},
+		{"message match ignored when payload id sent", cacheAppendInput{PayloadID: "pid-x", MessageID: "m1", Action: "on_search", Dedupe: true}, nil},
+		{"dedupe disabled", cacheAppendInput{PayloadID: "generated-1", MessageID: "m1", Action: "on_search"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := updateTransactionAtomically(ctx, rdb, key, &tt.in, 0); err != tt.wantErr {
+				t.Errorf("updateTransactionAtomically() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClaimEventMarker(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+
+	key := createEventMarkerKey("t1::https://s", "pid-1")
+	if key != "RECORDER_EVENT_t1::https://s::pid-1" {
+		t.Fatalf("createEventMarkerKey() = %q", key)
+	}
+
+	claimed, err := claimEventMarker(ctx, rdb, key, time.Minute)
+	if err != nil || !claimed {
+		t.Fatalf("first claim = %v, %v; want true, nil", claimed, err)
+	}
+	claimed, err = claimEventMarker(ctx, rdb, key, time.Minute)
+	if err != nil || claimed {
+		t.Fatalf("second claim = %v, %v; want false, nil", claimed, err)
+	}
+
+	mr.FastForward(2 * time.Minute)
+	claimed, err = claimEventMarker(ctx, rdb, key, time.Minute)
+	if err != nil || !claimed {
+		t.Fatalf("claim after expiry = %v, %v; want true, nil", claimed, err)
+	}
+}
+
+func TestUpdateTransactionAtomicallyTimestampOrdering(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+
+	key := createTransactionKey("t1", "https://s")
+	seed := map[string]any{"apiList": []any{}}
+	seedB, _ := json.Marshal(seed)
+	if err := rdb.Set(ctx, key, string(seedB), 0).Err(); err != nil {
+		t.Fatalf("seed set: %v", err)
+	}
+
+	// on_select is recorded before the select that triggered it.
+	events := []cacheAppendInput{
+		{PayloadID: "p2", MessageID: "m1", Action: "on_select", Timestamp: "2026-01-07T00:00:02Z", OrderByTimestamp: true},
+		{PayloadID: "p1", MessageID: "m1", Action: "select", Timestamp: "2026-01-07T00:00:01Z", OrderByTimestamp: true},
+		{PayloadID: "p3", MessageID: "m2", Action: "init", Timestamp: "2026-01-07T00:00:03Z", OrderByTimestamp: true},
+	}
+	for i := range events {
+		if err := updateTransactionAtomically(ctx, rdb, key, &events[i], 0); err != nil {
+			t.Fatalf("update %s: %v", events[i].Action, err)
+		}
+	}
+
+	txn, err := loadTransactionMap(ctx, rdb, key)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	apiList := txn["apiList"].([]any)
+	wantOrder := []string{"select", "on_select", "init"}
+	for i, want := range wantOrder {
+		entry := apiList[i].(map[string]any)
+		if entry["action"] != want {
+			t.Errorf("apiList[%d].action = %v, want %v", i, entry["action"], want)
+		}
+		wantFlag := want == "select"
+		if gotFlag, _ := entry["outOfOrder"].(bool); gotFlag != wantFlag {
+			t.Errorf("apiList[%d].outOfOrder = %v, want %v", i, gotFlag, wantFlag)
+		}
+	}
+	if txn["latestAction"] != "init" {
+		t.Errorf("latestAction = %v, want init", txn["latestAction"])
+	}
+	if txn["latestTimestamp"] != "2026-01-07T00:00:03Z" {
+		t.Errorf("latestTimestamp = %v, want 2026-01-07T00:00:03Z", txn["latestTimestamp"])
+	}
+}
+
+func TestIsNewerThanLatest(t *testing.T) {
+	entry := map[string]any{"timestamp": "2026-01-07T00:00:02Z"}
+	tests := []struct {
+		name   string
+		latest any
+		want   bool
+	}{
+		{"missing latest", nil, true},
+		{"unparseable latest", "old", true},
+		{"older latest", "2026-01-07T00:00:01Z", true},
+		{"same latest", "2026-01-07T00:00:02Z", true},
+		{"newer latest", "2026-01-07T00:00:03.000Z", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txn := map[string]any{"latestTimestamp": tt.latest}
+			if got := isNewerThanLatest(txn, entry); got != tt.want {
+				t.Errorf("isNewerThanLatest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateTransactionAtomicallyTagsMock(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+	key := createTransactionKey("t1", "https://s")
+	mr.Set(key, `{"apiList":[]}`)
+
+	if err := updateTransactionAtomically(ctx, rdb, key, &cacheAppendInput{PayloadID: "p1", Action: "search", IsMock: true}, 0); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	txn, _ := loadTransactionMap(ctx, rdb, key)
+	if entry := txn["apiList"].([]any)[0].(map[string]any); entry["isMock"] != true {
+		t.Errorf("isMock = %v, want true", entry["isMock"])
+	}
+}
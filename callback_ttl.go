@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// callbackDeadlinesKey is a sorted set of transaction keys scored by the earliest callback
+// deadline (unix ms) still to be checked. The sweeper re-evaluates missingCallbacks once a
+// deadline passes, so a request whose callback never arrives is flagged without a later event.
+const callbackDeadlinesKey = "RECORDER_CALLBACK_DEADLINES"
+
+// isCallbackAction reports whether action is a Beckn callback (on_search, on_select, ...).
+func isCallbackAction(action string) bool {
+	return strings.HasPrefix(strings.TrimSpace(action), "on_")
+}
+
+// callbackDeadline is when the callback for a request entry is due: its order time plus its ttl
+// (seconds). ok is false when the entry has no ttl or no usable time.
+func callbackDeadline(request map[string]any) (time.Time, bool) {
+	ttl := getInt64(request, "ttl")
+	at := entryOrderTime(request)
+	if ttl <= 0 || at.IsZero() {
+		return time.Time{}, false
+	}
+	return at.Add(time.Duration(ttl) * time.Second), true
+}
+
+// isCallbackPair reports whether callback answers request: same messageId and on_<action>.
+func isCallbackPair(request, callback map[string]any) bool {
+	if getString(request, "entryType") != "API" || getString(callback, "entryType") != "API" {
+		return false
+	}
+	messageID := getString(request, "messageId")
+	return messageID != "" &&
+		getString(callback, "messageId") == messageID &&
+		getString(callback, "action") == "on_"+getString(request, "action")
+}
+
+// annotateCallbackTTL pairs entry with its counterpart(s) in apiList and sets withinTtl,
+// latencyMs and deadline on each callback of the pair. Either side may arrive first. It
+// reports whether a counterpart was found.
+func annotateCallbackTTL(apiList []any, entry map[string]any) bool {
+	paired := false
+	for _, it := range apiList {
+		other, _ := it.(map[string]any)
+		if other == nil {
+			continue
+		}
+		switch {
+		case isCallbackPair(other, entry):
+			setCallbackTiming(other, entry)
+			paired = true
+		case isCallbackPair(entry, other):
+			setCallbackTiming(entry, other)
+			paired = true
+		}
+	}
+	return paired
+}
+
+// updateMissingCallbacks keeps txn's missingCallbacks current after entry is appended, without
+// rescanning apiList: a callback clears the request it answers, and a request that is already
+// past its deadline without a callback (paired, from annotateCallbackTTL) is added. Requests
+// whose deadline passes later are added by the sweeper.
+func updateMissingCallbacks(txn, entry map[string]any, paired bool, now time.Time) {
+	missing, _ := txn["missingCallbacks"].([]any)
+	if missing == nil {
+		missing = []any{}
+	}
+	messageID := getString(entry, "messageId")
+	action := getString(entry, "action")
+	switch {
+	case messageID == "":
+	case isCallbackAction(action):
+		kept := missing[:0]
+		for _, it := range missing {
+			m, _ := it.(map[string]any)
+			if m != nil && getString(m, "messageId") == messageID && "on_"+getString(m, "action") == action {
+				continue
+			}
+			kept = append(kept, it)
+		}
+		missing = kept
+	case !paired:
+		if deadline, ok := callbackDeadline(entry); ok && !deadline.After(now) {
+			missing = append(missing, missingCallbackEntry(entry, deadline))
+		}
+	}
+	txn["missingCallbacks"] = missing
+}
+
+func missingCallbackEntry(req map[string]any, deadline time.Time) map[string]any {
+	return map[string]any{
+		"action":    getString(req, "action"),
+		"messageId": getString(req, "messageId"),
+		"payloadId": getString(req, "payloadId"),
+		"deadline":  deadline.UTC().Format("2006-01-02T15:04:05.000Z"),
+	}
+}
+
+func setCallbackTiming(request, callback map[string]any) {
+	reqAt, cbAt := entryOrderTime(request), entryOrderTime(callback)
+	if reqAt.IsZero() || cbAt.IsZero() {
+		return
+	}
+	callback["latencyMs"] = cbAt.Sub(reqAt).Milliseconds()
+	if deadline, ok := callbackDeadline(request); ok {
+		callback["deadline"] = deadline.UTC().Format("2006-01-02T15:04:05.000Z")
+		callback["withinTtl"] = !cbAt.After(deadline)
+	}
+}
+
+// missingCallbacks lists request entries whose deadline is before now and that have no callback
+// in apiList. It returns the earliest deadline still in the future as next (zero if none).
+func missingCallbacks(apiList []any, now time.Time) (missing []any, next time.Time) {
+	missing = []any{}
+	answered := map[string]bool{}
+	for _, it := range apiList {
+		if cb, _ := it.(map[string]any); cb != nil && getString(cb, "entryType") == "API" && isCallbackAction(getString(cb, "action")) {
+			answered[getString(cb, "messageId")+"::"+getString(cb, "action")] = true
+		}
+	}
+	for _, it := range apiList {
+		req, _ := it.(map[string]any)
+		if req == nil || getString(req, "entryType") != "API" || isCallbackAction(getString(req, "action")) {
+			continue
+		}
+		deadline, ok := callbackDeadline(req)
+		if !ok || getString(req, "messageId") == "" {
+			continue
+		}
+		if answered[getString(req, "messageId")+"::on_"+getString(req, "action")] {
+			continue
+		}
+		if deadline.After(now) {
+			if next.IsZero() || deadline.Before(next) {
+				next = deadline
+			}
+			continue
+		}
+		missing = append(missing, missingCallbackEntry(req, deadline))
+	}
+	return missing, next
+}
+
+// scheduleCallbackCheck asks the sweeper to re-check key at deadline. An earlier pending
+// deadline for the same key is kept.
+func scheduleCallbackCheck(ctx context.Context, rdb *redis.Client, key string, deadline time.Time) error {
+	if rdb == nil || key == "" || deadline.IsZero() {
+		return nil
+	}
+	return rdb.ZAddLT(ctx, callbackDeadlinesKey, redis.Z{Score: float64(deadline.UnixMilli()), Member: key}).Err()
+}
+
+// refreshMissingCallbacks recomputes missingCallbacks on the transaction and returns the next
+// pending deadline, if any.
+func refreshMissingCallbacks(ctx context.Context, rdb *redis.Client, key string, now time.Time) (time.Time, error) {
+	var next time.Time
+	err := mutateTransactionAtomically(ctx, rdb, key, func(txn map[string]any) error {
+		apiList, _ := txn["apiList"].([]any)
+		var missing []any
+		missing, next = missingCallbacks(apiList, now)
+		txn["missingCallbacks"] = missing
+		return nil
+	})
+	return next, err
+}
+
+// sweepCallbackDeadlines refreshes every transaction whose scheduled deadline has passed. The
+// due deadline is replaced by the next one in a single MULTI only after the refresh succeeded,
+// and only if no other instance or event changed it meanwhile; otherwise it stays due and is
+// swept again, so a failed refresh never loses a deadline.
+func sweepCallbackDeadlines(ctx context.Context, rdb *redis.Client, now time.Time) (int, error) {
+	due, err := rdb.ZRangeByScoreWithScores(ctx, callbackDeadlinesKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return 0, err
+	}
+	refreshed := 0
+	for _, z := range due {
+		key, _ := z.Member.(string)
+		next, err := refreshMissingCallbacks(ctx, rdb, key, now)
+		if errors.Is(err, errNotFound) {
+			next = time.Time{}
+		} else if err != nil {
+			fmt.Printf("[TTL] ERROR: Failed to refresh missing callbacks for key %s: %v\n", key, err)
+			continue
+		}
+		err = rdb.Watch(ctx, func(tx *redis.Tx) error {
+			score, err := tx.ZScore(ctx, callbackDeadlinesKey, key).Result()
+			if errors.Is(err, redis.Nil) || (err == nil && score != z.Score) {
+				return errAborted
+			}
+			if err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.ZRem(ctx, callbackDeadlinesKey, key)
+				if !next.IsZero() {
+					pipe.ZAdd(ctx, callbackDeadlinesKey, redis.Z{Score: float64(next.UnixMilli()), Member: key})
+				}
+				return nil
+			})
+			return err
+		}, callbackDeadlinesKey)
+		switch {
+		case err == nil:
+			refreshed++
+		case errors.Is(err, errAborted), errors.Is(err, redis.TxFailedErr):
+			// Rescheduled or swept elsewhere meanwhile; left for the next sweep.
+		default:
+			return refreshed, err
+		}
+	}
+	return refreshed, nil
+}
+
+// runCallbackSweeper sweeps callback deadlines every interval until ctx is done.
+func runCallbackSweeper(ctx context.Context, rdb *redis.Client, interval time.Duration) {
+	if rdb == nil || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if n, err := sweepCallbackDeadlines(ctx, rdb, now); err != nil {
+				fmt.Printf("[TTL] ERROR: Callback deadline sweep failed: %v\n", err)
+			} else if n > 0 {
+				fmt.Printf("[TTL] Refreshed missing callbacks for %d transaction(s)\n", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestAnnotateCallbackTTL(t *testing.T) {
+	request := map[string]any{"entryType": "API", "action": "search", "messageId": "m1", "timestamp": "2026-01-07T00:00:00Z", "ttl": float64(30)}
+	onTime := map[string]any{"entryType": "API", "action": "on_search", "messageId": "m1", "timestamp": "2026-01-07T00:00:05Z"}
+	late := map[string]any{"entryType": "API", "action": "on_search", "messageId": "m1", "timestamp": "2026-01-07T00:01:00Z"}
+	other := map[string]any{"entryType": "API", "action": "on_search", "messageId": "m2", "timestamp": "2026-01-07T00:00:05Z"}
+
+	// Callback arriving after its request.
+	annotateCallbackTTL([]any{request, onTime}, onTime)
+	if onTime["withinTtl"] != true || onTime["latencyMs"] != int64(5000) || onTime["deadline"] != "2026-01-07T00:00:30.000Z" {
+		t.Errorf("on-time callback = %#v", onTime)
+	}
+
+	// Request arriving after its callback annotates the callback already in apiList.
+	annotateCallbackTTL([]any{late, other, request}, request)
+	if late["withinTtl"] != false || late["latencyMs"] != int64(60000) {
+		t.Errorf("late callback = %#v", late)
+	}
+	if _, ok := other["withinTtl"]; ok {
+		t.Errorf("callback for another message was annotated: %#v", other)
+	}
+}
+
+func TestMissingCallbacks(t *testing.T) {
+	apiList := []any{
+		map[string]any{"entryType": "API", "action": "search", "messageId": "m1", "payloadId": "p1", "timestamp": "2026-01-07T00:00:00Z", "ttl": float64(30)},
+		map[string]any{"entryType": "API", "action": "select", "messageId": "m2", "payloadId": "p2", "timestamp": "2026-01-07T00:00:00Z", "ttl": float64(30)},
+		map[string]any{"entryType": "API", "action": "on_select", "messageId": "m2", "timestamp": "2026-01-07T00:00:10Z"},
+		map[string]any{"entryType": "API", "action": "init", "messageId": "m3", "payloadId": "p3", "timestamp": "2026-01-07T00:01:00Z", "ttl": float64(30)},
+		map[string]any{"entryType": "FORM", "formId": "f1", "timestamp": "2026-01-07T00:00:00Z"},
+	}
+	now, _ := time.Parse(time.RFC3339, "2026-01-07T00:01:00Z")
+
+	missing, next := missingCallbacks(apiList, now)
+	if len(missing) != 1 {
+		t.Fatalf("missingCallbacks() = %v, want only search", missing)
+	}
+	if m := missing[0].(map[string]any); m["action"] != "search" || m["messageId"] != "m1" {
+		t.Errorf("missing[0] = %#v", m)
+	}
+	if want, _ := time.Parse(time.RFC3339, "2026-01-07T00:01:30Z"); !next.Equal(want) {
+		t.Errorf("next = %v, want %v (init deadline)", next, want)
+	}
+}
+
+func TestSweepCallbackDeadlines(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	key := createTransactionKey("t1", "https://s")
+	mr.Set(key, `{"apiList":[{"entryType":"API","action":"search","messageId":"m1","timestamp":"2026-01-07T00:00:00Z","ttl":30}]}`)
+	deadline, _ := time.Parse(time.RFC3339, "2026-01-07T00:00:30Z")
+	if err := scheduleCallbackCheck(ctx, rdb, key, deadline); err != nil {
+		t.Fatalf("scheduleCallbackCheck() error = %v", err)
+	}
+	// A later deadline for the same key does not postpone the pending check.
+	if err := scheduleCallbackCheck(ctx, rdb, key, deadline.Add(time.Hour)); err != nil {
+		t.Fatalf("scheduleCallbackCheck() error = %v", err)
+	}
+
+	if n, err := sweepCallbackDeadlines(ctx, rdb, deadline.Add(-time.Second)); err != nil || n != 0 {
+		t.Fatalf("sweep before deadline = %d, %v; want 0, nil", n, err)
+	}
+	if n, err := sweepCallbackDeadlines(ctx, rdb, deadline.Add(time.Second)); err != nil || n != 1 {
+		t.Fatalf("sweep after deadline = %d, %v; want 1, nil", n, err)
+	}
+
+	txn, _ := loadTransactionMap(ctx, rdb, key)
+	if missing, _ := txn["missingCallbacks"].([]any); len(missing) != 1 {
+		t.Errorf("missingCallbacks = %#v, want one entry", txn["missingCallbacks"])
+	}
+	if n, _ := rdb.ZCard(ctx, callbackDeadlinesKey).Result(); n != 0 {
+		t.Errorf("deadline set size = %d, want 0", n)
+	}
+
+	// A refresh that fails keeps the deadline for the next sweep.
+	mr.Set(key, `not json`)
+	if err := scheduleCallbackCheck(ctx, rdb, key, deadline); err != nil {
+		t.Fatalf("scheduleCallbackCheck() error = %v", err)
+	}
+	if n, err := sweepCallbackDeadlines(ctx, rdb, deadline.Add(time.Second)); err != nil || n != 0 {
+		t.Fatalf("sweep with failing refresh = %d, %v; want 0, nil", n, err)
+	}
+	if _, err := rdb.ZScore(ctx, callbackDeadlinesKey, key).Result(); err != nil {
+		t.Errorf("deadline after failed refresh: %v, want kept", err)
+	}
+}
+
+func TestUpdateTransactionAtomicallyTracksCallbackTTL(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	key := createTransactionKey("t1", "https://s")
+	mr.Set(key, `{"apiList":[]}`)
+
+	events := []cacheAppendInput{
+		{PayloadID: "p1", MessageID: "m1", Action: "search", Timestamp: "2026-01-07T00:00:00Z", TTLSecs: 30, TrackCallbackTTL: true},
+		{PayloadID: "p2", MessageID: "m1", Action: "on_search", Timestamp: "2026-01-07T00:00:02Z", TrackCallbackTTL: true},
+	}
+	for i := range events {
+		if err := updateTransactionAtomically(ctx, rdb, key, &events[i], 0); err != nil {
+			t.Fatalf("update %s: %v", events[i].Action, err)
+		}
+	}
+
+	txn, _ := loadTransactionMap(ctx, rdb, key)
+	callback := txn["apiList"].([]any)[1].(map[string]any)
+	if callback["withinTtl"] != true || callback["latencyMs"] != float64(2000) {
+		t.Errorf("callback = %#v", callback)
+	}
+	if missing, _ := txn["missingCallbacks"].([]any); len(missing) != 0 {
+		t.Errorf("missingCallbacks = %#v, want empty", txn["missingCallbacks"])
+	}
+}
@@ -2,15 +2,22 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"math"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
-	"github.com/joho/godotenv"
 	"github.com/redis/go-redis/v9"
 )
 
 type config struct {
+	// ConfigFile is the optional YAML/JSON file under the env (see config_file.go); it is
+	// polled every ConfigWatchInterval (0 = only on SIGHUP) for hot reload.
+	ConfigFile          string
+	ConfigWatchInterval time.Duration
+
 	ListenAddr     string
 	HTTPListenAddr string
 	RedisAddr      string
@@ -19,9 +26,36 @@ type config struct {
 	SkipNOPush      bool
 	SkipDBSave      bool
 
+	DedupeEvents    bool
+	DedupeMarkerTTL time.Duration
+
+	// APIListOrdering is "arrival" (append) or "timestamp" (insert by Beckn timestamp).
+	APIListOrdering string
+
+	// ContextCheckMode is off, warn, annotate or reject (see context_check.go).
+	ContextCheckMode string
+
+	// SchemaValidationMode is off, sync or async; schemas are read from SchemaDir.
+	SchemaValidationMode string
+	SchemaDir            string
+
+	// FlowsFile is a JSON file of expected action sequences keyed by flowId (see flows.go).
+	FlowsFile string
+
+	// FlowStatusRulesFile is a JSON state machine for FLOW_STATUS updates (see flow_status.go);
+	// empty keeps the default of AVAILABLE for every event.
+	FlowStatusRulesFile string
+
+	// CallbackTTLTracking pairs on_* callbacks with their requests; deadlines that pass without
+	// a callback are swept every CallbackSweepInterval (0 disables the sweeper).
+	CallbackTTLTracking   bool
+	CallbackSweepInterval time.Duration
+
 	AsyncQueueSize   int
 	AsyncWorkerCount int
 	DropOnQueueFull  bool
+	// AsyncPauseBacklog caps the jobs held per sink paused through the admin API (0 = unlimited).
+	AsyncPauseBacklog int
 
 	Env string
 
@@ -39,15 +73,98 @@ type config struct {
 	DBEnabledIn   map[string]bool
 	DBSessionPath string
 	DBPayloadPath string
+
+	// Sessions known to exist in the data service are cached for DBSessionCacheTTL, in an LRU
+	// of DBSessionCacheSize entries (0 = off) and, with DBSessionCacheRedis, in Redis.
+	DBSessionCacheSize  int
+	DBSessionCacheRedis bool
+	DBSessionCacheTTL   time.Duration
+
+	// Sinks names the destinations recorded events are forwarded to (see sink.go).
+	Sinks       []string
+	Archive     archiveConfig
+	WebhookFile string // webhook destinations (see sink_webhook.go)
+
+	// AutoCreateTransactions creates a minimal transaction for events whose key is missing,
+	// limited to AutoCreateEnvs and AutoCreateSubscribers when those are non-empty.
+	AutoCreateTransactions bool
+	AutoCreateEnvs         map[string]bool
+	AutoCreateSubscribers  map[string]bool
+
+	// Parking holds events for transactions that do not exist yet and replays them once the key appears.
+	ParkingEnabled   bool
+	ParkingTTL       time.Duration
+	ParkingMaxEvents int
+	ParkingRetryMin  time.Duration
+	ParkingRetryMax  time.Duration
+
+	// Request size limits (0 = unlimited): the LogEvent payload, the HTTP request body, and
+	// the nesting depth and array length of JSON payloads on both APIs.
+	GRPCMaxRecvBytes int
+	// GRPCMaxMsgBytes is gRPC's own receive cap; larger messages get RESOURCE_EXHAUSTED before
+	// they are buffered. 0 keeps gRPC's default (4 MiB); unset, see defaultGRPCMaxMsgBytes.
+	GRPCMaxMsgBytes  int
+	HTTPMaxBodyBytes int64
+	JSONLimits       jsonLimits
+
+	// Token-bucket rate limits per subscriber_url and per transaction (RPS 0 = off), optionally
+	// overridden by RateLimitFile, and the concurrency limiter that sheds load: at most
+	// MaxInFlight requests (0 = unlimited), or ShedMaxInFlight while Redis latency is above
+	// ShedRedisLatency (0 = off).
+	RateLimitSubscriber  rateLimit
+	RateLimitTransaction rateLimit
+	RateLimitFile        string
+	MaxInFlight          int
+	ShedMaxInFlight      int
+	ShedRedisLatency     time.Duration
+
+	// gRPC listener TLS; a client CA turns on mTLS. Auth is enforced when GRPCAuthTokens
+	// (token -> caller name) or GRPCAllowedClients (client cert CN/SAN) are set.
+	GRPCTLSCert        string
+	GRPCTLSKey         string
+	GRPCTLSClientCA    string
+	GRPCAuthTokens     map[string]string
+	GRPCAllowedClients map[string]bool
+
+	// HTTP API authentication. HTTPAuthRoutes maps a route to the auth methods accepted on it
+	// (apikey, hmac, jwt); routes not listed are open.
+	HTTPAuthRoutes   map[string][]string
+	HTTPAPIKeyHeader string
+	HTTPAPIKeys      map[string]string // key -> caller name
+	HTTPHMACSecret   string
+	HTTPHMACMaxSkew  time.Duration
+	HTTPJWKSFile     string
+	HTTPJWTIssuer    string
+	HTTPJWTAudience  string
+
+	// Mock traffic (additionalData.is_mock) routing.
+	MockSkipNO        bool
+	MockSkipDB        bool
+	MockDBSessionType string
 }
 
 func loadConfig() (config, error) {
+	return readConfig(os.Stdout)
+}
+
+// readConfig loads and validates the config like loadConfig, logging the [CONFIG] summary to w.
+func readConfig(w io.Writer) (config, error) {
 	// Load .env file if it exists
-	if err := godotenv.Load(); err != nil {
+	if err := loadDotEnv(); err != nil {
 		// It's okay if .env file doesn't exist, we'll use OS environment variables
-		fmt.Printf("[CONFIG] Warning: .env file not found, using OS environment variables only\n")
+		fmt.Fprintf(w, "[CONFIG] Warning: .env file not found, using OS environment variables only\n")
 	} else {
-		fmt.Printf("[CONFIG] Successfully loaded .env file\n")
+		fmt.Fprintf(w, "[CONFIG] Successfully loaded .env file\n")
+	}
+	configFile := strings.TrimSpace(os.Getenv("RECORDER_CONFIG_FILE"))
+	if configFile != "" {
+		if err := loadConfigFile(configFile); err != nil {
+			return config{}, err
+		}
+		fmt.Fprintf(w, "[CONFIG] Loaded config file %s\n", configFile)
+	}
+	if err := validateEnv(); err != nil {
+		return config{}, err
 	}
 
 	listenAddr := strings.TrimSpace(os.Getenv("RECORDER_LISTEN_ADDR"))
@@ -68,22 +185,60 @@ func loadConfig() (config, error) {
 		redisAddr = "127.0.0.1:6379"
 	}
 
-	fmt.Printf("[CONFIG] GRPC Listen Address: %s\n", listenAddr)
-	fmt.Printf("[CONFIG] HTTP Listen Address: %s\n", httpListenAddr)
-	fmt.Printf("[CONFIG] Redis Address: %s\n", redisAddr)
+	fmt.Fprintf(w, "[CONFIG] GRPC Listen Address: %s\n", listenAddr)
+	fmt.Fprintf(w, "[CONFIG] HTTP Listen Address: %s\n", httpListenAddr)
+	fmt.Fprintf(w, "[CONFIG] Redis Address: %s\n", redisAddr)
 
 	cfg := config{ListenAddr: listenAddr, HTTPListenAddr: httpListenAddr, RedisAddr: redisAddr}
+	cfg.ConfigFile = configFile
+	cfg.ConfigWatchInterval = time.Duration(envInt("RECORDER_CONFIG_WATCH_INTERVAL_MS", 2000)) * time.Millisecond
 
 	cfg.SkipCacheUpdate = envBool("RECORDER_SKIP_CACHE_UPDATE", false)
 	cfg.SkipNOPush = envBool("RECORDER_SKIP_NO_PUSH", false)
 	cfg.SkipDBSave = envBool("RECORDER_SKIP_DB_SAVE", false)
 
+	cfg.DedupeEvents = envBool("RECORDER_DEDUPE_EVENTS", true)
+	cfg.DedupeMarkerTTL = time.Duration(envInt("RECORDER_DEDUPE_MARKER_TTL_SECONDS", 600)) * time.Second
+	if cfg.DedupeMarkerTTL <= 0 {
+		cfg.DedupeMarkerTTL = 600 * time.Second
+	}
+
+	cfg.APIListOrdering = strings.ToLower(strings.TrimSpace(os.Getenv("RECORDER_APILIST_ORDERING")))
+	if cfg.APIListOrdering != "timestamp" {
+		cfg.APIListOrdering = "arrival"
+	}
+
+	cfg.ContextCheckMode = strings.ToLower(strings.TrimSpace(os.Getenv("RECORDER_CONTEXT_CHECK_MODE")))
+	switch cfg.ContextCheckMode {
+	case contextCheckWarn, contextCheckAnnotate, contextCheckReject:
+	default:
+		cfg.ContextCheckMode = contextCheckOff
+	}
+
+	cfg.SchemaValidationMode = strings.ToLower(strings.TrimSpace(os.Getenv("RECORDER_SCHEMA_VALIDATION")))
+	switch cfg.SchemaValidationMode {
+	case schemaValidationSync, schemaValidationAsync:
+	default:
+		cfg.SchemaValidationMode = schemaValidationOff
+	}
+	cfg.SchemaDir = strings.TrimSpace(os.Getenv("RECORDER_SCHEMA_DIR"))
+
+	cfg.FlowsFile = strings.TrimSpace(os.Getenv("RECORDER_FLOWS_FILE"))
+	cfg.FlowStatusRulesFile = strings.TrimSpace(os.Getenv("RECORDER_FLOW_STATUS_RULES_FILE"))
+
+	cfg.CallbackTTLTracking = envBool("RECORDER_CALLBACK_TTL_TRACKING", false)
+	cfg.CallbackSweepInterval = time.Duration(envInt("RECORDER_CALLBACK_SWEEP_INTERVAL_SECONDS", 10)) * time.Second
+	if cfg.CallbackSweepInterval < 0 {
+		cfg.CallbackSweepInterval = 0
+	}
+
 	cfg.AsyncQueueSize = envInt("RECORDER_ASYNC_QUEUE_SIZE", 1000)
 	cfg.AsyncWorkerCount = envInt("RECORDER_ASYNC_WORKERS", 2)
 	if cfg.AsyncWorkerCount < 1 {
 		cfg.AsyncWorkerCount = 1
 	}
 	cfg.DropOnQueueFull = envBool("RECORDER_ASYNC_DROP_ON_FULL", true)
+	cfg.AsyncPauseBacklog = envInt("RECORDER_ASYNC_PAUSE_BACKLOG", 10000)
 
 	cfg.Env = strings.ToLower(strings.TrimSpace(os.Getenv("RECORDER_ENV")))
 	if cfg.Env == "" {
@@ -109,25 +264,216 @@ func loadConfig() (config, error) {
 	cfg.DBTimeout = time.Duration(envInt("RECORDER_DB_TIMEOUT_MS", 5000)) * time.Millisecond
 	cfg.DBEnabledIn = parseEnvSet(os.Getenv("RECORDER_DB_ENABLED_ENVS"))
 	cfg.DBSessionPath = "/api/sessions"
+	cfg.DBSessionCacheSize = max(envInt("RECORDER_DB_SESSION_CACHE_SIZE", 10000), 0)
+	cfg.DBSessionCacheRedis = envBool("RECORDER_DB_SESSION_CACHE_REDIS", false)
+	cfg.DBSessionCacheTTL = time.Duration(max(envInt("RECORDER_DB_SESSION_CACHE_TTL_SECONDS", 86400), 1)) * time.Second
+
+	sinks := os.Getenv("RECORDER_SINKS")
+	if strings.TrimSpace(sinks) == "" {
+		sinks = "no,db"
+	}
+	for _, name := range strings.Split(sinks, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			if _, ok := sinkFactories[name]; !ok {
+				return config{}, fmt.Errorf("RECORDER_SINKS: unknown sink %q (known: %s)", name, strings.Join(sinkNames(), ", "))
+			}
+			cfg.Sinks = append(cfg.Sinks, name)
+		}
+	}
 
-	fmt.Printf("[CONFIG] Environment: %s\n", cfg.Env)
-	fmt.Printf("[CONFIG] Skip Cache Update: %v\n", cfg.SkipCacheUpdate)
-	fmt.Printf("[CONFIG] Skip NO Push: %v\n", cfg.SkipNOPush)
-	fmt.Printf("[CONFIG] Skip DB Save: %v\n", cfg.SkipDBSave)
-	fmt.Printf("[CONFIG] Async Queue Size: %d\n", cfg.AsyncQueueSize)
-	fmt.Printf("[CONFIG] Async Workers: %d\n", cfg.AsyncWorkerCount)
-	fmt.Printf("[CONFIG] Drop On Queue Full: %v\n", cfg.DropOnQueueFull)
-	fmt.Printf("[CONFIG] API TTL Default: %d seconds\n", cfg.APITTLSecondsDefault)
-	fmt.Printf("[CONFIG] Cache TTL Default: %d seconds\n", cfg.CacheTTLSecondsDefault)
-	fmt.Printf("[CONFIG] Network Observability URL: %s\n", cfg.NOURL)
-	fmt.Printf("[CONFIG] Database Base URL: %s\n", cfg.DBBaseURL)
-	fmt.Printf("[CONFIG] Configuration loaded successfully\n")
+	cfg.Archive = archiveConfig{
+		Path:          strings.TrimSpace(os.Getenv("RECORDER_ARCHIVE_PATH")),
+		MaxSizeMB:     max(envInt("RECORDER_ARCHIVE_MAX_SIZE_MB", 100), 1),
+		MaxAgeDays:    max(envInt("RECORDER_ARCHIVE_MAX_AGE_DAYS", 0), 0),
+		MaxBackups:    max(envInt("RECORDER_ARCHIVE_MAX_BACKUPS", 0), 0),
+		Compress:      envBool("RECORDER_ARCHIVE_COMPRESS", true),
+		Fsync:         strings.ToLower(strings.TrimSpace(os.Getenv("RECORDER_ARCHIVE_FSYNC"))),
+		FsyncInterval: time.Duration(envInt("RECORDER_ARCHIVE_FSYNC_INTERVAL_MS", 1000)) * time.Millisecond,
+	}
+	if cfg.Archive.Fsync == "" {
+		cfg.Archive.Fsync = archiveFsyncInterval
+	}
+	if slices.Contains(cfg.Sinks, "archive") && cfg.Archive.Path == "" {
+		return config{}, fmt.Errorf("RECORDER_ARCHIVE_PATH: required when RECORDER_SINKS includes archive")
+	}
+	cfg.WebhookFile = strings.TrimSpace(os.Getenv("RECORDER_WEBHOOK_FILE"))
+	if slices.Contains(cfg.Sinks, "webhook") && cfg.WebhookFile == "" {
+		return config{}, fmt.Errorf("RECORDER_WEBHOOK_FILE: required when RECORDER_SINKS includes webhook")
+	}
+
+	cfg.AutoCreateTransactions = envBool("RECORDER_AUTO_CREATE_TRANSACTIONS", false)
+	cfg.AutoCreateEnvs = parseEnvSet(os.Getenv("RECORDER_AUTO_CREATE_ENVS"))
+	cfg.AutoCreateSubscribers = map[string]bool{}
+	for _, u := range strings.Split(os.Getenv("RECORDER_AUTO_CREATE_SUBSCRIBERS"), ",") {
+		if u = strings.TrimRight(strings.TrimSpace(u), "/"); u != "" {
+			cfg.AutoCreateSubscribers[u] = true
+		}
+	}
+
+	cfg.ParkingEnabled = envBool("RECORDER_PARKING_ENABLED", false)
+	cfg.ParkingTTL = time.Duration(envInt("RECORDER_PARKING_TTL_MS", 5000)) * time.Millisecond
+	cfg.ParkingMaxEvents = envInt("RECORDER_PARKING_MAX_EVENTS", 1000)
+	cfg.ParkingRetryMin = time.Duration(envInt("RECORDER_PARKING_RETRY_MIN_MS", 50)) * time.Millisecond
+	cfg.ParkingRetryMax = time.Duration(envInt("RECORDER_PARKING_RETRY_MAX_MS", 1000)) * time.Millisecond
+	if cfg.ParkingRetryMin <= 0 {
+		cfg.ParkingRetryMin = 50 * time.Millisecond
+	}
+	if cfg.ParkingRetryMax < cfg.ParkingRetryMin {
+		cfg.ParkingRetryMax = cfg.ParkingRetryMin
+	}
+
+	cfg.GRPCMaxRecvBytes = max(envInt("RECORDER_GRPC_MAX_RECV_BYTES", 4<<20), 0)
+	// Unset, the transport cap leaves room for LogEvent to reject oversize payloads itself.
+	cfg.GRPCMaxMsgBytes = max(envInt("RECORDER_GRPC_MAX_MSG_BYTES", defaultGRPCMaxMsgBytes(cfg.GRPCMaxRecvBytes)), 0)
+	cfg.HTTPMaxBodyBytes = int64(max(envInt("RECORDER_HTTP_MAX_BODY_BYTES", 10<<20), 0))
+	cfg.JSONLimits = jsonLimits{
+		MaxDepth:    max(envInt("RECORDER_JSON_MAX_DEPTH", 64), 0),
+		MaxArrayLen: max(envInt("RECORDER_JSON_MAX_ARRAY_LEN", 10000), 0),
+	}
+
+	cfg.RateLimitSubscriber = rateLimit{RPS: envFloat("RECORDER_RATE_LIMIT_SUBSCRIBER_RPS", 0), Burst: envInt("RECORDER_RATE_LIMIT_SUBSCRIBER_BURST", 0)}
+	cfg.RateLimitTransaction = rateLimit{RPS: envFloat("RECORDER_RATE_LIMIT_TRANSACTION_RPS", 0), Burst: envInt("RECORDER_RATE_LIMIT_TRANSACTION_BURST", 0)}
+	cfg.RateLimitFile = strings.TrimSpace(os.Getenv("RECORDER_RATE_LIMIT_FILE"))
+	cfg.MaxInFlight = max(envInt("RECORDER_MAX_INFLIGHT", 0), 0)
+	cfg.ShedMaxInFlight = max(envInt("RECORDER_SHED_MAX_INFLIGHT", 8), 1)
+	cfg.ShedRedisLatency = time.Duration(max(envInt("RECORDER_SHED_REDIS_LATENCY_MS", 0), 0)) * time.Millisecond
+
+	cfg.GRPCTLSCert = strings.TrimSpace(os.Getenv("RECORDER_GRPC_TLS_CERT"))
+	cfg.GRPCTLSKey = strings.TrimSpace(os.Getenv("RECORDER_GRPC_TLS_KEY"))
+	cfg.GRPCTLSClientCA = strings.TrimSpace(os.Getenv("RECORDER_GRPC_TLS_CLIENT_CA"))
+	cfg.GRPCAuthTokens = parseAPIKeys(os.Getenv("RECORDER_GRPC_AUTH_TOKENS"))
+	cfg.GRPCAllowedClients = map[string]bool{}
+	for _, c := range strings.Split(os.Getenv("RECORDER_GRPC_ALLOWED_CLIENTS"), ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			cfg.GRPCAllowedClients[c] = true
+		}
+	}
+
+	cfg.HTTPAuthRoutes = parseAuthRoutes(os.Getenv("RECORDER_HTTP_AUTH_ROUTES"))
+	cfg.HTTPAPIKeyHeader = strings.TrimSpace(os.Getenv("RECORDER_HTTP_API_KEY_HEADER"))
+	if cfg.HTTPAPIKeyHeader == "" {
+		cfg.HTTPAPIKeyHeader = "X-API-Key"
+	}
+	cfg.HTTPAPIKeys = parseAPIKeys(os.Getenv("RECORDER_HTTP_API_KEYS"))
+	cfg.HTTPHMACSecret = strings.TrimSpace(os.Getenv("RECORDER_HTTP_HMAC_SECRET"))
+	cfg.HTTPHMACMaxSkew = time.Duration(envInt("RECORDER_HTTP_HMAC_MAX_SKEW_SECONDS", 300)) * time.Second
+	if cfg.HTTPHMACMaxSkew <= 0 {
+		cfg.HTTPHMACMaxSkew = 300 * time.Second
+	}
+	cfg.HTTPJWKSFile = strings.TrimSpace(os.Getenv("RECORDER_HTTP_JWKS_FILE"))
+	cfg.HTTPJWTIssuer = strings.TrimSpace(os.Getenv("RECORDER_HTTP_JWT_ISSUER"))
+	cfg.HTTPJWTAudience = strings.TrimSpace(os.Getenv("RECORDER_HTTP_JWT_AUDIENCE"))
+
+	cfg.MockSkipNO = envBool("RECORDER_MOCK_SKIP_NO", false)
+	cfg.MockSkipDB = envBool("RECORDER_MOCK_SKIP_DB", false)
+	cfg.MockDBSessionType = strings.ToUpper(strings.TrimSpace(os.Getenv("RECORDER_MOCK_DB_SESSION_TYPE")))
+
+	fmt.Fprintf(w, "[CONFIG] Config File: %s (watch interval: %v)\n", cfg.ConfigFile, cfg.ConfigWatchInterval)
+	fmt.Fprintf(w, "[CONFIG] Environment: %s\n", cfg.Env)
+	fmt.Fprintf(w, "[CONFIG] Skip Cache Update: %v\n", cfg.SkipCacheUpdate)
+	fmt.Fprintf(w, "[CONFIG] Skip NO Push: %v\n", cfg.SkipNOPush)
+	fmt.Fprintf(w, "[CONFIG] Skip DB Save: %v\n", cfg.SkipDBSave)
+	fmt.Fprintf(w, "[CONFIG] Dedupe Events: %v (marker TTL: %v)\n", cfg.DedupeEvents, cfg.DedupeMarkerTTL)
+	fmt.Fprintf(w, "[CONFIG] apiList Ordering: %s\n", cfg.APIListOrdering)
+	fmt.Fprintf(w, "[CONFIG] Context Check Mode: %s\n", cfg.ContextCheckMode)
+	fmt.Fprintf(w, "[CONFIG] Schema Validation: %s (dir: %s)\n", cfg.SchemaValidationMode, cfg.SchemaDir)
+	fmt.Fprintf(w, "[CONFIG] Flows File: %s\n", cfg.FlowsFile)
+	fmt.Fprintf(w, "[CONFIG] Flow Status Rules File: %s\n", cfg.FlowStatusRulesFile)
+	fmt.Fprintf(w, "[CONFIG] Callback TTL Tracking: %v (sweep interval: %v)\n", cfg.CallbackTTLTracking, cfg.CallbackSweepInterval)
+	fmt.Fprintf(w, "[CONFIG] Async Queue Size: %d\n", cfg.AsyncQueueSize)
+	fmt.Fprintf(w, "[CONFIG] Async Workers: %d\n", cfg.AsyncWorkerCount)
+	fmt.Fprintf(w, "[CONFIG] Drop On Queue Full: %v\n", cfg.DropOnQueueFull)
+	fmt.Fprintf(w, "[CONFIG] Async Pause Backlog: %d\n", cfg.AsyncPauseBacklog)
+	fmt.Fprintf(w, "[CONFIG] API TTL Default: %d seconds\n", cfg.APITTLSecondsDefault)
+	fmt.Fprintf(w, "[CONFIG] Cache TTL Default: %d seconds\n", cfg.CacheTTLSecondsDefault)
+	fmt.Fprintf(w, "[CONFIG] Network Observability URL: %s\n", redactURL(cfg.NOURL))
+	fmt.Fprintf(w, "[CONFIG] Database Base URL: %s\n", redactURL(cfg.DBBaseURL))
+	fmt.Fprintf(w, "[CONFIG] DB Session Cache: %d entries, Redis: %v, TTL: %v\n", cfg.DBSessionCacheSize, cfg.DBSessionCacheRedis, cfg.DBSessionCacheTTL)
+	fmt.Fprintf(w, "[CONFIG] Sinks: %v\n", cfg.Sinks)
+	fmt.Fprintf(w, "[CONFIG] Webhook File: %s\n", cfg.WebhookFile)
+	fmt.Fprintf(w, "[CONFIG] Archive: %s (max %d MB, %d days, %d backups, compress: %v, fsync: %s every %v)\n", cfg.Archive.Path, cfg.Archive.MaxSizeMB, cfg.Archive.MaxAgeDays, cfg.Archive.MaxBackups, cfg.Archive.Compress, cfg.Archive.Fsync, cfg.Archive.FsyncInterval)
+	fmt.Fprintf(w, "[CONFIG] Auto-create Transactions: %v (envs: %d, subscribers: %d)\n", cfg.AutoCreateTransactions, len(cfg.AutoCreateEnvs), len(cfg.AutoCreateSubscribers))
+	fmt.Fprintf(w, "[CONFIG] Parking: %v (TTL: %v, max events: %d, retry: %v-%v)\n", cfg.ParkingEnabled, cfg.ParkingTTL, cfg.ParkingMaxEvents, cfg.ParkingRetryMin, cfg.ParkingRetryMax)
+	fmt.Fprintf(w, "[CONFIG] Request Limits: gRPC payload %d bytes (transport %d), HTTP body %d bytes, JSON depth %d, JSON array length %d\n", cfg.GRPCMaxRecvBytes, cfg.GRPCMaxMsgBytes, cfg.HTTPMaxBodyBytes, cfg.JSONLimits.MaxDepth, cfg.JSONLimits.MaxArrayLen)
+	fmt.Fprintf(w, "[CONFIG] Rate Limits: subscriber %v/s (burst %d), transaction %v/s (burst %d), file: %s\n", cfg.RateLimitSubscriber.RPS, cfg.RateLimitSubscriber.Burst, cfg.RateLimitTransaction.RPS, cfg.RateLimitTransaction.Burst, cfg.RateLimitFile)
+	fmt.Fprintf(w, "[CONFIG] Load Shedding: max in-flight %d, %d above %v Redis latency\n", cfg.MaxInFlight, cfg.ShedMaxInFlight, cfg.ShedRedisLatency)
+	fmt.Fprintf(w, "[CONFIG] gRPC TLS: %v (mTLS: %v, tokens: %d, allowed clients: %d)\n", cfg.GRPCTLSCert != "", cfg.GRPCTLSClientCA != "", len(cfg.GRPCAuthTokens), len(cfg.GRPCAllowedClients))
+	fmt.Fprintf(w, "[CONFIG] HTTP Auth Routes: %v (API keys: %d, HMAC: %v, JWKS: %s)\n", cfg.HTTPAuthRoutes, len(cfg.HTTPAPIKeys), cfg.HTTPHMACSecret != "", cfg.HTTPJWKSFile)
+	fmt.Fprintf(w, "[CONFIG] Mock Traffic: skip NO=%v, skip DB=%v, DB session type=%q\n", cfg.MockSkipNO, cfg.MockSkipDB, cfg.MockDBSessionType)
+	fmt.Fprintf(w, "[CONFIG] Configuration loaded successfully\n")
 	// Matches TS: POST `${DATA_BASE_URL}/api/sessions/payload`
 	cfg.DBPayloadPath = "/api/sessions/payload"
 
 	return cfg, nil
 }
 
+// GRPCAuthEnabled reports whether gRPC callers must present a token or allowlisted client cert.
+// defaultGRPCMaxMsgBytes is the transport cap used when RECORDER_GRPC_MAX_MSG_BYTES is unset:
+// twice the payload limit, or no cap at all when payloads are unlimited, so gRPC's own 4 MiB
+// default does not quietly apply.
+func defaultGRPCMaxMsgBytes(maxRecvBytes int) int {
+	if maxRecvBytes <= 0 || maxRecvBytes > math.MaxInt32/2 {
+		return math.MaxInt32
+	}
+	return 2 * maxRecvBytes
+}
+
+func (c config) GRPCAuthEnabled() bool {
+	return len(c.GRPCAuthTokens) > 0 || len(c.GRPCAllowedClients) > 0
+}
+
+// AutoCreateAllowed reports whether a missing transaction for subscriberURL may be created.
+func (c config) AutoCreateAllowed(subscriberURL string) bool {
+	if !c.AutoCreateTransactions {
+		return false
+	}
+	if len(c.AutoCreateEnvs) > 0 && !c.AutoCreateEnvs[c.Env] {
+		return false
+	}
+	if len(c.AutoCreateSubscribers) > 0 && !c.AutoCreateSubscribers[strings.TrimRight(strings.TrimSpace(subscriberURL), "/")] {
+		return false
+	}
+	return true
+}
+
+// parseAuthRoutes parses "/html-form=hmac|jwt,/metrics=apikey" into route -> auth methods.
+func parseAuthRoutes(s string) map[string][]string {
+	out := map[string][]string{}
+	for _, part := range strings.Split(s, ",") {
+		route, methods, ok := strings.Cut(strings.TrimSpace(part), "=")
+		route = strings.TrimSpace(route)
+		if !ok || route == "" {
+			continue
+		}
+		for _, m := range strings.Split(methods, "|") {
+			if m = strings.ToLower(strings.TrimSpace(m)); m != "" {
+				out[route] = append(out[route], m)
+			}
+		}
+	}
+	return out
+}
+
+// parseAPIKeys parses "name:key,name2:key2" (API keys or bearer tokens); a key without a name
+// is named "apikey".
+func parseAPIKeys(s string) map[string]string {
+	out := map[string]string{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, key, ok := strings.Cut(part, ":")
+		if !ok {
+			name, key = "apikey", part
+		}
+		if key = strings.TrimSpace(key); key != "" {
+			out[key] = strings.TrimSpace(name)
+		}
+	}
+	return out
+}
+
 func newRedisClient(addr string) *redis.Client {
 	password := os.Getenv("REDIS_PASSWORD")
 	username := os.Getenv("REDIS_USERNAME")
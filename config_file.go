@@ -0,0 +1,376 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+type settingKind int
+
+const (
+	kindString settingKind = iota
+	kindBool
+	kindSize  // non-negative integer
+	kindFloat // non-negative number
+	kindAddr  // host:port
+	kindURL   // absolute http(s) URL
+)
+
+// setting describes one configuration variable: how it is validated, its default, whether
+// its value must be masked, and how --print-config renders it from a loaded config. Value is
+// nil for the Redis credentials, which the config does not keep; they are printed as set.
+type setting struct {
+	Name    string
+	Kind    settingKind
+	Default string
+	// Derived marks a Default that describes how the value is computed from other
+	// settings rather than being the literal value.
+	Derived bool
+	OneOf   []string
+	Secret  bool
+	Value   func(c config) string
+}
+
+// settings lists every variable the recorder reads. Config files may only set these, and
+// unknown RECORDER_* environment variables are rejected.
+var settings = []setting{
+	{Name: "RECORDER_CONFIG_FILE", Value: func(c config) string { return c.ConfigFile }},
+	{Name: "RECORDER_CONFIG_WATCH_INTERVAL_MS", Kind: kindSize, Default: "2000", Value: func(c config) string { return showMillis(c.ConfigWatchInterval) }},
+	{Name: "RECORDER_LISTEN_ADDR", Kind: kindAddr, Default: ":8089", Value: func(c config) string { return c.ListenAddr }},
+	{Name: "RECORDER_HTTP_LISTEN_ADDR", Kind: kindAddr, Default: ":8090", Value: func(c config) string { return c.HTTPListenAddr }},
+	{Name: "REDIS_ADDR", Kind: kindAddr, Default: "127.0.0.1:6379", Value: func(c config) string { return c.RedisAddr }},
+	{Name: "REDIS_HOST", Kind: kindAddr, Value: func(c config) string { return "" }},
+	{Name: "REDIS_USERNAME"},
+	{Name: "REDIS_PASSWORD", Secret: true},
+	{Name: "RECORDER_ENV", Default: "dev", Value: func(c config) string { return c.Env }},
+
+	{Name: "RECORDER_SKIP_CACHE_UPDATE", Kind: kindBool, Default: "false", Value: func(c config) string { return strconv.FormatBool(c.SkipCacheUpdate) }},
+	{Name: "RECORDER_SKIP_NO_PUSH", Kind: kindBool, Default: "false", Value: func(c config) string { return strconv.FormatBool(c.SkipNOPush) }},
+	{Name: "RECORDER_SKIP_DB_SAVE", Kind: kindBool, Default: "false", Value: func(c config) string { return strconv.FormatBool(c.SkipDBSave) }},
+	{Name: "RECORDER_DEDUPE_EVENTS", Kind: kindBool, Default: "true", Value: func(c config) string { return strconv.FormatBool(c.DedupeEvents) }},
+	{Name: "RECORDER_DEDUPE_MARKER_TTL_SECONDS", Kind: kindSize, Default: "600", Value: func(c config) string { return showSeconds(c.DedupeMarkerTTL) }},
+	{Name: "RECORDER_APILIST_ORDERING", Default: "arrival", OneOf: []string{"arrival", "timestamp"}, Value: func(c config) string { return c.APIListOrdering }},
+	{Name: "RECORDER_CONTEXT_CHECK_MODE", Default: contextCheckOff, OneOf: []string{contextCheckOff, contextCheckWarn, contextCheckAnnotate, contextCheckReject}, Value: func(c config) string { return c.ContextCheckMode }},
+	{Name: "RECORDER_SCHEMA_VALIDATION", Default: schemaValidationOff, OneOf: []string{schemaValidationOff, schemaValidationSync, schemaValidationAsync}, Value: func(c config) string { return c.SchemaValidationMode }},
+	{Name: "RECORDER_SCHEMA_DIR", Value: func(c config) string { return c.SchemaDir }},
+	{Name: "RECORDER_FLOWS_FILE", Value: func(c config) string { return c.FlowsFile }},
+	{Name: "RECORDER_FLOW_STATUS_RULES_FILE", Value: func(c config) string { return c.FlowStatusRulesFile }},
+	{Name: "RECORDER_CALLBACK_TTL_TRACKING", Kind: kindBool, Default: "false", Value: func(c config) string { return strconv.FormatBool(c.CallbackTTLTracking) }},
+	{Name: "RECORDER_CALLBACK_SWEEP_INTERVAL_SECONDS", Kind: kindSize, Default: "10", Value: func(c config) string { return showSeconds(c.CallbackSweepInterval) }},
+
+	{Name: "RECORDER_ASYNC_QUEUE_SIZE", Kind: kindSize, Default: "1000", Value: func(c config) string { return strconv.Itoa(c.AsyncQueueSize) }},
+	{Name: "RECORDER_ASYNC_WORKERS", Kind: kindSize, Default: "2", Value: func(c config) string { return strconv.Itoa(c.AsyncWorkerCount) }},
+	{Name: "RECORDER_ASYNC_DROP_ON_FULL", Kind: kindBool, Default: "true", Value: func(c config) string { return strconv.FormatBool(c.DropOnQueueFull) }},
+	{Name: "RECORDER_ASYNC_PAUSE_BACKLOG", Kind: kindSize, Default: "10000", Value: func(c config) string { return strconv.Itoa(c.AsyncPauseBacklog) }},
+
+	{Name: "RECORDER_API_TTL_SECONDS_DEFAULT", Kind: kindSize, Default: "30000", Value: func(c config) string { return strconv.FormatInt(c.APITTLSecondsDefault, 10) }},
+	{Name: "RECORDER_CACHE_TTL_SECONDS_DEFAULT", Kind: kindSize, Default: "0", Value: func(c config) string { return strconv.FormatInt(c.CacheTTLSecondsDefault, 10) }},
+
+	{Name: "RECORDER_NO_URL", Kind: kindURL, Value: func(c config) string { return c.NOURL }},
+	{Name: "RECORDER_NO_BEARER_TOKEN", Secret: true, Value: func(c config) string { return c.NOToken }},
+	{Name: "RECORDER_NO_TIMEOUT_MS", Kind: kindSize, Default: "5000", Value: func(c config) string { return showMillis(c.NOTimeout) }},
+	{Name: "RECORDER_NO_ENABLED_ENVS", Value: func(c config) string { return showSet(c.NOEnabledIn) }},
+	{Name: "RECORDER_DB_BASE_URL", Kind: kindURL, Value: func(c config) string { return c.DBBaseURL }},
+	{Name: "RECORDER_DB_API_KEY", Secret: true, Value: func(c config) string { return c.DBAPIKey }},
+	{Name: "RECORDER_DB_TIMEOUT_MS", Kind: kindSize, Default: "5000", Value: func(c config) string { return showMillis(c.DBTimeout) }},
+	{Name: "RECORDER_DB_ENABLED_ENVS", Value: func(c config) string { return showSet(c.DBEnabledIn) }},
+	{Name: "RECORDER_DB_SESSION_CACHE_SIZE", Kind: kindSize, Default: "10000", Value: func(c config) string { return strconv.Itoa(c.DBSessionCacheSize) }},
+	{Name: "RECORDER_DB_SESSION_CACHE_REDIS", Kind: kindBool, Default: "false", Value: func(c config) string { return strconv.FormatBool(c.DBSessionCacheRedis) }},
+	{Name: "RECORDER_DB_SESSION_CACHE_TTL_SECONDS", Kind: kindSize, Default: "86400", Value: func(c config) string { return showSeconds(c.DBSessionCacheTTL) }},
+
+	{Name: "RECORDER_SINKS", Default: "no,db", Value: func(c config) string { return strings.Join(c.Sinks, ",") }},
+	{Name: "RECORDER_ARCHIVE_PATH", Value: func(c config) string { return c.Archive.Path }},
+	{Name: "RECORDER_ARCHIVE_MAX_SIZE_MB", Kind: kindSize, Default: "100", Value: func(c config) string { return strconv.Itoa(c.Archive.MaxSizeMB) }},
+	{Name: "RECORDER_ARCHIVE_MAX_AGE_DAYS", Kind: kindSize, Default: "0", Value: func(c config) string { return strconv.Itoa(c.Archive.MaxAgeDays) }},
+	{Name: "RECORDER_ARCHIVE_MAX_BACKUPS", Kind: kindSize, Default: "0", Value: func(c config) string { return strconv.Itoa(c.Archive.MaxBackups) }},
+	{Name: "RECORDER_ARCHIVE_COMPRESS", Kind: kindBool, Default: "true", Value: func(c config) string { return strconv.FormatBool(c.Archive.Compress) }},
+	{Name: "RECORDER_ARCHIVE_FSYNC", Default: archiveFsyncInterval, OneOf: []string{archiveFsyncAlways, archiveFsyncInterval, archiveFsyncNever}, Value: func(c config) string { return c.Archive.Fsync }},
+	{Name: "RECORDER_ARCHIVE_FSYNC_INTERVAL_MS", Kind: kindSize, Default: "1000", Value: func(c config) string { return showMillis(c.Archive.FsyncInterval) }},
+	{Name: "RECORDER_WEBHOOK_FILE", Value: func(c config) string { return c.WebhookFile }},
+
+	{Name: "RECORDER_AUTO_CREATE_TRANSACTIONS", Kind: kindBool, Default: "false", Value: func(c config) string { return strconv.FormatBool(c.AutoCreateTransactions) }},
+	{Name: "RECORDER_AUTO_CREATE_ENVS", Value: func(c config) string { return showSet(c.AutoCreateEnvs) }},
+	{Name: "RECORDER_AUTO_CREATE_SUBSCRIBERS", Value: func(c config) string { return showSet(c.AutoCreateSubscribers) }},
+
+	{Name: "RECORDER_PARKING_ENABLED", Kind: kindBool, Default: "false", Value: func(c config) string { return strconv.FormatBool(c.ParkingEnabled) }},
+	{Name: "RECORDER_PARKING_TTL_MS", Kind: kindSize, Default: "5000", Value: func(c config) string { return showMillis(c.ParkingTTL) }},
+	{Name: "RECORDER_PARKING_MAX_EVENTS", Kind: kindSize, Default: "1000", Value: func(c config) string { return strconv.Itoa(c.ParkingMaxEvents) }},
+	{Name: "RECORDER_PARKING_RETRY_MIN_MS", Kind: kindSize, Default: "50", Value: func(c config) string { return showMillis(c.ParkingRetryMin) }},
+	{Name: "RECORDER_PARKING_RETRY_MAX_MS", Kind: kindSize, Default: "1000", Value: func(c config) string { return showMillis(c.ParkingRetryMax) }},
+
+	{Name: "RECORDER_GRPC_MAX_RECV_BYTES", Kind: kindSize, Default: "4194304", Value: func(c config) string { return strconv.Itoa(c.GRPCMaxRecvBytes) }},
+	{Name: "RECORDER_GRPC_MAX_MSG_BYTES", Kind: kindSize, Default: "2× RECORDER_GRPC_MAX_RECV_BYTES (2147483647 when that is 0)", Derived: true, Value: func(c config) string { return strconv.Itoa(c.GRPCMaxMsgBytes) }},
+	{Name: "RECORDER_HTTP_MAX_BODY_BYTES", Kind: kindSize, Default: "10485760", Value: func(c config) string { return strconv.FormatInt(c.HTTPMaxBodyBytes, 10) }},
+	{Name: "RECORDER_JSON_MAX_DEPTH", Kind: kindSize, Default: "64", Value: func(c config) string { return strconv.Itoa(c.JSONLimits.MaxDepth) }},
+	{Name: "RECORDER_JSON_MAX_ARRAY_LEN", Kind: kindSize, Default: "10000", Value: func(c config) string { return strconv.Itoa(c.JSONLimits.MaxArrayLen) }},
+
+	{Name: "RECORDER_RATE_LIMIT_SUBSCRIBER_RPS", Kind: kindFloat, Default: "0", Value: func(c config) string { return showFloat(c.RateLimitSubscriber.RPS) }},
+	{Name: "RECORDER_RATE_LIMIT_SUBSCRIBER_BURST", Kind: kindSize, Default: "0", Value: func(c config) string { return strconv.Itoa(c.RateLimitSubscriber.Burst) }},
+	{Name: "RECORDER_RATE_LIMIT_TRANSACTION_RPS", Kind: kindFloat, Default: "0", Value: func(c config) string { return showFloat(c.RateLimitTransaction.RPS) }},
+	{Name: "RECORDER_RATE_LIMIT_TRANSACTION_BURST", Kind: kindSize, Default: "0", Value: func(c config) string { return strconv.Itoa(c.RateLimitTransaction.Burst) }},
+	{Name: "RECORDER_RATE_LIMIT_FILE", Value: func(c config) string { return c.RateLimitFile }},
+	{Name: "RECORDER_MAX_INFLIGHT", Kind: kindSize, Default: "0", Value: func(c config) string { return strconv.Itoa(c.MaxInFlight) }},
+	{Name: "RECORDER_SHED_MAX_INFLIGHT", Kind: kindSize, Default: "8", Value: func(c config) string { return strconv.Itoa(c.ShedMaxInFlight) }},
+	{Name: "RECORDER_SHED_REDIS_LATENCY_MS", Kind: kindSize, Default: "0", Value: func(c config) string { return showMillis(c.ShedRedisLatency) }},
+
+	{Name: "RECORDER_GRPC_TLS_CERT", Value: func(c config) string { return c.GRPCTLSCert }},
+	{Name: "RECORDER_GRPC_TLS_KEY", Value: func(c config) string { return c.GRPCTLSKey }},
+	{Name: "RECORDER_GRPC_TLS_CLIENT_CA", Value: func(c config) string { return c.GRPCTLSClientCA }},
+	{Name: "RECORDER_GRPC_AUTH_TOKENS", Secret: true, Value: func(c config) string { return showKeys(c.GRPCAuthTokens) }},
+	{Name: "RECORDER_GRPC_ALLOWED_CLIENTS", Value: func(c config) string { return showSet(c.GRPCAllowedClients) }},
+
+	{Name: "RECORDER_HTTP_AUTH_ROUTES", Value: func(c config) string { return showRoutes(c.HTTPAuthRoutes) }},
+	{Name: "RECORDER_HTTP_API_KEY_HEADER", Default: "X-API-Key", Value: func(c config) string { return c.HTTPAPIKeyHeader }},
+	{Name: "RECORDER_HTTP_API_KEYS", Secret: true, Value: func(c config) string { return showKeys(c.HTTPAPIKeys) }},
+	{Name: "RECORDER_HTTP_HMAC_SECRET", Secret: true, Value: func(c config) string { return c.HTTPHMACSecret }},
+	{Name: "RECORDER_HTTP_HMAC_MAX_SKEW_SECONDS", Kind: kindSize, Default: "300", Value: func(c config) string { return showSeconds(c.HTTPHMACMaxSkew) }},
+	{Name: "RECORDER_HTTP_JWKS_FILE", Value: func(c config) string { return c.HTTPJWKSFile }},
+	{Name: "RECORDER_HTTP_JWT_ISSUER", Value: func(c config) string { return c.HTTPJWTIssuer }},
+	{Name: "RECORDER_HTTP_JWT_AUDIENCE", Value: func(c config) string { return c.HTTPJWTAudience }},
+
+	{Name: "RECORDER_MOCK_SKIP_NO", Kind: kindBool, Default: "false", Value: func(c config) string { return strconv.FormatBool(c.MockSkipNO) }},
+	{Name: "RECORDER_MOCK_SKIP_DB", Kind: kindBool, Default: "false", Value: func(c config) string { return strconv.FormatBool(c.MockSkipDB) }},
+	{Name: "RECORDER_MOCK_DB_SESSION_TYPE", Value: func(c config) string { return c.MockDBSessionType }},
+}
+
+// layeredEnv holds the variables set from .env or the config file rather than the process
+// environment, so a reload can clear and re-read them.
+var layeredEnv = map[string]bool{}
+
+func setLayeredEnv(name, value string) {
+	if _, set := os.LookupEnv(name); set {
+		return
+	}
+	os.Setenv(name, value)
+	layeredEnv[name] = true
+}
+
+func resetLayeredEnv() {
+	for name := range layeredEnv {
+		os.Unsetenv(name)
+	}
+	clear(layeredEnv)
+}
+
+// loadDotEnv sets the variables in ./.env that the environment does not already set.
+func loadDotEnv() error {
+	values, err := godotenv.Read()
+	if err != nil {
+		return err
+	}
+	for name, v := range values {
+		setLayeredEnv(name, v)
+	}
+	return nil
+}
+
+func lookupSetting(name string) (setting, bool) {
+	i := slices.IndexFunc(settings, func(s setting) bool { return s.Name == name })
+	if i < 0 {
+		return setting{}, false
+	}
+	return settings[i], true
+}
+
+// loadConfigFile reads a YAML (or JSON) file mapping variable names to values and sets those
+// not already in the environment, so env vars and .env always win over the file.
+func loadConfigFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	var values map[string]any
+	if err := yaml.Unmarshal(b, &values); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	var errs []error
+	for name, v := range values {
+		if _, ok := lookupSetting(name); !ok || name == "RECORDER_CONFIG_FILE" {
+			errs = append(errs, fmt.Errorf("config file %s: %s: unknown setting", path, name))
+			continue
+		}
+		s, err := settingValue(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("config file %s: %s: %w", path, name, err))
+			continue
+		}
+		setLayeredEnv(name, s)
+	}
+	return errors.Join(errs...)
+}
+
+// settingValue renders a file value as its env form; lists become comma-separated.
+func settingValue(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string, bool, int, float64:
+		return fmt.Sprint(v), nil
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := settingValue(item)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, s)
+		}
+		return strings.Join(parts, ","), nil
+	default:
+		return "", fmt.Errorf("must be a scalar or a list, got %T", v)
+	}
+}
+
+// k8sServiceLinkEnv matches the variables Kubernetes injects for each Service in the
+// namespace, e.g. RECORDER_SERVICE_HOST or RECORDER_PORT_8089_TCP_ADDR for a Service named
+// "recorder".
+var k8sServiceLinkEnv = regexp.MustCompile(`_(SERVICE_HOST|SERVICE_PORT(_[A-Z0-9_]+)?|PORT|PORT_[0-9]+_(TCP|UDP|SCTP)(_PROTO|_PORT|_ADDR)?)$`)
+
+// validateEnv checks every set variable against its setting and rejects unknown RECORDER_*
+// variables, other than Kubernetes service links. The error names each offending variable.
+func validateEnv() error {
+	var errs []error
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, "RECORDER_") || k8sServiceLinkEnv.MatchString(name) {
+			continue
+		}
+		if _, ok := lookupSetting(name); !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown setting", name))
+		}
+	}
+	for _, s := range settings {
+		if v := strings.TrimSpace(os.Getenv(s.Name)); v != "" {
+			if err := s.validate(v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s setting) validate(v string) error {
+	switch s.Kind {
+	case kindBool:
+		switch strings.ToLower(v) {
+		case "1", "true", "yes", "y", "on", "0", "false", "no", "n", "off":
+		default:
+			return fmt.Errorf("invalid boolean %q", v)
+		}
+	case kindSize:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", v)
+		}
+		if n < 0 {
+			return fmt.Errorf("must not be negative, got %d", n)
+		}
+	case kindFloat:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", v)
+		}
+		if f < 0 {
+			return fmt.Errorf("must not be negative, got %v", f)
+		}
+	case kindAddr:
+		_, port, err := net.SplitHostPort(v)
+		if err != nil {
+			return fmt.Errorf("invalid address %q: want host:port", v)
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+			return fmt.Errorf("invalid port in address %q", v)
+		}
+	case kindURL:
+		u, err := url.Parse(v)
+		if err != nil {
+			return fmt.Errorf("invalid URL: %w", err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid URL %q: want an absolute http(s) URL", redactURL(v))
+		}
+	}
+	if len(s.OneOf) > 0 && !slices.Contains(s.OneOf, strings.ToLower(v)) {
+		return fmt.Errorf("invalid value %q: want one of %s", v, strings.Join(s.OneOf, ", "))
+	}
+	return nil
+}
+
+// printEffectiveConfig writes every setting as NAME=value as cfg resolved it, with secrets
+// masked. The output can be used as a .env file.
+func printEffectiveConfig(w io.Writer, cfg config) {
+	for _, s := range settings {
+		var v string
+		if s.Value != nil {
+			v = s.Value(cfg)
+		} else {
+			v = strings.TrimSpace(os.Getenv(s.Name))
+		}
+		switch {
+		case v == "":
+		case s.Secret:
+			v = "****"
+		case s.Kind == kindURL:
+			v = redactURL(v)
+		}
+		fmt.Fprintf(w, "%s=%s\n", s.Name, v)
+	}
+}
+
+// Renderers for setting.Value, in the units and list syntax the variables are read in.
+func showMillis(d time.Duration) string  { return strconv.FormatInt(d.Milliseconds(), 10) }
+func showSeconds(d time.Duration) string { return strconv.FormatInt(int64(d/time.Second), 10) }
+func showFloat(f float64) string         { return strconv.FormatFloat(f, 'f', -1, 64) }
+
+func showSet(m map[string]bool) string {
+	return strings.Join(slices.Sorted(maps.Keys(m)), ",")
+}
+
+// showKeys renders key -> name maps as parsed by parseAPIKeys.
+func showKeys(m map[string]string) string {
+	parts := make([]string, 0, len(m))
+	for key, name := range m {
+		parts = append(parts, name+":"+key)
+	}
+	slices.Sort(parts)
+	return strings.Join(parts, ",")
+}
+
+// showRoutes renders route -> methods as parsed by parseAuthRoutes.
+func showRoutes(m map[string][]string) string {
+	parts := make([]string, 0, len(m))
+	for route, methods := range m {
+		parts = append(parts, route+"="+strings.Join(methods, "|"))
+	}
+	slices.Sort(parts)
+	return strings.Join(parts, ",")
+}
+
+// redactURL masks the password and query values of a URL, which may carry credentials.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "****"
+	}
+	if u.RawQuery != "" {
+		keys := slices.Sorted(maps.Keys(u.Query()))
+		for i, k := range keys {
+			keys[i] = url.QueryEscape(k) + "=****"
+		}
+		u.RawQuery = strings.Join(keys, "&")
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var configReloadsTotal = newCounter("recorder_config_reloads_total", "Configuration reloads applied.")
+
+// hotReloadFields are the config fields a reload may change in place. Everything else is read
+// once at startup (listeners, Redis, workers, auth, limits) and needs a restart.
+var hotReloadFields = map[string]bool{
+	"SkipCacheUpdate":        true,
+	"SkipNOPush":             true,
+	"SkipDBSave":             true,
+	"DedupeEvents":           true,
+	"DedupeMarkerTTL":        true,
+	"APIListOrdering":        true,
+	"ContextCheckMode":       true,
+	"APITTLSecondsDefault":   true,
+	"CacheTTLSecondsDefault": true,
+	"NOURL":                  true,
+	"NOToken":                true,
+	"NOTimeout":              true,
+	"NOEnabledIn":            true,
+	"DBBaseURL":              true,
+	"DBAPIKey":               true,
+	"DBTimeout":              true,
+	"DBEnabledIn":            true,
+	"AutoCreateTransactions": true,
+	"AutoCreateEnvs":         true,
+	"AutoCreateSubscribers":  true,
+	"MockSkipNO":             true,
+	"MockSkipDB":             true,
+	"MockDBSessionType":      true,
+}
+
+// currentConfig is the config in effect; reloads swap it atomically.
+func (s *recorderServer) currentConfig() config {
+	if c := s.live.Load(); c != nil {
+		return *c
+	}
+	return s.cfg
+}
+
+// overrideFlags sets admin flag overrides on the running config. They are re-applied after
+// every reload, which would otherwise reset the flags to their configured values.
+func (s *recorderServer) overrideFlags(f adminFlags) {
+	s.liveMu.Lock()
+	defer s.liveMu.Unlock()
+	s.flagOverrides = s.flagOverrides.merge(f)
+	next := s.currentConfig()
+	f.apply(&next)
+	s.live.Store(&next)
+}
+
+// updateConfig swaps in a copy of the current config changed by fn.
+func (s *recorderServer) updateConfig(fn func(*config)) config {
+	s.liveMu.Lock()
+	defer s.liveMu.Unlock()
+	next := s.currentConfig()
+	fn(&next)
+	s.live.Store(&next)
+	return next
+}
+
+// reloadConfig re-reads .env, the config file and the environment and applies the hot-reloadable
+// changes. Only the differences are logged, not the startup [CONFIG] summary; changes to other
+// settings are logged and ignored.
+func (s *recorderServer) reloadConfig() error {
+	resetLayeredEnv()
+	next, err := readConfig(io.Discard)
+	if err != nil {
+		return err
+	}
+	s.liveMu.Lock()
+	defer s.liveMu.Unlock()
+	if kept := s.flagOverrides.apply(&next); len(kept) > 0 {
+		fmt.Printf("[CONFIG] Keeping admin flag overrides: %s\n", strings.Join(kept, ", "))
+	}
+	merged, changed, rejected := mergeReloadedConfig(s.currentConfig(), next)
+	for _, name := range rejected {
+		fmt.Printf("[CONFIG] Warning: %s changed but needs a restart; keeping the running value\n", name)
+	}
+	if len(changed) == 0 {
+		fmt.Printf("[CONFIG] Reload: no changes\n")
+		return nil
+	}
+	s.live.Store(&merged)
+	configReloadsTotal.Inc()
+	fmt.Printf("[CONFIG] Reload applied: %s\n", strings.Join(changed, "; "))
+	return nil
+}
+
+// mergeReloadedConfig returns cur with next's hot-reloadable fields, a description of each
+// applied change and the names of changed fields that need a restart.
+func mergeReloadedConfig(cur, next config) (config, []string, []string) {
+	merged := cur
+	mv, cv, nv := reflect.ValueOf(&merged).Elem(), reflect.ValueOf(cur), reflect.ValueOf(next)
+	var changed, rejected []string
+	for i := 0; i < cv.NumField(); i++ {
+		name := cv.Type().Field(i).Name
+		if reflect.DeepEqual(cv.Field(i).Interface(), nv.Field(i).Interface()) {
+			continue
+		}
+		if !hotReloadFields[name] {
+			rejected = append(rejected, name)
+			continue
+		}
+		mv.Field(i).Set(nv.Field(i))
+		changed = append(changed, fmt.Sprintf("%s: %s -> %s", name, describeConfigValue(name, cv.Field(i)), describeConfigValue(name, nv.Field(i))))
+	}
+	return merged, changed, rejected
+}
+
+func describeConfigValue(name string, v reflect.Value) string {
+	switch {
+	case name == "NOToken" || name == "DBAPIKey":
+		if v.String() == "" {
+			return `""`
+		}
+		return "****"
+	case name == "NOURL" || name == "DBBaseURL":
+		return fmt.Sprintf("%q", redactURL(v.String()))
+	case v.Kind() == reflect.Map:
+		keys := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		slices.Sort(keys)
+		return "[" + strings.Join(keys, ",") + "]"
+	case v.Kind() == reflect.String:
+		return fmt.Sprintf("%q", v.String())
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+// watchConfig reloads on SIGHUP, and when the config file's modification time changes if
+// path is set and interval > 0, until ctx is done.
+func (s *recorderServer) watchConfig(ctx context.Context, path string, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	var lastMod time.Time
+	if path != "" && interval > 0 {
+		if fi, err := os.Stat(path); err == nil {
+			lastMod = fi.ModTime()
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		var trigger string
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			trigger = "SIGHUP"
+		case <-tick:
+			fi, err := os.Stat(path)
+			if err != nil || fi.ModTime().Equal(lastMod) {
+				continue
+			}
+			lastMod = fi.ModTime()
+			trigger = path + " changed"
+		}
+		fmt.Printf("[CONFIG] Reloading configuration (%s)\n", trigger)
+		if err := s.reloadConfig(); err != nil {
+			fmt.Printf("[CONFIG] ERROR: Reload rejected, keeping the running config: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMergeReloadedConfig(t *testing.T) {
+	cur := config{ListenAddr: ":8089", SkipNOPush: false, NOToken: "old-token", NOEnabledIn: map[string]bool{"dev": true}, NOTimeout: time.Second}
+	next := cur
+	next.ListenAddr = ":9999"
+	next.SkipNOPush = true
+	next.NOToken = "new-token"
+	next.NOEnabledIn = map[string]bool{"dev": true, "prod": true}
+
+	merged, changed, rejected := mergeReloadedConfig(cur, next)
+	if !merged.SkipNOPush || merged.NOToken != "new-token" || !merged.NOEnabledIn["prod"] {
+		t.Errorf("merged = %+v, want hot fields from next", merged)
+	}
+	if merged.ListenAddr != ":8089" {
+		t.Errorf("ListenAddr = %q, want the running value", merged.ListenAddr)
+	}
+	if len(rejected) != 1 || rejected[0] != "ListenAddr" {
+		t.Errorf("rejected = %v, want [ListenAddr]", rejected)
+	}
+	log := strings.Join(changed, "; ")
+	for _, want := range []string{"SkipNOPush: false -> true", "NOToken: **** -> ****", "NOEnabledIn: [dev] -> [dev,prod]"} {
+		if !strings.Contains(log, want) {
+			t.Errorf("changes %q missing %q", log, want)
+		}
+	}
+	if strings.Contains(log, "token\"") || strings.Contains(log, "new-token") {
+		t.Errorf("changes leak the token: %q", log)
+	}
+}
+
+func TestReloadConfigFromFile(t *testing.T) {
+	unsetEnvForTest(t, "RECORDER_SKIP_NO_PUSH", "RECORDER_NO_TIMEOUT_MS", "RECORDER_HTTP_LISTEN_ADDR")
+	path := writeConfigFile(t, "recorder.yaml", "RECORDER_SKIP_NO_PUSH: false\nRECORDER_NO_TIMEOUT_MS: 5000\nRECORDER_HTTP_LISTEN_ADDR: \":8090\"\n")
+	t.Setenv("RECORDER_CONFIG_FILE", path)
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	s := &recorderServer{cfg: cfg}
+	reloads := configReloadsTotal.Value()
+
+	os.WriteFile(path, []byte("RECORDER_SKIP_NO_PUSH: true\nRECORDER_NO_TIMEOUT_MS: 250\nRECORDER_HTTP_LISTEN_ADDR: \":9090\"\n"), 0o600)
+	if err := s.reloadConfig(); err != nil {
+		t.Fatalf("reloadConfig() error = %v", err)
+	}
+	got := s.currentConfig()
+	if !got.SkipNOPush || got.NOTimeout != 250*time.Millisecond {
+		t.Errorf("SkipNOPush = %v, NOTimeout = %v; want true, 250ms", got.SkipNOPush, got.NOTimeout)
+	}
+	if got.HTTPListenAddr != ":8090" {
+		t.Errorf("HTTPListenAddr = %q, want the running :8090", got.HTTPListenAddr)
+	}
+	if d := configReloadsTotal.Value() - reloads; d != 1 {
+		t.Errorf("reloads delta = %d, want 1", d)
+	}
+
+	// An invalid file keeps the running config.
+	os.WriteFile(path, []byte("RECORDER_NO_TIMEOUT_MS: -1\n"), 0o600)
+	if err := s.reloadConfig(); err == nil || !strings.Contains(err.Error(), "RECORDER_NO_TIMEOUT_MS") {
+		t.Errorf("reloadConfig() error = %v, want an error naming RECORDER_NO_TIMEOUT_MS", err)
+	}
+	if s.currentConfig().NOTimeout != 250*time.Millisecond {
+		t.Error("invalid reload changed the running config")
+	}
+}
+
+func TestReloadConfigKeepsAdminFlagOverrides(t *testing.T) {
+	unsetEnvForTest(t, "RECORDER_SKIP_NO_PUSH", "RECORDER_SKIP_DB_SAVE", "RECORDER_NO_TIMEOUT_MS")
+	path := writeConfigFile(t, "recorder.yaml", "RECORDER_SKIP_NO_PUSH: false\nRECORDER_SKIP_DB_SAVE: false\n")
+	t.Setenv("RECORDER_CONFIG_FILE", path)
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	s := &recorderServer{cfg: cfg}
+	on := true
+	s.overrideFlags(adminFlags{SkipNOPush: &on})
+
+	os.WriteFile(path, []byte("RECORDER_SKIP_NO_PUSH: false\nRECORDER_SKIP_DB_SAVE: true\nRECORDER_NO_TIMEOUT_MS: 250\n"), 0o600)
+	if err := s.reloadConfig(); err != nil {
+		t.Fatalf("reloadConfig() error = %v", err)
+	}
+	got := s.currentConfig()
+	if !got.SkipNOPush || !got.SkipDBSave || got.NOTimeout != 250*time.Millisecond {
+		t.Errorf("after reload SkipNOPush = %v, SkipDBSave = %v, NOTimeout = %v; want true, true, 250ms", got.SkipNOPush, got.SkipDBSave, got.NOTimeout)
+	}
+}
+
+func TestWatchConfigReloadsOnFileChange(t *testing.T) {
+	unsetEnvForTest(t, "RECORDER_SKIP_DB_SAVE")
+	path := writeConfigFile(t, "recorder.yaml", "RECORDER_SKIP_DB_SAVE: false\n")
+	t.Setenv("RECORDER_CONFIG_FILE", path)
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	s := &recorderServer{cfg: cfg}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.watchConfig(ctx, path, 10*time.Millisecond)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	time.Sleep(30 * time.Millisecond)
+	os.WriteFile(path, []byte("RECORDER_SKIP_DB_SAVE: true\n"), 0o600)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(path, future, future)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !s.currentConfig().SkipDBSave {
+		if time.Now().After(deadline) {
+			t.Fatal("config was not reloaded after the file changed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"math"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -189,7 +191,7 @@ func TestLoadConfigAsyncSettings(t *testing.T) {
 	}
 
 	// Test minimum worker count
-	os.Setenv("RECORDER_ASYNC_WORKERS", "-1")
+	os.Setenv("RECORDER_ASYNC_WORKERS", "0")
 	cfg, err = loadConfig()
 	if err != nil {
 		t.Fatalf("loadConfig() error = %v", err)
@@ -197,4 +199,73 @@ func TestLoadConfigAsyncSettings(t *testing.T) {
 	if cfg.AsyncWorkerCount < 1 {
 		t.Errorf("AsyncWorkerCount = %v, should be at least 1", cfg.AsyncWorkerCount)
 	}
+
+	// Negative sizes are rejected
+	os.Setenv("RECORDER_ASYNC_WORKERS", "-1")
+	if _, err = loadConfig(); err == nil || !strings.Contains(err.Error(), "RECORDER_ASYNC_WORKERS") {
+		t.Errorf("loadConfig() error = %v, want an error naming RECORDER_ASYNC_WORKERS", err)
+	}
+}
+
+func TestLoadConfigGRPCMessageCap(t *testing.T) {
+	t.Setenv("RECORDER_GRPC_MAX_RECV_BYTES", "1000")
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if cfg.GRPCMaxMsgBytes != 2000 {
+		t.Errorf("GRPCMaxMsgBytes = %d, want twice the payload limit", cfg.GRPCMaxMsgBytes)
+	}
+
+	// Without a payload limit the transport cap is lifted too, unless set explicitly.
+	t.Setenv("RECORDER_GRPC_MAX_RECV_BYTES", "0")
+	if cfg, _ = loadConfig(); cfg.GRPCMaxMsgBytes != math.MaxInt32 {
+		t.Errorf("GRPCMaxMsgBytes = %d, want %d (no cap)", cfg.GRPCMaxMsgBytes, math.MaxInt32)
+	}
+	t.Setenv("RECORDER_GRPC_MAX_MSG_BYTES", "0")
+	if cfg, _ = loadConfig(); cfg.GRPCMaxMsgBytes != 0 {
+		t.Errorf("GRPCMaxMsgBytes = %d, want 0 (gRPC default)", cfg.GRPCMaxMsgBytes)
+	}
+
+	t.Setenv("RECORDER_GRPC_MAX_MSG_BYTES", "5000")
+	if cfg, _ = loadConfig(); cfg.GRPCMaxMsgBytes != 5000 {
+		t.Errorf("GRPCMaxMsgBytes = %d, want 5000", cfg.GRPCMaxMsgBytes)
+	}
+}
+
+func TestConfigAutoCreateAllowed(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config
+		url  string
+		want bool
+	}{
+		{"disabled", config{Env: "dev"}, "https://s", false},
+		{"enabled everywhere", config{Env: "dev", AutoCreateTransactions: true}, "https://s", true},
+		{"env not listed", config{Env: "prod", AutoCreateTransactions: true, AutoCreateEnvs: map[string]bool{"dev": true}}, "https://s", false},
+		{"env listed", config{Env: "dev", AutoCreateTransactions: true, AutoCreateEnvs: map[string]bool{"dev": true}}, "https://s", true},
+		{"subscriber listed", config{Env: "dev", AutoCreateTransactions: true, AutoCreateSubscribers: map[string]bool{"https://s": true}}, "https://s/", true},
+		{"subscriber not listed", config{Env: "dev", AutoCreateTransactions: true, AutoCreateSubscribers: map[string]bool{"https://s": true}}, "https://other", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.AutoCreateAllowed(tt.url); got != tt.want {
+				t.Errorf("AutoCreateAllowed(%q) = %v, want %v", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAuthRoutes(t *testing.T) {
+	got := parseAuthRoutes(" /html-form = HMAC|jwt , /metrics=apikey,bogus")
+	if len(got) != 2 || len(got["/html-form"]) != 2 || got["/html-form"][0] != "hmac" || got["/html-form"][1] != "jwt" || got["/metrics"][0] != "apikey" {
+		t.Errorf("parseAuthRoutes() = %v", got)
+	}
+}
+
+func TestParseAPIKeys(t *testing.T) {
+	got := parseAPIKeys("form-service:k1, k2 ,ops:")
+	if len(got) != 2 || got["k1"] != "form-service" || got["k2"] != "apikey" {
+		t.Errorf("parseAPIKeys() = %v", got)
+	}
 }
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Context check modes (RECORDER_CONTEXT_CHECK_MODE).
+const (
+	contextCheckOff      = "off"
+	contextCheckWarn     = "warn"
+	contextCheckAnnotate = "annotate"
+	contextCheckReject   = "reject"
+)
+
+// contextMismatch is one disagreement between additionalData and requestBody.context.
+// In annotate mode the list is stored on the apiList entry as contextMismatches.
+type contextMismatch struct {
+	Field          string `json:"field"`
+	AdditionalData string `json:"additionalData"`
+	Context        string `json:"context"`
+}
+
+func (m contextMismatch) String() string {
+	return fmt.Sprintf("%s: additionalData=%q context=%q", m.Field, m.AdditionalData, m.Context)
+}
+
+// checkContextConsistency compares the identifiers the plugin sent in additionalData with the
+// Beckn context of the request. A field is only compared when both sides carry a value.
+func checkContextConsistency(p auditPayload) []contextMismatch {
+	ctxObj, _ := p.RequestBody["context"].(map[string]any)
+	if ctxObj == nil {
+		return nil
+	}
+	ad := p.AdditionalData
+
+	var out []contextMismatch
+	for _, f := range []string{"transaction_id", "message_id", "action", "domain"} {
+		want := strings.TrimSpace(getString(ad, f))
+		got := strings.TrimSpace(getString(ctxObj, f))
+		if want != "" && got != "" && want != got {
+			out = append(out, contextMismatch{Field: f, AdditionalData: want, Context: got})
+		}
+	}
+
+	subscriberURL := strings.TrimSpace(getString(ad, "subscriber_url"))
+	if subscriberURL != "" && hasSubscriberFields(ctxObj) && subscriberRole(p.RequestBody, subscriberURL) == "" {
+		out = append(out, contextMismatch{
+			Field:          "subscriber_url",
+			AdditionalData: subscriberURL,
+			Context:        fmt.Sprintf("bap_id=%s bpp_id=%s", getString(ctxObj, "bap_id"), getString(ctxObj, "bpp_id")),
+		})
+	}
+	return out
+}
+
+func hasSubscriberFields(ctxObj map[string]any) bool {
+	for _, k := range []string{"bap_id", "bap_uri", "bpp_id", "bpp_uri"} {
+		if strings.TrimSpace(getString(ctxObj, k)) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// subscriberRole returns "BAP" or "BPP" when subscriberURL matches that side of the request
+// context, either by URI or by its host matching the subscriber id. It returns "" otherwise.
+func subscriberRole(requestBody map[string]any, subscriberURL string) string {
+	ctxObj, _ := requestBody["context"].(map[string]any)
+	if ctxObj == nil {
+		return ""
+	}
+	normalized := strings.TrimRight(strings.TrimSpace(subscriberURL), "/")
+	host := normalized
+	if u, err := url.Parse(normalized); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	for _, role := range []string{"bap", "bpp"} {
+		uri := strings.TrimRight(strings.TrimSpace(getString(ctxObj, role+"_uri")), "/")
+		id := strings.TrimSpace(getString(ctxObj, role+"_id"))
+		if (uri != "" && strings.EqualFold(uri, normalized)) || (id != "" && strings.EqualFold(id, host)) {
+			return strings.ToUpper(role)
+		}
+	}
+	return ""
+}
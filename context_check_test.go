@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestCheckContextConsistency(t *testing.T) {
+	beckn := map[string]any{
+		"transaction_id": "t1",
+		"message_id":     "m1",
+		"action":         "on_search",
+		"domain":         "ONDC:RET10",
+		"bap_id":         "buyer.example.com",
+		"bap_uri":        "https://buyer.example.com/beckn",
+		"bpp_id":         "seller.example.com",
+	}
+	tests := []struct {
+		name       string
+		additional map[string]any
+		wantFields []string
+	}{
+		{"consistent", map[string]any{"transaction_id": "t1", "message_id": "m1", "action": "on_search", "subscriber_url": "https://buyer.example.com/beckn/"}, nil},
+		{"subscriber matches bpp_id host", map[string]any{"transaction_id": "t1", "subscriber_url": "https://seller.example.com/api"}, nil},
+		{"missing values are not compared", map[string]any{"transaction_id": "t1"}, nil},
+		{"transaction and action differ", map[string]any{"transaction_id": "t2", "action": "search"}, []string{"transaction_id", "action"}},
+		{"domain differs", map[string]any{"domain": "ONDC:RET11"}, []string{"domain"}},
+		{"unknown subscriber", map[string]any{"subscriber_url": "https://other.example.com"}, []string{"subscriber_url"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := checkContextConsistency(auditPayload{RequestBody: map[string]any{"context": beckn}, AdditionalData: tt.additional})
+			if len(got) != len(tt.wantFields) {
+				t.Fatalf("checkContextConsistency() = %v, want fields %v", got, tt.wantFields)
+			}
+			for i, f := range tt.wantFields {
+				if got[i].Field != f {
+					t.Errorf("mismatch[%d].Field = %v, want %v", i, got[i].Field, f)
+				}
+			}
+		})
+	}
+}
+
+func TestSubscriberRole(t *testing.T) {
+	body := map[string]any{"context": map[string]any{
+		"bap_id":  "buyer.example.com",
+		"bpp_uri": "https://seller.example.com/beckn",
+	}}
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://buyer.example.com", "BAP"},
+		{"https://seller.example.com/beckn/", "BPP"},
+		{"https://nobody.example.com", ""},
+	}
+	for _, tt := range tests {
+		if got := subscriberRole(body, tt.url); got != tt.want {
+			t.Errorf("subscriberRole(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+	if got := subscriberRole(map[string]any{}, "https://buyer.example.com"); got != "" {
+		t.Errorf("subscriberRole() without context = %q, want empty", got)
+	}
+}
+
+func TestLogEventContextCheckModes(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	key := createTransactionKey("t1", "https://s")
+
+	payload := map[string]any{
+		"requestBody":  map[string]any{"context": map[string]any{"transaction_id": "t1", "action": "search"}},
+		"responseBody": map[string]any{},
+		"additionalData": map[string]any{
+			"transaction_id": "t1",
+			"subscriber_url": "https://s",
+			"action":         "on_search",
+		},
+	}
+	b, _ := json.Marshal(payload)
+
+	for _, mode := range []string{contextCheckReject, contextCheckAnnotate} {
+		t.Run(mode, func(t *testing.T) {
+			mr.Set(key, `{"apiList":[]}`)
+			s := &recorderServer{rdb: rdb, cfg: config{SkipNOPush: true, SkipDBSave: true, ContextCheckMode: mode}, httpClient: http.DefaultClient}
+			_, err := s.LogEvent(ctx, wrapperspb.Bytes(b))
+
+			if mode == contextCheckReject {
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("LogEvent() code = %v, want InvalidArgument", status.Code(err))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LogEvent() error = %v", err)
+			}
+			txn, _ := loadTransactionMap(ctx, rdb, key)
+			entry := txn["apiList"].([]any)[0].(map[string]any)
+			mismatches, _ := entry["contextMismatches"].([]any)
+			if len(mismatches) != 1 || mismatches[0].(map[string]any)["field"] != "action" {
+				t.Errorf("contextMismatches = %#v, want one action mismatch", entry["contextMismatches"])
+			}
+		})
+	}
+}
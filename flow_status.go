@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultFlowStatusTTL   = 5 * time.Hour
+	flowStatusHistoryLimit = 50
+)
+
+var flowStatusIllegalTotal = newCounter("recorder_flow_status_illegal_transitions_total", "Flow status transitions rejected by the transition rules.")
+
+// flowStatusEvent is what a recorded event contributes to flow status rule matching.
+type flowStatusEvent struct {
+	EntryType string // API or FORM
+	Action    string
+	FormID    string
+	AckStatus string
+	FormError bool
+}
+
+// flowStatusRule sets Status for events matching every non-empty field. Action and FormID
+// accept "a|b" alternatives.
+type flowStatusRule struct {
+	EntryType string `json:"entryType,omitempty"`
+	Action    string `json:"action,omitempty"`
+	FormID    string `json:"formId,omitempty"`
+	AckStatus string `json:"ackStatus,omitempty"`
+	FormError *bool  `json:"formError,omitempty"`
+	Status    string `json:"status"`
+}
+
+func (r flowStatusRule) matches(ev flowStatusEvent) bool {
+	if r.EntryType != "" && !strings.EqualFold(r.EntryType, ev.EntryType) {
+		return false
+	}
+	if r.Action != "" && !slices.Contains(strings.Split(r.Action, "|"), ev.Action) {
+		return false
+	}
+	if r.FormID != "" && !slices.Contains(strings.Split(r.FormID, "|"), ev.FormID) {
+		return false
+	}
+	if r.AckStatus != "" && !strings.EqualFold(r.AckStatus, ev.AckStatus) {
+		return false
+	}
+	if r.FormError != nil && *r.FormError != ev.FormError {
+		return false
+	}
+	return true
+}
+
+// flowStatusMachine decides the FLOW_STATUS written for each event. The first matching rule
+// wins; Transitions lists the statuses reachable from a status ("*" for any), and a status
+// without an entry may move anywhere. TTLSeconds is per status, defaulting to 5 hours.
+type flowStatusMachine struct {
+	Rules       []flowStatusRule    `json:"rules"`
+	Transitions map[string][]string `json:"transitions"`
+	TTLSeconds  map[string]int64    `json:"ttlSeconds"`
+}
+
+// defaultFlowStatusMachine mirrors the original behavior: every API or FORM event marks the
+// flow AVAILABLE for 5 hours.
+func defaultFlowStatusMachine() *flowStatusMachine {
+	return &flowStatusMachine{Rules: []flowStatusRule{{Status: "AVAILABLE"}}}
+}
+
+func loadFlowStatusMachine(path string) (*flowStatusMachine, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m flowStatusMachine
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("parse flow status rules %s: %w", path, err)
+	}
+	for i, r := range m.Rules {
+		if strings.TrimSpace(r.Status) == "" {
+			return nil, fmt.Errorf("flow status rule %d: status is required", i)
+		}
+	}
+	return &m, nil
+}
+
+// next returns the status for ev, or false when no rule matches.
+func (m *flowStatusMachine) next(ev flowStatusEvent) (string, bool) {
+	for _, r := range m.Rules {
+		if r.matches(ev) {
+			return r.Status, true
+		}
+	}
+	return "", false
+}
+
+func (m *flowStatusMachine) allowed(from, to string) bool {
+	if from == "" || from == to {
+		return true
+	}
+	targets, ok := m.Transitions[from]
+	if !ok {
+		return true
+	}
+	return slices.Contains(targets, to) || slices.Contains(targets, "*")
+}
+
+func (m *flowStatusMachine) ttl(status string) time.Duration {
+	if secs, ok := m.TTLSeconds[status]; ok && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	return defaultFlowStatusTTL
+}
+
+// applyFlowStatus moves the transaction's FLOW_STATUS (and, for API events, the action's
+// EXTRA_FLOW_STATUS) to the status the rules pick for ev. Like the TS service, status keys
+// are only updated if they already exist.
+func applyFlowStatus(ctx context.Context, rdb *redis.Client, m *flowStatusMachine, transactionID, subscriberURL string, ev flowStatusEvent) error {
+	if m == nil {
+		m = defaultFlowStatusMachine()
+	}
+	to, ok := m.next(ev)
+	if !ok {
+		return nil
+	}
+	trigger := ev.EntryType + ":" + ev.Action
+	if ev.EntryType == "FORM" {
+		trigger = ev.EntryType + ":" + ev.FormID
+	}
+	if err := transitionFlowStatus(ctx, rdb, m, createFlowStatusCacheKey(transactionID, subscriberURL), to, trigger); err != nil {
+		return err
+	}
+	if ev.EntryType == "API" {
+		return transitionFlowStatus(ctx, rdb, m, createExtraFlowStatusCacheKey(transactionID, subscriberURL, ev.Action), to, trigger)
+	}
+	return nil
+}
+
+// transitionFlowStatus sets the status stored at key to `to`, appending status changes to the
+// value's history and refreshing the TTL. Illegal transitions are logged and skipped.
+func transitionFlowStatus(ctx context.Context, rdb *redis.Client, m *flowStatusMachine, key, to, trigger string) error {
+	if rdb == nil || key == "" {
+		return nil
+	}
+	const maxAttempts = 8
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		err := rdb.Watch(ctx, func(tx *redis.Tx) error {
+			val, err := tx.Get(ctx, key).Result()
+			if errors.Is(err, redis.Nil) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			var current map[string]any
+			if json.Unmarshal([]byte(val), &current) != nil || current == nil {
+				current = map[string]any{}
+			}
+			from, _ := current["status"].(string)
+			if !m.allowed(from, to) {
+				flowStatusIllegalTotal.Inc()
+				fmt.Printf("[FLOW] Illegal flow status transition %s -> %s for %s (trigger: %s); skipped\n", from, to, key, trigger)
+				return nil
+			}
+
+			now := tsISOStringNow()
+			if from != to {
+				history, _ := current["history"].([]any)
+				history = append(history, map[string]any{"from": from, "to": to, "at": now, "trigger": trigger})
+				if len(history) > flowStatusHistoryLimit {
+					history = history[len(history)-flowStatusHistoryLimit:]
+				}
+				current["history"] = history
+			}
+			current["status"] = to
+			current["updatedAt"] = now
+
+			b, err := json.Marshal(current)
+			if err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, key, string(b), m.ttl(to))
+				return nil
+			})
+			return err
+		}, key)
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		return err
+	}
+	return errAborted
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const testFlowStatusRules = `{
+	"rules": [
+		{"entryType": "API", "ackStatus": "NACK", "status": "ERROR"},
+		{"entryType": "FORM", "formError": true, "status": "ERROR"},
+		{"entryType": "API", "action": "on_confirm|on_cancel", "status": "COMPLETE"},
+		{"status": "AVAILABLE"}
+	],
+	"transitions": {"COMPLETE": [], "ERROR": ["*"]},
+	"ttlSeconds": {"COMPLETE": 60}
+}`
+
+func loadTestFlowStatusMachine(t *testing.T) *flowStatusMachine {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(path, []byte(testFlowStatusRules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := loadFlowStatusMachine(path)
+	if err != nil {
+		t.Fatalf("loadFlowStatusMachine() error = %v", err)
+	}
+	return m
+}
+
+func TestFlowStatusMachineNext(t *testing.T) {
+	m := loadTestFlowStatusMachine(t)
+	tests := []struct {
+		name string
+		ev   flowStatusEvent
+		want string
+	}{
+		{"nack", flowStatusEvent{EntryType: "API", Action: "on_confirm", AckStatus: "NACK"}, "ERROR"},
+		{"form error", flowStatusEvent{EntryType: "FORM", FormID: "f1", FormError: true}, "ERROR"},
+		{"completing action", flowStatusEvent{EntryType: "API", Action: "on_cancel", AckStatus: "ACK"}, "COMPLETE"},
+		{"fallback", flowStatusEvent{EntryType: "FORM", FormID: "f1"}, "AVAILABLE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := m.next(tt.ev); got != tt.want {
+				t.Errorf("next() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyFlowStatusTransitions(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	m := loadTestFlowStatusMachine(t)
+	key := createFlowStatusCacheKey("t1", "https://s")
+	mr.Set(key, `{"status":"WAITING"}`)
+	illegal := flowStatusIllegalTotal.Value()
+
+	steps := []flowStatusEvent{
+		{EntryType: "API", Action: "search"},
+		{EntryType: "API", Action: "select"},
+		{EntryType: "API", Action: "on_confirm"},
+		{EntryType: "API", Action: "status"}, // COMPLETE is terminal
+	}
+	for _, ev := range steps {
+		if err := applyFlowStatus(ctx, rdb, m, "t1", "https://s", ev); err != nil {
+			t.Fatalf("applyFlowStatus(%s) error = %v", ev.Action, err)
+		}
+	}
+
+	var got map[string]any
+	_ = json.Unmarshal([]byte(rdb.Get(ctx, key).Val()), &got)
+	if got["status"] != "COMPLETE" {
+		t.Errorf("status = %v, want COMPLETE", got["status"])
+	}
+	history, _ := got["history"].([]any)
+	if len(history) != 2 {
+		t.Fatalf("history = %#v, want WAITING->AVAILABLE and AVAILABLE->COMPLETE", history)
+	}
+	if h := history[1].(map[string]any); h["from"] != "AVAILABLE" || h["to"] != "COMPLETE" || h["trigger"] != "API:on_confirm" {
+		t.Errorf("history[1] = %#v", h)
+	}
+	if ttl := mr.TTL(key); ttl != time.Minute {
+		t.Errorf("TTL = %v, want COMPLETE's 1m", ttl)
+	}
+	if n := flowStatusIllegalTotal.Value() - illegal; n != 1 {
+		t.Errorf("illegal transitions = %d, want 1", n)
+	}
+	if mr.Exists(createExtraFlowStatusCacheKey("t1", "https://s", "search")) {
+		t.Errorf("extra flow status key must not be created")
+	}
+}
+
+func TestHTMLFormSetsFlowStatusTTL(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	mr.Set(createTransactionKey("t1", "https://s"), `{"apiList":[]}`)
+	key := createFlowStatusCacheKey("t1", "https://s")
+	mr.Set(key, `{"status":"WAITING"}`)
+
+	srv := httptest.NewServer(newHTTPMux(rdb))
+	defer srv.Close()
+	body := `{"transaction_id":"t1","subscriber_url":"https://s","form_action_id":"f1"}`
+	resp, err := http.Post(srv.URL+"/html-form", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+
+	if ttl := mr.TTL(key); ttl != defaultFlowStatusTTL {
+		t.Errorf("flow status TTL = %v, want %v", ttl, defaultFlowStatusTTL)
+	}
+}
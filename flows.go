@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// flowCatalog maps a flowId (as stored on the transaction) to its expected action sequence.
+// A step may list alternatives separated by "|", e.g. "on_search|on_search_inc".
+//
+// The file read by loadFlowCatalog is a JSON object of the same shape:
+//
+//	{"SEARCH_TO_CONFIRM": ["search", "on_search", "select", "on_select", "init", "on_init", "confirm", "on_confirm"]}
+type flowCatalog map[string][]string
+
+func loadFlowCatalog(path string) (flowCatalog, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string][]string
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("parse flows file %s: %w", path, err)
+	}
+	out := flowCatalog{}
+	for flowID, steps := range raw {
+		flowID = strings.TrimSpace(flowID)
+		if flowID == "" {
+			return nil, fmt.Errorf("flows file %s: empty flow id", path)
+		}
+		if len(steps) == 0 {
+			return nil, fmt.Errorf("flows file %s: flow %s has no steps", path, flowID)
+		}
+		for i, st := range steps {
+			steps[i] = strings.TrimSpace(st)
+			if steps[i] == "" {
+				return nil, fmt.Errorf("flows file %s: flow %s has an empty step at %d", path, flowID, i)
+			}
+		}
+		out[flowID] = steps
+	}
+	return out, nil
+}
+
+// flowProgress is stored on the transaction as flowProgress after every API append.
+type flowProgress struct {
+	FlowID       string   `json:"flowId"`
+	Position     int      `json:"position"`
+	TotalSteps   int      `json:"totalSteps"`
+	Completed    bool     `json:"completed"`
+	ExpectedNext []string `json:"expectedNext"`
+	// Missing are steps skipped over by a later step and not seen since.
+	Missing []string `json:"missing"`
+	// OutOfSequence are steps that arrived after a later step had already been seen.
+	OutOfSequence []string `json:"outOfSequence"`
+	Duplicated    []string `json:"duplicated"`
+	Unexpected    []string `json:"unexpected"`
+}
+
+// progress replays the API actions in apiList against the flow's steps. It returns nil when the
+// flow is not defined, so transactions of unknown flows are left untouched.
+func (c flowCatalog) progress(flowID string, apiList []any) *flowProgress {
+	steps, ok := c[strings.TrimSpace(flowID)]
+	if !ok {
+		return nil
+	}
+	fp := &flowProgress{
+		FlowID:        flowID,
+		TotalSteps:    len(steps),
+		ExpectedNext:  []string{},
+		Missing:       []string{},
+		OutOfSequence: []string{},
+		Duplicated:    []string{},
+		Unexpected:    []string{},
+	}
+
+	pos := 0
+	missing := map[int]bool{}
+	for _, it := range apiList {
+		entry, _ := it.(map[string]any)
+		if entry == nil || getString(entry, "entryType") != "API" {
+			continue
+		}
+		action := strings.TrimSpace(getString(entry, "action"))
+
+		if pos < len(steps) && flowStepMatches(steps[pos], action) {
+			pos++
+			continue
+		}
+		if idx := flowStepIndex(steps[:pos], action, missing, true); idx >= 0 {
+			delete(missing, idx)
+			fp.OutOfSequence = append(fp.OutOfSequence, action)
+			continue
+		}
+		if flowStepIndex(steps[:pos], action, missing, false) >= 0 {
+			fp.Duplicated = append(fp.Duplicated, action)
+			continue
+		}
+		if idx := flowStepIndex(steps[pos:], action, nil, false); idx >= 0 {
+			for i := pos; i < pos+idx; i++ {
+				missing[i] = true
+			}
+			pos += idx + 1
+			continue
+		}
+		fp.Unexpected = append(fp.Unexpected, action)
+	}
+
+	fp.Position = pos
+	fp.Completed = pos == len(steps) && len(missing) == 0
+	if pos < len(steps) {
+		fp.ExpectedNext = strings.Split(steps[pos], "|")
+	}
+	for i := range steps {
+		if missing[i] {
+			fp.Missing = append(fp.Missing, steps[i])
+		}
+	}
+	return fp
+}
+
+func flowStepMatches(step, action string) bool {
+	return slices.Contains(strings.Split(step, "|"), action)
+}
+
+// flowStepIndex returns the first index in steps matching action. With onlyMissing set, only
+// indexes marked in missing are considered; otherwise indexes in missing are skipped.
+func flowStepIndex(steps []string, action string, missing map[int]bool, onlyMissing bool) int {
+	for i, st := range steps {
+		if missing[i] != onlyMissing {
+			continue
+		}
+		if flowStepMatches(st, action) {
+			return i
+		}
+	}
+	return -1
+}
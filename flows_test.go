@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func apiEntries(actions ...string) []any {
+	out := make([]any, 0, len(actions))
+	for _, a := range actions {
+		out = append(out, map[string]any{"entryType": "API", "action": a})
+	}
+	return out
+}
+
+func TestFlowCatalogProgress(t *testing.T) {
+	catalog := flowCatalog{"F1": {"search", "on_search", "select", "on_select", "init|update", "on_init"}}
+
+	tests := []struct {
+		name     string
+		actions  []string
+		position int
+		next     []string
+		missing  []string
+		outOfSeq []string
+		dup      []string
+		unexp    []string
+		complete bool
+	}{
+		{"in order", []string{"search", "on_search"}, 2, []string{"select"}, nil, nil, nil, nil, false},
+		{"alternatives", []string{"search", "on_search", "select", "on_select"}, 4, []string{"init", "update"}, nil, nil, nil, nil, false},
+		{"skipped step", []string{"search", "select"}, 3, []string{"on_select"}, []string{"on_search"}, nil, nil, nil, false},
+		{"late step", []string{"search", "select", "on_search"}, 3, []string{"on_select"}, nil, []string{"on_search"}, nil, nil, false},
+		{"duplicate", []string{"search", "on_search", "on_search"}, 2, []string{"select"}, nil, nil, []string{"on_search"}, nil, false},
+		{"unexpected", []string{"search", "status"}, 1, []string{"on_search"}, nil, nil, nil, []string{"status"}, false},
+		{"complete", []string{"search", "on_search", "select", "on_select", "update", "on_init"}, 6, nil, nil, nil, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fp := catalog.progress("F1", apiEntries(tt.actions...))
+			if fp == nil {
+				t.Fatal("progress() = nil")
+			}
+			if fp.Position != tt.position || fp.Completed != tt.complete {
+				t.Errorf("position/completed = %d/%v, want %d/%v", fp.Position, fp.Completed, tt.position, tt.complete)
+			}
+			check := func(name string, got, want []string) {
+				if len(got) == 0 && len(want) == 0 {
+					return
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s = %v, want %v", name, got, want)
+				}
+			}
+			check("expectedNext", fp.ExpectedNext, tt.next)
+			check("missing", fp.Missing, tt.missing)
+			check("outOfSequence", fp.OutOfSequence, tt.outOfSeq)
+			check("duplicated", fp.Duplicated, tt.dup)
+			check("unexpected", fp.Unexpected, tt.unexp)
+		})
+	}
+
+	if fp := catalog.progress("UNKNOWN", apiEntries("search")); fp != nil {
+		t.Errorf("progress() for unknown flow = %#v, want nil", fp)
+	}
+}
+
+func TestLoadFlowCatalog(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "flows.json")
+	os.WriteFile(good, []byte(`{"F1": ["search", " on_search "]}`), 0o644)
+	catalog, err := loadFlowCatalog(good)
+	if err != nil {
+		t.Fatalf("loadFlowCatalog() error = %v", err)
+	}
+	if !reflect.DeepEqual(catalog["F1"], []string{"search", "on_search"}) {
+		t.Errorf("F1 = %v", catalog["F1"])
+	}
+
+	for name, content := range map[string]string{
+		"invalid json": `{`,
+		"empty flow":   `{"F1": []}`,
+		"empty step":   `{"F1": ["search", ""]}`,
+	} {
+		path := filepath.Join(dir, "bad.json")
+		os.WriteFile(path, []byte(content), 0o644)
+		if _, err := loadFlowCatalog(path); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestUpdateTransactionAtomicallyStoresFlowProgress(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	key := createTransactionKey("t1", "https://s")
+	mr.Set(key, `{"flowId":"F1","apiList":[{"entryType":"API","action":"search"}]}`)
+
+	in := &cacheAppendInput{PayloadID: "p1", Action: "on_search", Flows: flowCatalog{"F1": {"search", "on_search", "select"}}}
+	if err := updateTransactionAtomically(ctx, rdb, key, in, 0); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	txn, _ := loadTransactionMap(ctx, rdb, key)
+	fp, ok := txn["flowProgress"].(map[string]any)
+	if !ok {
+		t.Fatalf("flowProgress missing: %#v", txn)
+	}
+	if fp["position"].(float64) != 2 {
+		t.Errorf("position = %v, want 2", fp["position"])
+	}
+	if next := fp["expectedNext"].([]any); len(next) != 1 || next[0] != "select" {
+		t.Errorf("expectedNext = %v, want [select]", next)
+	}
+}
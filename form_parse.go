@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const formMaxMemory = 32 << 20
+
+// formStandardFields are mapped onto the FORM entry itself; other submitted fields are kept
+// under "fields".
+var formStandardFields = map[string]bool{
+	"transaction_id": true,
+	"subscriber_url": true,
+	"form_action_id": true,
+	"form_type":      true,
+	"submissionId":   true,
+	"submission_id":  true,
+	"error":          true,
+}
+
+// formFile is the metadata recorded for an uploaded file; the content itself is not stored.
+type formFile struct {
+	Field       string `json:"field"`
+	Name        string `json:"name"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"contentType,omitempty"`
+	SHA256      string `json:"sha256"`
+}
+
+// parseFormSubmission decodes a form submission posted as application/x-www-form-urlencoded,
+// multipart/form-data or (the default, matching the TS route) JSON bounded by limits.
+func parseFormSubmission(r *http.Request, limits jsonLimits) (map[string]any, []formFile, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			return nil, nil, err
+		}
+		return formValues(r.PostForm), nil, nil
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(formMaxMemory); err != nil {
+			return nil, nil, err
+		}
+		files, err := formFiles(r.MultipartForm.File)
+		if err != nil {
+			return nil, nil, err
+		}
+		return formValues(r.MultipartForm.Value), files, nil
+	default:
+		b, err := readLimitedJSON(r.Body, limits)
+		if err != nil {
+			return nil, nil, err
+		}
+		var formData map[string]any
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		if err := dec.Decode(&formData); err != nil {
+			return nil, nil, err
+		}
+		if formData == nil {
+			return nil, nil, fmt.Errorf("form data must be a JSON object")
+		}
+		return formData, nil, nil
+	}
+}
+
+// formValues flattens single-valued fields to strings and keeps repeated fields as lists. An
+// empty "error" field (HTML forms post every input) is treated as absent.
+func formValues(values url.Values) map[string]any {
+	out := make(map[string]any, len(values))
+	for k, vs := range values {
+		switch len(vs) {
+		case 0:
+		case 1:
+			out[k] = vs[0]
+		default:
+			list := make([]any, len(vs))
+			for i, v := range vs {
+				list[i] = v
+			}
+			out[k] = list
+		}
+	}
+	if v, ok := out["error"].(string); ok && strings.TrimSpace(v) == "" {
+		delete(out, "error")
+	}
+	return out
+}
+
+func formFiles(headers map[string][]*multipart.FileHeader) ([]formFile, error) {
+	var files []formFile
+	for _, field := range slices.Sorted(maps.Keys(headers)) {
+		for _, fh := range headers[field] {
+			f, err := fh.Open()
+			if err != nil {
+				return nil, err
+			}
+			h := sha256.New()
+			n, err := io.Copy(h, f)
+			f.Close()
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, formFile{
+				Field:       field,
+				Name:        fh.Filename,
+				Size:        n,
+				ContentType: fh.Header.Get("Content-Type"),
+				SHA256:      hex.EncodeToString(h.Sum(nil)),
+			})
+		}
+	}
+	return files, nil
+}
+
+// extraFormFields returns the submitted fields that are not mapped onto the FORM entry.
+func extraFormFields(formData map[string]any) map[string]any {
+	extra := map[string]any{}
+	for k, v := range formData {
+		if !formStandardFields[k] {
+			extra[k] = v
+		}
+	}
+	return extra
+}
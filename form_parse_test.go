@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func postFormAndLoadEntry(t *testing.T, contentType string, body *bytes.Buffer) map[string]any {
+	t.Helper()
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	key := createTransactionKey("t1", "https://s")
+	mr.Set(key, `{"apiList":[]}`)
+
+	srv := httptest.NewServer(newHTTPMux(rdb))
+	defer srv.Close()
+	resp, err := http.Post(srv.URL+"/html-form", contentType, body)
+	if err != nil {
+		t.Fatalf("POST request error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %v, want 200", resp.StatusCode)
+	}
+
+	txn, _ := loadTransactionMap(ctx, rdb, key)
+	apiList := txn["apiList"].([]any)
+	if len(apiList) != 1 {
+		t.Fatalf("apiList = %#v", apiList)
+	}
+	return apiList[0].(map[string]any)
+}
+
+func TestHTTPFormURLEncoded(t *testing.T) {
+	form := url.Values{
+		"transaction_id": {"t1"},
+		"subscriber_url": {"https://s"},
+		"form_action_id": {"f1"},
+		"form_type":      {"HTML_FORM"},
+		"submissionId":   {"sub-1"},
+		"error":          {""},
+		"name":           {"Asha"},
+		"items":          {"a", "b"},
+	}
+	entry := postFormAndLoadEntry(t, "application/x-www-form-urlencoded", bytes.NewBufferString(form.Encode()))
+
+	if entry["formId"] != "f1" || entry["formType"] != "HTML_FORM" || entry["submissionId"] != "sub-1" {
+		t.Errorf("entry = %#v", entry)
+	}
+	if _, ok := entry["error"]; ok {
+		t.Errorf("empty error field should be dropped: %#v", entry["error"])
+	}
+	fields, _ := entry["fields"].(map[string]any)
+	if fields["name"] != "Asha" || len(fields) != 2 {
+		t.Errorf("fields = %#v", fields)
+	}
+	if items, _ := fields["items"].([]any); len(items) != 2 {
+		t.Errorf("items = %#v", fields["items"])
+	}
+}
+
+func TestHTTPFormMultipart(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range map[string]string{"transaction_id": "t1", "subscriber_url": "https://s", "form_action_id": "f1", "pan": "ABCDE1234F"} {
+		_ = mw.WriteField(k, v)
+	}
+	content := "%PDF-1.4 test document"
+	fw, _ := mw.CreateFormFile("kyc_doc", "kyc.pdf")
+	_, _ = fw.Write([]byte(content))
+	mw.Close()
+
+	entry := postFormAndLoadEntry(t, mw.FormDataContentType(), &body)
+
+	if fields, _ := entry["fields"].(map[string]any); fields["pan"] != "ABCDE1234F" {
+		t.Errorf("fields = %#v", entry["fields"])
+	}
+	files, _ := entry["files"].([]any)
+	if len(files) != 1 {
+		t.Fatalf("files = %#v", entry["files"])
+	}
+	sum := sha256.Sum256([]byte(content))
+	f := files[0].(map[string]any)
+	if f["field"] != "kyc_doc" || f["name"] != "kyc.pdf" || f["size"] != float64(len(content)) || f["sha256"] != hex.EncodeToString(sum[:]) {
+		t.Errorf("file = %#v", f)
+	}
+	if f["contentType"] != "application/octet-stream" {
+		t.Errorf("contentType = %v", f["contentType"])
+	}
+}
+
+func TestHTTPFormMalformedMultipart(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	srv := httptest.NewServer(newHTTPMux(rdb))
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/html-form", "multipart/form-data; boundary=xyz", strings.NewReader("not multipart"))
+	if err != nil {
+		t.Fatalf("POST request error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %v, want 400", resp.StatusCode)
+	}
+}
@@ -2,18 +2,26 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/beckn-one/beckn-onix/pkg/log"
 	"github.com/redis/go-redis/v9"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 )
@@ -21,6 +29,18 @@ import (
 const (
 	grpcServiceName = "beckn.audit.v1.AuditService"
 	grpcFullMethod  = "/" + grpcServiceName + "/LogEvent"
+
+	// recorderResultHeader is sent as response metadata so callers can tell a
+	// recorded event from one that was accepted without being recorded again, or
+	// one that was parked until its transaction exists.
+	recorderResultHeader = "x-recorder-result"
+	recorderResultOK     = "recorded"
+	recorderResultDup    = "duplicate"
+	recorderResultParked = "parked"
+
+	// recorderResultFailed is never sent to callers, who get an error status instead; inline
+	// sinks record it for events that could not be recorded.
+	recorderResultFailed = "failed"
 )
 
 func recoveryUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
@@ -33,6 +53,84 @@ func recoveryUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServ
 	return handler(ctx, req)
 }
 
+// authUnaryInterceptor admits callers presenting a bearer token from tokens (token -> caller
+// name), or an mTLS client certificate whose CN or SAN is in allowedClients, and stores the
+// caller identity in the context.
+func authUnaryInterceptor(tokens map[string]string, allowedClients map[string]bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		id, err := grpcCallerIdentity(ctx, tokens, allowedClients)
+		if err != nil {
+			log.Warnf(ctx, "[GRPC] Rejected %s: %v", info.FullMethod, err)
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		return handler(withCallerIdentity(ctx, id), req)
+	}
+}
+
+func grpcCallerIdentity(ctx context.Context, tokens map[string]string, allowedClients map[string]bool) (callerIdentity, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		token, ok := strings.CutPrefix(v, "Bearer ")
+		if !ok {
+			continue
+		}
+		for t, name := range tokens {
+			if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(t)) == 1 {
+				return callerIdentity{Method: "token", Subject: name}, nil
+			}
+		}
+		return callerIdentity{}, fmt.Errorf("invalid bearer token")
+	}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.VerifiedChains) > 0 && len(tlsInfo.State.VerifiedChains[0]) > 0 {
+			for _, name := range certIdentities(tlsInfo.State.VerifiedChains[0][0]) {
+				if allowedClients[name] {
+					return callerIdentity{Method: "mtls", Subject: name}, nil
+				}
+			}
+			return callerIdentity{}, fmt.Errorf("client certificate not in allowlist")
+		}
+	}
+	return callerIdentity{}, fmt.Errorf("missing credentials")
+}
+
+// unaryInterceptors is the server's interceptor chain. Callers are authenticated before they
+// take a load-shedding slot (and before LogEvent's rate limits), so unauthenticated traffic
+// cannot crowd out or throttle real callers.
+func unaryInterceptors(cfg config, shedder *loadShedder) []grpc.UnaryServerInterceptor {
+	interceptors := []grpc.UnaryServerInterceptor{recoveryUnaryInterceptor}
+	if cfg.GRPCAuthEnabled() {
+		interceptors = append(interceptors, authUnaryInterceptor(cfg.GRPCAuthTokens, cfg.GRPCAllowedClients))
+	}
+	if shedder != nil {
+		interceptors = append(interceptors, loadShedUnaryInterceptor(shedder))
+	}
+	return interceptors
+}
+
+// loadShedUnaryInterceptor rejects calls beyond the shedder's concurrency cap.
+func loadShedUnaryInterceptor(l *loadShedder) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		release, ok := l.acquire()
+		if !ok {
+			log.Warnf(ctx, "[GRPC] Shedding %s: too many requests in flight", info.FullMethod)
+			return nil, resourceExhausted("server overloaded", time.Second)
+		}
+		defer release()
+		return handler(ctx, req)
+	}
+}
+
+// resourceExhausted is a RESOURCE_EXHAUSTED status carrying a RetryInfo hint.
+func resourceExhausted(msg string, retry time.Duration) error {
+	st := status.New(codes.ResourceExhausted, msg)
+	if withInfo, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retry)}); err == nil {
+		st = withInfo
+	}
+	return st.Err()
+}
+
 // ---- gRPC service (registered without codegen) ----
 
 type auditServiceServer interface {
@@ -41,9 +139,20 @@ type auditServiceServer interface {
 
 type recorderServer struct {
 	rdb        *redis.Client
-	cfg        config
+	cfg        config // startup config; see currentConfig
+	live       atomic.Pointer[config]
+	liveMu     sync.Mutex // serializes config swaps
 	httpClient *http.Client
 	async      *asyncDispatcher
+	validator  payloadValidator
+	flows      flowCatalog
+	parking    *parkingLot
+	flowStatus *flowStatusMachine
+	limits     *rateLimiter
+	sinks      []Sink
+
+	// flagOverrides are the flags set through the admin API; they outlast reloads.
+	flagOverrides adminFlags
 }
 
 type auditPayload struct {
@@ -65,15 +174,44 @@ type derivedFields struct {
 	CacheTTLSecs  int64
 	IsMock        bool
 	SessionID     string
+
+	// AckStatus and ResponseError come from responseBody.message.ack.status and responseBody.error.
+	AckStatus     string
+	ResponseError map[string]any
+
+	// Schema is the (possibly deferred) schema validation of the requestBody; nil when disabled.
+	Schema *schemaCheck
+
+	// Caller is the authenticated caller identity; empty when gRPC auth is off.
+	Caller string
+
+	// Sender identifies the network participant that sent the event: requestBody.context
+	// bpp_id, else bpp_uri. Several BPPs answer one search with the same message_id.
+	Sender string
 }
 
+// LogEvent records one audit event. It returns OK whether the event was recorded, found to be
+// a duplicate or parked until its transaction exists; the x-recorder-result header
+// (recorderResultHeader) is the contract that tells these apart, so callers must read it.
 func (s *recorderServer) LogEvent(ctx context.Context, in *wrapperspb.BytesValue) (*emptypb.Empty, error) {
+	cfg := s.currentConfig()
+	received := time.Now()
 	log.Infof(ctx, "[GRPC] LogEvent called, payload size: %d bytes", len(in.GetValue()))
 	
 	if in == nil {
 		log.Errorf(ctx, nil, "[GRPC] ERROR: Request is nil")
 		return nil, status.Error(codes.InvalidArgument, "request is required")
 	}
+	if limit := cfg.GRPCMaxRecvBytes; limit > 0 && len(in.Value) > limit {
+		payloadRejectedTotal.Inc()
+		log.Warnf(ctx, "[GRPC] Rejected payload of %d bytes (limit %d)", len(in.Value), limit)
+		return nil, status.Errorf(codes.InvalidArgument, "payload of %d bytes exceeds the %d byte limit", len(in.Value), limit)
+	}
+	if err := cfg.JSONLimits.check(in.Value); err != nil {
+		payloadRejectedTotal.Inc()
+		log.Warnf(ctx, "[GRPC] Rejected payload: %v", err)
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 	var payload auditPayload
 	if err := json.Unmarshal(in.Value, &payload); err != nil {
 		log.Errorf(ctx, err, "[GRPC] ERROR: Failed to unmarshal payload")
@@ -97,15 +235,37 @@ func (s *recorderServer) LogEvent(ctx context.Context, in *wrapperspb.BytesValue
 		log.Errorf(ctx, err, "[GRPC] ERROR: Failed to derive fields")
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
+	if id, ok := callerIdentityFrom(ctx); ok {
+		derived.Caller = id.String()
+	}
+	if ok, retry, scope := s.limits.allow(derived.SubscriberURL, derived.TransactionID); !ok {
+		log.Warnf(ctx, "[GRPC] Rate limit (%s) exceeded for %s; retry in %v", scope, derived.SubscriberURL, retry)
+		return nil, resourceExhausted(fmt.Sprintf("%s rate limit exceeded", scope), retry)
+	}
 	log.Infof(ctx, "[GRPC] Transaction: %s, Action: %s, Subscriber: %s", derived.TransactionID, derived.Action, derived.SubscriberURL)
+	eventID := eventIdempotencyID(derived)
+
+	var mismatches []contextMismatch
+	if cfg.ContextCheckMode != "" && cfg.ContextCheckMode != contextCheckOff {
+		mismatches = checkContextConsistency(payload)
+		for _, m := range mismatches {
+			log.Warnf(ctx, "[GRPC] Context mismatch for transaction %s: %s", derived.TransactionID, m)
+		}
+		if len(mismatches) > 0 && cfg.ContextCheckMode == contextCheckReject {
+			return nil, status.Errorf(codes.InvalidArgument, "additionalData does not match requestBody.context: %s", mismatches[0])
+		}
+		if cfg.ContextCheckMode != contextCheckAnnotate {
+			mismatches = nil
+		}
+	}
 	if derived.PayloadID == "" {
 		derived.PayloadID, _ = uuidV4()
 	}
 	if derived.TTLSecs == 0 {
-		derived.TTLSecs = s.cfg.APITTLSecondsDefault
+		derived.TTLSecs = cfg.APITTLSecondsDefault
 	}
 	if derived.CacheTTLSecs == 0 {
-		derived.CacheTTLSecs = s.cfg.CacheTTLSecondsDefault
+		derived.CacheTTLSecs = cfg.CacheTTLSecondsDefault
 	}
 
 	key := createTransactionKey(derived.TransactionID, derived.SubscriberURL)
@@ -121,35 +281,176 @@ func (s *recorderServer) LogEvent(ctx context.Context, in *wrapperspb.BytesValue
 		cacheTTL = time.Duration(derived.CacheTTLSecs) * time.Second
 	}
 
-	if !s.cfg.SkipCacheUpdate {
-		log.Infof(ctx, "[GRPC] Updating cache for key: %s (TTL: %v)", key, cacheTTL)
+	var schemaResult *schemaValidationResult
+	if s.validator != nil && cfg.SchemaValidationMode != "" && cfg.SchemaValidationMode != schemaValidationOff {
+		derived.Schema = newSchemaCheck(s.validator, derived.Action, payload.RequestBody)
+		if cfg.SchemaValidationMode == schemaValidationSync {
+			schemaResult = derived.Schema.Result()
+		}
+	}
+
+	ev := &auditEvent{
+		payload:      payload,
+		derived:      derived,
+		key:          key,
+		eventID:      eventID,
+		cacheTTL:     cacheTTL,
+		mismatches:   mismatches,
+		schemaResult: schemaResult,
+		receivedAt:   received,
+	}
+	result, err := s.recordEvent(ctx, ev)
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			return nil, status.Error(codes.NotFound, "transaction not found")
+		}
+		if errors.Is(err, errAborted) {
+			return nil, status.Error(codes.Aborted, "conflict, retry")
+		}
+		return nil, status.Error(codes.Internal, "cache update failed")
+	}
+
+	log.Infof(ctx, "[GRPC] LogEvent completed successfully (%s)", result)
+	setRecorderResult(ctx, result)
+	return &emptypb.Empty{}, nil
+}
+
+// auditEvent is a validated LogEvent request, ready to be recorded (or parked until its
+// transaction exists).
+type auditEvent struct {
+	payload      auditPayload
+	derived      derivedFields
+	key          string
+	eventID      string
+	cacheTTL     time.Duration
+	mismatches   []contextMismatch
+	schemaResult *schemaValidationResult
+
+	// receivedAt is when LogEvent accepted the event.
+	receivedAt time.Time
+
+	// replay marks an event coming out of the parking lot, which must not be parked again.
+	replay bool
+}
+
+// recordEvent appends ev to its transaction and enqueues its side effects. It returns the
+// recorder result to report to the caller, or the cache update error (errNotFound, errAborted, ...).
+// Inline sinks (the archive) see every event, whatever its outcome.
+func (s *recorderServer) recordEvent(ctx context.Context, ev *auditEvent) (string, error) {
+	result, err := s.appendEvent(ctx, ev)
+	s.handleInlineSinks(ctx, ev, result, err)
+	return result, err
+}
+
+// handleInlineSinks hands ev to the inline sinks along with its outcome: the recorder result,
+// or recorderResultFailed and err.
+func (s *recorderServer) handleInlineSinks(ctx context.Context, ev *auditEvent, result string, err error) {
+	sev := &sinkEvent{Derived: ev.derived, RequestBody: ev.payload.RequestBody, ResponseBody: ev.payload.ResponseBody, AdditionalData: ev.payload.AdditionalData, ReceivedAt: ev.receivedAt, Result: result}
+	if err != nil {
+		sev.Result, sev.Err = recorderResultFailed, err.Error()
+	}
+	for _, sink := range s.sinks {
+		if !isInlineSink(sink) || !sink.Enabled(sev) {
+			continue
+		}
+		if err := sink.Handle(ctx, sev); err != nil {
+			log.Errorf(ctx, err, "[GRPC] Sink %s failed", sink.Name())
+		}
+	}
+}
+
+// appendEvent does the work of recordEvent, except for the inline sinks.
+func (s *recorderServer) appendEvent(ctx context.Context, ev *auditEvent) (string, error) {
+	cfg := s.currentConfig()
+	derived, payload, key := ev.derived, ev.payload, ev.key
+	schemaResult := ev.schemaResult
+
+	duplicate := false
+	if !cfg.SkipCacheUpdate {
+		log.Infof(ctx, "[GRPC] Updating cache for key: %s (TTL: %v)", key, ev.cacheTTL)
 		in := cacheAppendInput{
-			PayloadID:     derived.PayloadID,
-			TransactionID: derived.TransactionID,
-			MessageID:     derived.MessageID,
-			SubscriberURL: derived.SubscriberURL,
-			Action:        derived.Action,
-			Timestamp:     derived.Timestamp,
-			TTLSecs:       derived.TTLSecs,
-			Response:      payload.ResponseBody,
-		}
-		if err := updateTransactionAtomically(ctx, s.rdb, key, &in, cacheTTL); err != nil {
-			log.Errorf(ctx, err, "[GRPC] ERROR: Cache update failed")
-			if errors.Is(err, errNotFound) {
-				return nil, status.Error(codes.NotFound, "transaction not found")
+			PayloadID:       derived.PayloadID,
+			TransactionID:   derived.TransactionID,
+			MessageID:       derived.MessageID,
+			SubscriberURL:   derived.SubscriberURL,
+			Action:          derived.Action,
+			Timestamp:       derived.Timestamp,
+			TTLSecs:         derived.TTLSecs,
+			Response:        payload.ResponseBody,
+			Dedupe:          cfg.DedupeEvents,
+			DedupeByMessage: strings.TrimSpace(getString(payload.AdditionalData, "payload_id")) == "",
+
+			OrderByTimestamp:  cfg.APIListOrdering == "timestamp",
+			ContextMismatches: ev.mismatches,
+			SchemaValidation:  schemaResult,
+			Flows:             s.flows,
+			TrackCallbackTTL:  cfg.CallbackTTLTracking,
+			AckStatus:         derived.AckStatus,
+			ResponseError:     derived.ResponseError,
+			IsMock:            derived.IsMock,
+			Caller:            derived.Caller,
+			Sender:            derived.Sender,
+		}
+		err := updateTransactionAtomically(ctx, s.rdb, key, &in, ev.cacheTTL)
+		if errors.Is(err, errNotFound) && cfg.AutoCreateAllowed(derived.SubscriberURL) {
+			seed := newTransactionSeed(derived.TransactionID, derived.SubscriberURL, payload.RequestBody)
+			created, cerr := createTransactionIfMissing(ctx, s.rdb, key, seed, time.Duration(cfg.CacheTTLSecondsDefault)*time.Second)
+			if cerr != nil {
+				log.Errorf(ctx, cerr, "[GRPC] ERROR: Failed to auto-create transaction %s", key)
+			} else {
+				if created {
+					log.Infof(ctx, "[GRPC] Auto-created transaction %s (subscriberType: %q)", key, seed["subscriberType"])
+				}
+				err = updateTransactionAtomically(ctx, s.rdb, key, &in, ev.cacheTTL)
 			}
-			if errors.Is(err, errAborted) {
-				return nil, status.Error(codes.Aborted, "conflict, retry")
+		}
+		if errors.Is(err, errNotFound) && s.parking != nil && !ev.replay {
+			if s.parking.park(ev) {
+				log.Infof(ctx, "[GRPC] Transaction %s not found yet; parked event %s", key, derived.PayloadID)
+				return recorderResultParked, nil
 			}
-			return nil, status.Error(codes.Internal, "cache update failed")
+			log.Warnf(ctx, "[GRPC] Parking buffer full; not parking event %s for %s", derived.PayloadID, key)
 		}
+		if errors.Is(err, errDuplicate) {
+			duplicate = true
+		} else if err != nil {
+			log.Errorf(ctx, err, "[GRPC] ERROR: Cache update failed")
+			return "", err
+		}
+	}
 
-		// Mirror TS behavior: flow status is stored in a separate key and only updated if it already exists.
-		if err := setFlowStatusIfExists(ctx, s.rdb, derived.TransactionID, derived.SubscriberURL, "AVAILABLE", 5*time.Hour); err != nil {
+	if cfg.DedupeEvents && !duplicate {
+		claimed, err := claimEventMarker(ctx, s.rdb, createEventMarkerKey(key, ev.eventID), cfg.DedupeMarkerTTL)
+		if err != nil {
+			log.Warnf(ctx, "automation-recorder: failed to set event marker: %v", err)
+		} else if !claimed {
+			duplicate = true
+		}
+	}
+	if duplicate {
+		log.Infof(ctx, "[GRPC] Duplicate event %s for key %s; skipping cache append and side effects", ev.eventID, key)
+		return recorderResultDup, nil
+	}
+
+	if !cfg.SkipCacheUpdate {
+		// Mirror TS behavior: flow status is stored in separate keys and only updated if they already exist.
+		fev := flowStatusEvent{EntryType: "API", Action: derived.Action, AckStatus: derived.AckStatus}
+		if err := applyFlowStatus(ctx, s.rdb, s.flowStatus, derived.TransactionID, derived.SubscriberURL, fev); err != nil {
 			log.Warnf(ctx, "automation-recorder: failed to set flow status: %v", err)
 		}
-		if err := setExtraFlowStatusIfExists(ctx, s.rdb, derived.TransactionID, derived.SubscriberURL, derived.Action, "AVAILABLE", 5*time.Hour); err != nil {
-			log.Warnf(ctx, "automation-recorder: failed to set extra flow status: %v", err)
+		if cfg.CallbackTTLTracking && derived.TTLSecs > 0 && !isCallbackAction(derived.Action) {
+			if err := scheduleCallbackCheck(ctx, s.rdb, key, requestDeadline(derived)); err != nil {
+				log.Warnf(ctx, "automation-recorder: failed to schedule callback check: %v", err)
+			}
+		}
+		if derived.Schema != nil && schemaResult == nil {
+			s.async.enqueue(context.Background(), "schema-validate", func(ctx context.Context) error {
+				result := derived.Schema.Result()
+				if result == nil {
+					return nil
+				}
+				return patchAPIEntryAtomically(ctx, s.rdb, key, derived.PayloadID, map[string]any{"schemaValidation": result})
+			})
 		}
 
 		log.Infof(ctx, "[GRPC] Cache updated successfully")
@@ -158,26 +459,53 @@ func (s *recorderServer) LogEvent(ctx context.Context, in *wrapperspb.BytesValue
 	}
 
 	// Fire-and-forget side effects.
-	baseCtx := context.Background()
-	if !s.cfg.SkipNOPush {
-		log.Infof(ctx, "[GRPC] Enqueueing Network Observability push")
-		s.async.enqueue(baseCtx, "no-push", func(ctx context.Context) error {
-			return sendLogsToNO(ctx, s.cfg, s.httpClient, derived, payload.RequestBody, payload.ResponseBody)
+	sev := &sinkEvent{Derived: derived, RequestBody: payload.RequestBody, ResponseBody: payload.ResponseBody, AdditionalData: payload.AdditionalData, ReceivedAt: ev.receivedAt}
+	for _, sink := range s.sinks {
+		if isInlineSink(sink) {
+			continue
+		}
+		if !sink.Enabled(sev) {
+			log.Infof(ctx, "[GRPC] Sink %s skipped", sink.Name())
+			continue
+		}
+		log.Infof(ctx, "[GRPC] Enqueueing sink %s", sink.Name())
+		s.async.enqueue(context.Background(), sink.Name(), func(ctx context.Context) error {
+			return sink.Handle(ctx, sev)
 		})
-	} else {
-		log.Infof(ctx, "[GRPC] NO push skipped (SkipNOPush=true)")
 	}
-	if !s.cfg.SkipDBSave {
-		log.Infof(ctx, "[GRPC] Enqueueing database save")
-		s.async.enqueue(baseCtx, "db-save", func(ctx context.Context) error {
-			return savePayloadToDB(ctx, s.cfg, s.httpClient, s.rdb, derived, payload.RequestBody, payload.ResponseBody, payload.AdditionalData)
-		})
-	} else {
-		log.Infof(ctx, "[GRPC] DB save skipped (SkipDBSave=true)")
+
+	return recorderResultOK, nil
+}
+
+// requestDeadline is when the callback for a request event is due: its Beckn timestamp (or now,
+// when unparseable) plus its ttl.
+func requestDeadline(d derivedFields) time.Time {
+	at, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(d.Timestamp))
+	if err != nil {
+		at = time.Now()
 	}
+	return at.Add(time.Duration(d.TTLSecs) * time.Second)
+}
 
-	log.Infof(ctx, "[GRPC] LogEvent completed successfully")
-	return &emptypb.Empty{}, nil
+// eventIdempotencyID identifies an event across plugin retries: the caller's payload_id when
+// present, otherwise message_id, action and sender. It is empty when neither is available.
+func eventIdempotencyID(d derivedFields) string {
+	if id := strings.TrimSpace(d.PayloadID); id != "" {
+		return id
+	}
+	if msgID := strings.TrimSpace(d.MessageID); msgID != "" {
+		id := msgID + "::" + strings.TrimSpace(d.Action)
+		if d.Sender != "" {
+			id += "::" + d.Sender
+		}
+		return id
+	}
+	return ""
+}
+
+func setRecorderResult(ctx context.Context, result string) {
+	// SetHeader fails outside a gRPC server stream (e.g. direct calls in tests); the header is advisory.
+	_ = grpc.SetHeader(ctx, metadata.Pairs(recorderResultHeader, result))
 }
 
 func registerAuditService(s *grpc.Server, impl auditServiceServer) {
@@ -224,12 +552,19 @@ func deriveFields(p auditPayload) (derivedFields, error) {
 	out.CacheTTLSecs = getInt64(ad, "cache_ttl_seconds")
 	out.IsMock = getBool(ad, "is_mock")
 	out.SessionID = getString(ad, "session_id")
+	out.AckStatus, out.ResponseError = extractAck(p.ResponseBody)
 
 	// Backfill from requestBody.context if not provided in additionalData.
 	ctxObj, _ := p.RequestBody["context"].(map[string]any)
 	if strings.TrimSpace(out.MessageID) == "" && ctxObj != nil {
 		out.MessageID = getString(ctxObj, "message_id")
 	}
+	if ctxObj != nil {
+		out.Sender = strings.TrimSpace(getString(ctxObj, "bpp_id"))
+		if out.Sender == "" {
+			out.Sender = strings.TrimSpace(getString(ctxObj, "bpp_uri"))
+		}
+	}
 
 	if strings.TrimSpace(out.TransactionID) == "" {
 		return derivedFields{}, fmt.Errorf("transaction_id is required in additionalData")
@@ -3,11 +3,15 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"net/http"
 	"testing"
 	"time"
 
 	"github.com/alicebob/miniredis/v2"
 	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 func TestDeriveFieldsValid(t *testing.T) {
@@ -186,23 +190,23 @@ func TestDeriveFieldsMessageIDPriority(t *testing.T) {
 	}
 }
 
-func TestAppendFormEntryAtomicallyInvalidKey(t *testing.T) {
+func TestAppendFormEntryInvalidKey(t *testing.T) {
 	ctx := context.Background()
 	mr := miniredis.RunT(t)
 	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
 
-	err := appendFormEntryAtomically(ctx, rdb, "", "https://s", "f1", "type", "sub", nil)
+	err := appendFormEntry(ctx, rdb, formEntryInput{SubscriberURL: "https://s", FormID: "f1", FormType: "type", SubmissionID: "sub"})
 	if err == nil {
-		t.Error("appendFormEntryAtomically() expected error for empty transaction_id")
+		t.Error("appendFormEntry() expected error for empty transaction_id")
 	}
 
-	err = appendFormEntryAtomically(ctx, rdb, "t1", "", "f1", "type", "sub", nil)
+	err = appendFormEntry(ctx, rdb, formEntryInput{TransactionID: "t1", FormID: "f1", FormType: "type", SubmissionID: "sub"})
 	if err == nil {
-		t.Error("appendFormEntryAtomically() expected error for empty subscriber_url")
+		t.Error("appendFormEntry() expected error for empty subscriber_url")
 	}
 }
 
-func TestAppendFormEntryAtomicallyPreservesTTL(t *testing.T) {
+func TestAppendFormEntryPreservesTTL(t *testing.T) {
 	ctx := context.Background()
 	mr := miniredis.RunT(t)
 	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
@@ -216,9 +220,9 @@ func TestAppendFormEntryAtomicallyPreservesTTL(t *testing.T) {
 		t.Fatalf("seed set: %v", err)
 	}
 
-	err := appendFormEntryAtomically(ctx, rdb, "t1", "https://s", "f1", "HTML", "sub", nil)
+	err := appendFormEntry(ctx, rdb, formEntryInput{TransactionID: "t1", SubscriberURL: "https://s", FormID: "f1", FormType: "HTML", SubmissionID: "sub"})
 	if err != nil {
-		t.Fatalf("appendFormEntryAtomically() error = %v", err)
+		t.Fatalf("appendFormEntry() error = %v", err)
 	}
 
 	// Check TTL is still set
@@ -292,21 +296,94 @@ func TestCreateFlowStatusCacheKeyFormat(t *testing.T) {
 	}
 }
 
-func TestSetFlowStatusIfExistsNotCreateNew(t *testing.T) {
+func TestLogEventAutoCreatesTransaction(t *testing.T) {
+	ctx := context.Background()
 	mr := miniredis.RunT(t)
 	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	payload := map[string]any{
+		"requestBody": map[string]any{"context": map[string]any{
+			"transaction_id": "t-new",
+			"bpp_id":         "seller.example.com",
+			"bpp_uri":        "https://seller.example.com/beckn",
+		}},
+		"responseBody": map[string]any{},
+		"additionalData": map[string]any{
+			"transaction_id": "t-new",
+			"subscriber_url": "https://seller.example.com/beckn",
+			"action":         "search",
+		},
+	}
+	b, _ := json.Marshal(payload)
+	cfg := config{SkipNOPush: true, SkipDBSave: true, Env: "test", CacheTTLSecondsDefault: 3600}
+
+	// Off by default: the event is rejected.
+	s := &recorderServer{rdb: rdb, cfg: cfg, httpClient: http.DefaultClient}
+	if _, err := s.LogEvent(ctx, wrapperspb.Bytes(b)); status.Code(err) != codes.NotFound {
+		t.Fatalf("LogEvent() code = %v, want NotFound", status.Code(err))
+	}
+
+	s.cfg.AutoCreateTransactions = true
+	if _, err := s.LogEvent(ctx, wrapperspb.Bytes(b)); err != nil {
+		t.Fatalf("LogEvent() error = %v", err)
+	}
+
+	key := createTransactionKey("t-new", "https://seller.example.com/beckn")
+	txn, err := loadTransactionMap(ctx, rdb, key)
+	if err != nil || txn == nil {
+		t.Fatalf("transaction not created: %v", err)
+	}
+	if txn["subscriberType"] != "BPP" || txn["transactionId"] != "t-new" || txn["autoCreated"] != true {
+		t.Errorf("seed fields = %#v", txn)
+	}
+	if apiList := txn["apiList"].([]any); len(apiList) != 1 {
+		t.Errorf("apiList length = %d, want 1", len(apiList))
+	}
+}
+
+func TestLogEventKeepsCallbacksFromSeveralBPPs(t *testing.T) {
 	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	key := createTransactionKey("t1", "https://buyer.example.com")
+	mr.Set(key, `{"apiList":[]}`)
+
+	onSearch := func(bppID string) []byte {
+		b, _ := json.Marshal(map[string]any{
+			"requestBody": map[string]any{"context": map[string]any{
+				"transaction_id": "t1",
+				"message_id":     "m1",
+				"action":         "on_search",
+				"bpp_id":         bppID,
+				"bpp_uri":        "https://" + bppID + "/beckn",
+			}},
+			"responseBody": map[string]any{},
+			"additionalData": map[string]any{
+				"transaction_id": "t1",
+				"subscriber_url": "https://buyer.example.com",
+				"action":         "on_search",
+			},
+		})
+		return b
+	}
+	s := &recorderServer{rdb: rdb, cfg: config{SkipNOPush: true, SkipDBSave: true, Env: "test", DedupeEvents: true, DedupeMarkerTTL: time.Minute}, httpClient: http.DefaultClient}
+	for _, b := range [][]byte{onSearch("seller-a.example.com"), onSearch("seller-b.example.com"), onSearch("seller-a.example.com")} {
+		if _, err := s.LogEvent(ctx, wrapperspb.Bytes(b)); err != nil {
+			t.Fatalf("LogEvent() error = %v", err)
+		}
+	}
 
-	// Key does not exist
-	err := setFlowStatusIfExists(ctx, rdb, "t1", "https://s", "COMPLETED", 1*time.Hour)
+	txn, err := loadTransactionMap(ctx, rdb, key)
 	if err != nil {
-		t.Fatalf("setFlowStatusIfExists() error = %v", err)
+		t.Fatal(err)
 	}
-
-	// Verify key was NOT created
-	key := createFlowStatusCacheKey("t1", "https://s")
-	exists := rdb.Exists(ctx, key).Val()
-	if exists != 0 {
-		t.Error("key should not be created if it doesn't exist")
+	apiList := txn["apiList"].([]any)
+	if len(apiList) != 2 {
+		t.Fatalf("apiList length = %d, want 2 (one per BPP, retry deduped)", len(apiList))
+	}
+	for i, want := range []string{"seller-a.example.com", "seller-b.example.com"} {
+		if got := getString(apiList[i].(map[string]any), "sender"); got != want {
+			t.Errorf("apiList[%d].sender = %q, want %q", i, got, want)
+		}
 	}
 }
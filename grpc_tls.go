@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// grpcServerCredentials builds the TLS credentials for the gRPC listener: server TLS when a
+// cert and key are configured, and mTLS (client certificates required and verified) when a
+// client CA is configured as well. It returns nil for a plaintext listener.
+func grpcServerCredentials(cfg config) (credentials.TransportCredentials, error) {
+	if cfg.GRPCTLSCert == "" && cfg.GRPCTLSKey == "" {
+		if cfg.GRPCTLSClientCA != "" {
+			return nil, fmt.Errorf("RECORDER_GRPC_TLS_CLIENT_CA requires RECORDER_GRPC_TLS_CERT and RECORDER_GRPC_TLS_KEY")
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.GRPCTLSCert, cfg.GRPCTLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("load gRPC TLS key pair: %w", err)
+	}
+	tlsCfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if cfg.GRPCTLSClientCA != "" {
+		pem, err := os.ReadFile(cfg.GRPCTLSClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("read gRPC client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in gRPC client CA %s", cfg.GRPCTLSClientCA)
+		}
+		tlsCfg.ClientCAs = pool
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return credentials.NewTLS(tlsCfg), nil
+}
+
+// certIdentities lists the names a client certificate can be allowlisted by: its subject CN,
+// DNS SANs and URI SANs (e.g. SPIFFE IDs).
+func certIdentities(cert *x509.Certificate) []string {
+	var names []string
+	if cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+	names = append(names, cert.DNSNames...)
+	for _, u := range cert.URIs {
+		names = append(names, u.String())
+	}
+	return names
+}
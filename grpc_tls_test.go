@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+	kpem []byte
+}
+
+func issueTestCert(t *testing.T, cn string, parent *testCert, isCA bool) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:              []string{cn},
+	}
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	kder, _ := x509.MarshalECPrivateKey(key)
+	return &testCert{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		kpem: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kder}),
+	}
+}
+
+func startAuthTestServer(t *testing.T, cfg config, creds credentials.TransportCredentials) (*bufconn.Listener, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	mr.Set(createTransactionKey("t1", "https://s"), `{"apiList":[]}`)
+
+	opts := []grpc.ServerOption{grpc.ChainUnaryInterceptor(recoveryUnaryInterceptor, authUnaryInterceptor(cfg.GRPCAuthTokens, cfg.GRPCAllowedClients))}
+	if creds != nil {
+		opts = append(opts, grpc.Creds(creds))
+	}
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer(opts...)
+	cfg.SkipNOPush, cfg.SkipDBSave, cfg.Env = true, true, "test"
+	registerAuditService(gs, &recorderServer{rdb: rdb, cfg: cfg, httpClient: http.DefaultClient})
+	go func() { _ = gs.Serve(lis) }()
+	t.Cleanup(gs.Stop)
+	return lis, rdb
+}
+
+func invokeLogEvent(ctx context.Context, t *testing.T, lis *bufconn.Listener, creds credentials.TransportCredentials) error {
+	t.Helper()
+	dialer := func(context.Context, string) (net.Conn, error) { return lis.Dial() }
+	conn, err := grpc.NewClient("passthrough:///recorder.local", grpc.WithContextDialer(dialer), grpc.WithTransportCredentials(creds))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	b, _ := json.Marshal(map[string]any{
+		"requestBody":    map[string]any{},
+		"responseBody":   map[string]any{},
+		"additionalData": map[string]any{"transaction_id": "t1", "subscriber_url": "https://s", "action": "search"},
+	})
+	return conn.Invoke(ctx, grpcFullMethod, wrapperspb.Bytes(b), &emptypb.Empty{})
+}
+
+func lastCaller(t *testing.T, rdb *redis.Client) any {
+	t.Helper()
+	txn, _ := loadTransactionMap(context.Background(), rdb, createTransactionKey("t1", "https://s"))
+	apiList, _ := txn["apiList"].([]any)
+	if len(apiList) == 0 {
+		t.Fatalf("apiList is empty")
+	}
+	return apiList[len(apiList)-1].(map[string]any)["caller"]
+}
+
+func TestGrpcMTLSClientAllowlist(t *testing.T) {
+	ca := issueTestCert(t, "test-ca", nil, true)
+	server := issueTestCert(t, "recorder.local", ca, false)
+	allowed := issueTestCert(t, "api-service", ca, false)
+	other := issueTestCert(t, "someone-else", ca, false)
+
+	dir := t.TempDir()
+	write := func(name string, b []byte) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, b, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	cfg := config{
+		GRPCTLSCert:        write("server.pem", server.pem),
+		GRPCTLSKey:         write("server-key.pem", server.kpem),
+		GRPCTLSClientCA:    write("ca.pem", ca.pem),
+		GRPCAllowedClients: map[string]bool{"api-service": true},
+	}
+	creds, err := grpcServerCredentials(cfg)
+	if err != nil {
+		t.Fatalf("grpcServerCredentials() error = %v", err)
+	}
+	lis, rdb := startAuthTestServer(t, cfg, creds)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	clientCreds := func(c *testCert) credentials.TransportCredentials {
+		pair, err := tls.X509KeyPair(c.pem, c.kpem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return credentials.NewTLS(&tls.Config{RootCAs: roots, ServerName: "recorder.local", Certificates: []tls.Certificate{pair}})
+	}
+
+	ctx := context.Background()
+	if err := invokeLogEvent(ctx, t, lis, clientCreds(allowed)); err != nil {
+		t.Fatalf("allowed client: %v", err)
+	}
+	if got := lastCaller(t, rdb); got != "mtls:api-service" {
+		t.Errorf("caller = %v, want mtls:api-service", got)
+	}
+	if err := invokeLogEvent(ctx, t, lis, clientCreds(other)); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("client not in allowlist: code = %v, want Unauthenticated", status.Code(err))
+	}
+}
+
+func TestGrpcBearerTokenAuth(t *testing.T) {
+	lis, rdb := startAuthTestServer(t, config{GRPCAuthTokens: map[string]string{"tok-1": "api-service"}}, nil)
+	ctx := context.Background()
+
+	if err := invokeLogEvent(ctx, t, lis, insecure.NewCredentials()); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("no token: code = %v, want Unauthenticated", status.Code(err))
+	}
+	bad := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer nope")
+	if err := invokeLogEvent(bad, t, lis, insecure.NewCredentials()); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("bad token: code = %v, want Unauthenticated", status.Code(err))
+	}
+	good := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer tok-1")
+	if err := invokeLogEvent(good, t, lis, insecure.NewCredentials()); err != nil {
+		t.Fatalf("valid token: %v", err)
+	}
+	if got := lastCaller(t, rdb); got != "token:api-service" {
+		t.Errorf("caller = %v, want token:api-service", got)
+	}
+}
+
+func TestGrpcServerCredentialsConfig(t *testing.T) {
+	if creds, err := grpcServerCredentials(config{}); creds != nil || err != nil {
+		t.Errorf("plaintext: got %v, %v; want nil, nil", creds, err)
+	}
+	if _, err := grpcServerCredentials(config{GRPCTLSClientCA: "ca.pem"}); err == nil {
+		t.Errorf("client CA without server cert: want error")
+	}
+	if _, err := grpcServerCredentials(config{GRPCTLSCert: "missing.pem", GRPCTLSKey: "missing-key.pem"}); err == nil {
+		t.Errorf("missing key pair: want error")
+	}
+}
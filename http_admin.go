@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	adminAuditKey   = "RECORDER_ADMIN_AUDIT"
+	adminAuditLimit = 1000
+	adminMaxWorkers = 256
+)
+
+// adminAPI serves the runtime controls under /admin: feature flags, sink pause/resume and the
+// async worker count. Every change is appended to the audit log.
+type adminAPI struct {
+	rdb      *redis.Client
+	recorder *recorderServer
+	async    *asyncDispatcher
+}
+
+type adminFlags struct {
+	SkipCacheUpdate *bool `json:"skipCacheUpdate,omitempty"`
+	SkipNOPush      *bool `json:"skipNOPush,omitempty"`
+	SkipDBSave      *bool `json:"skipDBSave,omitempty"`
+}
+
+type adminSink struct {
+	Name   string `json:"name"`
+	Paused bool   `json:"paused"`
+	Held   int    `json:"held"`
+	// Requeuing is what is left of the backlog a resumed sink is still requeueing.
+	Requeuing int `json:"requeuing,omitempty"`
+}
+
+type adminAuditEntry struct {
+	At     string `json:"at"`
+	Caller string `json:"caller"`
+	Action string `json:"action"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func (a *adminAPI) register(mux *http.ServeMux, wrap func(http.HandlerFunc) http.HandlerFunc) {
+	mux.HandleFunc("GET /admin/flags", wrap(a.getFlags))
+	mux.HandleFunc("PATCH /admin/flags", wrap(a.patchFlags))
+	mux.HandleFunc("GET /admin/sinks", wrap(a.listSinks))
+	mux.HandleFunc("POST /admin/sinks/{name}/pause", wrap(a.pauseSink))
+	mux.HandleFunc("POST /admin/sinks/{name}/resume", wrap(a.resumeSink))
+	mux.HandleFunc("GET /admin/workers", wrap(a.getWorkers))
+	mux.HandleFunc("PUT /admin/workers", wrap(a.putWorkers))
+	mux.HandleFunc("GET /admin/audit", wrap(a.listAudit))
+}
+
+func (a *adminAPI) flags() adminFlags {
+	cfg := a.recorder.currentConfig()
+	return adminFlags{SkipCacheUpdate: &cfg.SkipCacheUpdate, SkipNOPush: &cfg.SkipNOPush, SkipDBSave: &cfg.SkipDBSave}
+}
+
+func (a *adminAPI) getFlags(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.flags())
+}
+
+// patchFlags sets the flags present in the body. They are kept over config reloads until the
+// process restarts.
+func (a *adminAPI) patchFlags(w http.ResponseWriter, r *http.Request) {
+	var req adminFlags
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if req.SkipCacheUpdate == nil && req.SkipNOPush == nil && req.SkipDBSave == nil {
+		http.Error(w, "No flags to change: expected skipCacheUpdate, skipNOPush or skipDBSave", http.StatusBadRequest)
+		return
+	}
+	before := a.flags()
+	a.recorder.overrideFlags(req)
+	after := a.flags()
+	a.audit(r, "flags", fmt.Sprintf("skipCacheUpdate %v -> %v, skipNOPush %v -> %v, skipDBSave %v -> %v",
+		*before.SkipCacheUpdate, *after.SkipCacheUpdate, *before.SkipNOPush, *after.SkipNOPush, *before.SkipDBSave, *after.SkipDBSave))
+	writeJSON(w, http.StatusOK, after)
+}
+
+// merge returns f with the flags set in g overriding its own.
+func (f adminFlags) merge(g adminFlags) adminFlags {
+	if g.SkipCacheUpdate != nil {
+		f.SkipCacheUpdate = g.SkipCacheUpdate
+	}
+	if g.SkipNOPush != nil {
+		f.SkipNOPush = g.SkipNOPush
+	}
+	if g.SkipDBSave != nil {
+		f.SkipDBSave = g.SkipDBSave
+	}
+	return f
+}
+
+// apply sets the flags present in f on c and describes those that changed it.
+func (f adminFlags) apply(c *config) []string {
+	var changed []string
+	set := func(name string, dst *bool, v *bool) {
+		if v != nil && *dst != *v {
+			changed = append(changed, fmt.Sprintf("%s=%v (configured: %v)", name, *v, *dst))
+			*dst = *v
+		}
+	}
+	set("skipCacheUpdate", &c.SkipCacheUpdate, f.SkipCacheUpdate)
+	set("skipNOPush", &c.SkipNOPush, f.SkipNOPush)
+	set("skipDBSave", &c.SkipDBSave, f.SkipDBSave)
+	return changed
+}
+
+// jobs are the async job names that can be paused: the configured sinks, except those handled
+// on the request path, and schema validation.
+func (a *adminAPI) jobs() []string {
+	names := make([]string, 0, len(a.recorder.sinks)+1)
+	for _, sink := range a.recorder.sinks {
+		if !isInlineSink(sink) {
+			names = append(names, sink.Name())
+		}
+	}
+	return append(names, "schema-validate")
+}
+
+func (a *adminAPI) sinks() []adminSink {
+	held, requeuing := a.async.held(), a.async.requeuing()
+	jobs := a.jobs()
+	res := make([]adminSink, 0, len(jobs))
+	for _, name := range jobs {
+		n, paused := held[name]
+		res = append(res, adminSink{Name: name, Paused: paused, Held: n, Requeuing: requeuing[name]})
+	}
+	return res
+}
+
+func (a *adminAPI) listSinks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"sinks": a.sinks()})
+}
+
+func (a *adminAPI) pauseSink(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !slices.Contains(a.jobs(), name) {
+		http.Error(w, "Unknown sink", http.StatusNotFound)
+		return
+	}
+	if a.async.pause(name) {
+		a.audit(r, "sink.pause", name)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"sinks": a.sinks()})
+}
+
+func (a *adminAPI) resumeSink(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !slices.Contains(a.jobs(), name) {
+		http.Error(w, "Unknown sink", http.StatusNotFound)
+		return
+	}
+	if requeued, dropped, ok := a.async.resume(name); ok {
+		a.audit(r, "sink.resume", fmt.Sprintf("%s (requeuing %d held jobs, %d dropped)", name, requeued, dropped))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"sinks": a.sinks()})
+}
+
+func (a *adminAPI) getWorkers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"workers": a.async.workers(), "queueDepth": len(a.async.ch), "queueCapacity": cap(a.async.ch)})
+}
+
+func (a *adminAPI) putWorkers(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Workers int `json:"workers"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if req.Workers < 1 || req.Workers > adminMaxWorkers {
+		http.Error(w, fmt.Sprintf("workers must be between 1 and %d", adminMaxWorkers), http.StatusBadRequest)
+		return
+	}
+	before := a.async.workers()
+	a.async.setWorkers(req.Workers)
+	a.audit(r, "workers", fmt.Sprintf("%d -> %d", before, req.Workers))
+	a.getWorkers(w, r)
+}
+
+func (a *adminAPI) listAudit(w http.ResponseWriter, r *http.Request) {
+	entries, err := a.auditEntries(r.Context(), 100)
+	if err != nil {
+		fmt.Printf("[ADMIN] ERROR: Failed to read audit log: %v\n", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"entries": entries})
+}
+
+// audit records a change with the caller and time: on stdout, and in a capped Redis list
+// (newest first) so it survives the pod.
+func (a *adminAPI) audit(r *http.Request, action, detail string) {
+	entry := adminAuditEntry{At: tsISOStringNow(), Caller: "anonymous", Action: action, Detail: detail}
+	if id, ok := callerIdentityFrom(r.Context()); ok {
+		entry.Caller = id.String()
+	}
+	fmt.Printf("[ADMIN] %s by %s from %s: %s\n", action, entry.Caller, r.RemoteAddr, detail)
+	if a.rdb == nil {
+		return
+	}
+	b, _ := json.Marshal(entry)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := a.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, adminAuditKey, string(b))
+		pipe.LTrim(ctx, adminAuditKey, 0, adminAuditLimit-1)
+		return nil
+	}); err != nil {
+		fmt.Printf("[ADMIN] ERROR: Failed to write audit log: %v\n", err)
+	}
+}
+
+func (a *adminAPI) auditEntries(ctx context.Context, n int64) ([]adminAuditEntry, error) {
+	entries := []adminAuditEntry{}
+	if a.rdb == nil {
+		return entries, nil
+	}
+	vals, err := a.rdb.LRange(ctx, adminAuditKey, 0, n-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range vals {
+		var e adminAuditEntry
+		if json.Unmarshal([]byte(v), &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newAdminTestServer(t *testing.T) (*httptest.Server, *recorderServer, *asyncDispatcher, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	d := newAsyncDispatcher(context.Background(), 10, 1, false)
+	rec := &recorderServer{rdb: rdb, cfg: config{SkipNOPush: false, SkipDBSave: false}, async: d}
+	rec.sinks, _ = newSinks([]string{"no", "db"}, sinkDeps{conf: rec.currentConfig, rdb: rdb})
+	auth := map[string][]httpAuthenticator{"/admin": {&apiKeyAuth{header: "X-API-Key", keys: map[string]string{"k1": "oncall"}}}}
+	srv := httptest.NewServer(buildHTTPMux(httpDeps{rdb: rdb, auth: auth, admin: &adminAPI{rdb: rdb, recorder: rec, async: d}}))
+	t.Cleanup(srv.Close)
+	return srv, rec, d, rdb
+}
+
+func adminRequest(t *testing.T, method, url, body string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("X-API-Key", "k1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s error: %v", method, url, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestAdminFlags(t *testing.T) {
+	srv, rec, _, rdb := newAdminTestServer(t)
+
+	resp := adminRequest(t, http.MethodPatch, srv.URL+"/admin/flags", `{"skipDBSave":true}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PATCH status = %v, want 200", resp.StatusCode)
+	}
+	cfg := rec.currentConfig()
+	if !cfg.SkipDBSave || cfg.SkipNOPush {
+		t.Errorf("flags = SkipDBSave %v, SkipNOPush %v; want true, false", cfg.SkipDBSave, cfg.SkipNOPush)
+	}
+
+	var got map[string]bool
+	json.NewDecoder(adminRequest(t, http.MethodGet, srv.URL+"/admin/flags", "").Body).Decode(&got)
+	if !got["skipDBSave"] || got["skipNOPush"] {
+		t.Errorf("GET /admin/flags = %v", got)
+	}
+
+	if resp := adminRequest(t, http.MethodPatch, srv.URL+"/admin/flags", `{}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("empty PATCH status = %v, want 400", resp.StatusCode)
+	}
+
+	entries, _ := (&adminAPI{rdb: rdb}).auditEntries(context.Background(), 10)
+	if len(entries) != 1 || entries[0].Caller != "apikey:oncall" || entries[0].Action != "flags" || !strings.Contains(entries[0].Detail, "skipDBSave false -> true") {
+		t.Errorf("audit entries = %+v", entries)
+	}
+}
+
+func TestAdminRequiresAuth(t *testing.T) {
+	srv, _, _, _ := newAdminTestServer(t)
+	resp, err := http.Get(srv.URL + "/admin/flags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status = %v, want 401", resp.StatusCode)
+	}
+}
+
+func TestAdminDisabledWithoutAuth(t *testing.T) {
+	d := newAsyncDispatcher(context.Background(), 10, 1, false)
+	srv := httptest.NewServer(buildHTTPMux(httpDeps{admin: &adminAPI{recorder: &recorderServer{}, async: d}}))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/admin/flags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status = %v, want 404", resp.StatusCode)
+	}
+}
+
+func TestAdminSinksPauseResume(t *testing.T) {
+	srv, _, d, rdb := newAdminTestServer(t)
+
+	if resp := adminRequest(t, http.MethodPost, srv.URL+"/admin/sinks/db/pause", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("pause status = %v, want 200", resp.StatusCode)
+	}
+	ran := make(chan struct{}, 1)
+	d.enqueue(context.Background(), "db", func(context.Context) error {
+		ran <- struct{}{}
+		return nil
+	})
+	if held := d.held()["db"]; held != 1 {
+		t.Fatalf("held = %d, want 1", held)
+	}
+
+	var listed struct{ Sinks []adminSink }
+	json.NewDecoder(adminRequest(t, http.MethodGet, srv.URL+"/admin/sinks", "").Body).Decode(&listed)
+	for _, s := range listed.Sinks {
+		if s.Name == "db" && (!s.Paused || s.Held != 1) {
+			t.Errorf("db sink = %+v, want paused with 1 held", s)
+		}
+	}
+
+	adminRequest(t, http.MethodPost, srv.URL+"/admin/sinks/db/resume", "")
+	<-ran
+	if _, paused := d.held()["db"]; paused {
+		t.Error("db still paused after resume")
+	}
+
+	if resp := adminRequest(t, http.MethodPost, srv.URL+"/admin/sinks/nope/pause", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown sink status = %v, want 404", resp.StatusCode)
+	}
+
+	entries, _ := (&adminAPI{rdb: rdb}).auditEntries(context.Background(), 10)
+	if len(entries) != 2 || entries[0].Action != "sink.resume" || entries[1].Action != "sink.pause" {
+		t.Errorf("audit entries = %+v, want resume then pause", entries)
+	} else if entries[0].Detail != "db (requeuing 1 held jobs, 0 dropped)" {
+		t.Errorf("resume detail = %q", entries[0].Detail)
+	}
+}
+
+func TestAdminWorkers(t *testing.T) {
+	srv, _, d, _ := newAdminTestServer(t)
+
+	resp := adminRequest(t, http.MethodPut, srv.URL+"/admin/workers", `{"workers":4}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT status = %v, want 200", resp.StatusCode)
+	}
+	if n := d.workers(); n != 4 {
+		t.Errorf("workers = %d, want 4", n)
+	}
+	if resp := adminRequest(t, http.MethodPut, srv.URL+"/admin/workers", `{"workers":0}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("zero workers status = %v, want 400", resp.StatusCode)
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	httpAuthAPIKey = "apikey"
+	httpAuthHMAC   = "hmac"
+	httpAuthJWT    = "jwt"
+
+	hmacTimestampHeader = "X-Signature-Timestamp"
+	hmacSignatureHeader = "X-Signature"
+)
+
+var errNoCredentials = errors.New("no credentials")
+
+// callerIdentity is the authenticated caller of a request, e.g. {Method: "hmac", Subject: "form-service"}.
+type callerIdentity struct {
+	Method  string
+	Subject string
+}
+
+func (c callerIdentity) String() string {
+	return c.Method + ":" + c.Subject
+}
+
+type callerIdentityKey struct{}
+
+func withCallerIdentity(ctx context.Context, id callerIdentity) context.Context {
+	return context.WithValue(ctx, callerIdentityKey{}, id)
+}
+
+func callerIdentityFrom(ctx context.Context) (callerIdentity, bool) {
+	id, ok := ctx.Value(callerIdentityKey{}).(callerIdentity)
+	return id, ok
+}
+
+// httpAuthenticator verifies one kind of credential. It returns errNoCredentials when the
+// request does not carry that kind, so the next configured authenticator can be tried.
+type httpAuthenticator interface {
+	authenticate(r *http.Request) (callerIdentity, error)
+}
+
+// requireAuth admits requests accepted by any of auths and stores the caller identity in the
+// request context.
+func requireAuth(auths []httpAuthenticator, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var failures []string
+		for _, a := range auths {
+			id, err := a.authenticate(r)
+			if err == nil {
+				next(w, r.WithContext(withCallerIdentity(r.Context(), id)))
+				return
+			}
+			if isTooLarge(err) {
+				rejectTooLarge(w, r, err)
+				return
+			}
+			if !errors.Is(err, errNoCredentials) {
+				failures = append(failures, err.Error())
+			}
+		}
+		fmt.Printf("[AUTH] Rejected %s %s from %s: %s\n", r.Method, r.URL.Path, r.RemoteAddr, strings.Join(failures, "; "))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	}
+}
+
+// newHTTPAuth builds the authenticators configured for each route. Health endpoints are never
+// authenticated.
+func newHTTPAuth(cfg config, rdb *redis.Client) (map[string][]httpAuthenticator, error) {
+	routes := map[string][]httpAuthenticator{}
+	built := map[string]httpAuthenticator{}
+	for route, methods := range cfg.HTTPAuthRoutes {
+		if route == "/health" {
+			fmt.Printf("[AUTH] Warning: %s stays unauthenticated\n", route)
+			continue
+		}
+		for _, method := range methods {
+			a, ok := built[method]
+			if !ok {
+				var err error
+				if a, err = newHTTPAuthenticator(cfg, rdb, method); err != nil {
+					return nil, fmt.Errorf("route %s: %w", route, err)
+				}
+				built[method] = a
+			}
+			routes[route] = append(routes[route], a)
+		}
+	}
+	return routes, nil
+}
+
+func newHTTPAuthenticator(cfg config, rdb *redis.Client, method string) (httpAuthenticator, error) {
+	switch method {
+	case httpAuthAPIKey:
+		if len(cfg.HTTPAPIKeys) == 0 {
+			return nil, fmt.Errorf("apikey auth requires RECORDER_HTTP_API_KEYS")
+		}
+		return &apiKeyAuth{header: cfg.HTTPAPIKeyHeader, keys: cfg.HTTPAPIKeys}, nil
+	case httpAuthHMAC:
+		if cfg.HTTPHMACSecret == "" {
+			return nil, fmt.Errorf("hmac auth requires RECORDER_HTTP_HMAC_SECRET")
+		}
+		return &hmacAuth{secret: []byte(cfg.HTTPHMACSecret), maxSkew: cfg.HTTPHMACMaxSkew, rdb: rdb}, nil
+	case httpAuthJWT:
+		if cfg.HTTPJWKSFile == "" {
+			return nil, fmt.Errorf("jwt auth requires RECORDER_HTTP_JWKS_FILE")
+		}
+		keys, err := loadJWKS(cfg.HTTPJWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		return &jwtAuth{keys: keys, issuer: cfg.HTTPJWTIssuer, audience: cfg.HTTPJWTAudience}, nil
+	default:
+		return nil, fmt.Errorf("unknown auth method %q", method)
+	}
+}
+
+// ---- static API key ----
+
+type apiKeyAuth struct {
+	header string
+	keys   map[string]string // key -> caller name
+}
+
+func (a *apiKeyAuth) authenticate(r *http.Request) (callerIdentity, error) {
+	got := r.Header.Get(a.header)
+	if got == "" {
+		return callerIdentity{}, errNoCredentials
+	}
+	for key, name := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(got), []byte(key)) == 1 {
+			return callerIdentity{Method: httpAuthAPIKey, Subject: name}, nil
+		}
+	}
+	return callerIdentity{}, fmt.Errorf("apikey: unknown key")
+}
+
+// ---- HMAC-signed requests ----
+
+// hmacAuth verifies X-Signature = hex(HMAC-SHA256(secret, timestamp + "." + method + "." +
+// path + "." + query + "." + body)) with X-Signature-Timestamp in unix seconds; query is the
+// canonical query string (see canonicalQuery). Timestamps outside maxSkew
+// are rejected, and each signature is accepted once (tracked in Redis, or in memory without it).
+type hmacAuth struct {
+	secret  []byte
+	maxSkew time.Duration
+	rdb     *redis.Client
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func signHMACRequest(secret []byte, timestamp, method, path, rawQuery string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "." + method + "." + path + "." + canonicalQuery(rawQuery) + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// canonicalQuery re-encodes a query string with keys sorted, so the signature does not depend
+// on parameter order or escaping. An unparseable query is signed as sent.
+func canonicalQuery(rawQuery string) string {
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return rawQuery
+	}
+	return values.Encode()
+}
+
+func (a *hmacAuth) authenticate(r *http.Request) (callerIdentity, error) {
+	sig := strings.ToLower(strings.TrimSpace(r.Header.Get(hmacSignatureHeader)))
+	ts := strings.TrimSpace(r.Header.Get(hmacTimestampHeader))
+	if sig == "" {
+		return callerIdentity{}, errNoCredentials
+	}
+	secs, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return callerIdentity{}, fmt.Errorf("hmac: invalid timestamp")
+	}
+	if skew := time.Since(time.Unix(secs, 0)); skew > a.maxSkew || skew < -a.maxSkew {
+		return callerIdentity{}, fmt.Errorf("hmac: timestamp outside the allowed window")
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return callerIdentity{}, fmt.Errorf("hmac: read body: %w", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	want := signHMACRequest(a.secret, ts, r.Method, r.URL.Path, r.URL.RawQuery, body)
+	if !hmac.Equal([]byte(sig), []byte(want)) {
+		return callerIdentity{}, fmt.Errorf("hmac: signature mismatch")
+	}
+	fresh, err := a.claim(r.Context(), sig)
+	if err != nil {
+		return callerIdentity{}, fmt.Errorf("hmac: replay check: %w", err)
+	}
+	if !fresh {
+		return callerIdentity{}, fmt.Errorf("hmac: replayed signature")
+	}
+	return callerIdentity{Method: httpAuthHMAC, Subject: "form-service"}, nil
+}
+
+// claim records sig as used for twice the skew window and reports whether it was unused.
+func (a *hmacAuth) claim(ctx context.Context, sig string) (bool, error) {
+	ttl := 2 * a.maxSkew
+	if a.rdb != nil {
+		return claimEventMarker(ctx, a.rdb, "RECORDER_HMAC_"+sig, ttl)
+	}
+	now := time.Now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.seen == nil {
+		a.seen = map[string]time.Time{}
+	}
+	for s, exp := range a.seen {
+		if now.After(exp) {
+			delete(a.seen, s)
+		}
+	}
+	if _, ok := a.seen[sig]; ok {
+		return false, nil
+	}
+	a.seen[sig] = now.Add(ttl)
+	return true, nil
+}
+
+// ---- JWT against a local JWKS ----
+
+type jwtAuth struct {
+	keys     map[string]crypto.PublicKey // by kid
+	issuer   string
+	audience string
+}
+
+func (a *jwtAuth) authenticate(r *http.Request) (callerIdentity, error) {
+	raw, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || strings.TrimSpace(raw) == "" {
+		return callerIdentity{}, errNoCredentials
+	}
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithExpirationRequired(),
+	}
+	if a.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(a.issuer))
+	}
+	if a.audience != "" {
+		opts = append(opts, jwt.WithAudience(a.audience))
+	}
+	token, err := jwt.Parse(strings.TrimSpace(raw), a.keyFor, opts...)
+	if err != nil {
+		return callerIdentity{}, fmt.Errorf("jwt: %w", err)
+	}
+	sub, _ := token.Claims.GetSubject()
+	return callerIdentity{Method: httpAuthJWT, Subject: sub}, nil
+}
+
+func (a *jwtAuth) keyFor(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" && len(a.keys) == 1 {
+		for _, k := range a.keys {
+			return k, nil
+		}
+	}
+	if k, ok := a.keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// loadJWKS reads the RSA and EC public keys of a JWKS file, keyed by kid.
+func loadJWKS(path string) (map[string]crypto.PublicKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("parse JWKS %s: %w", path, err)
+	}
+	keys := map[string]crypto.PublicKey{}
+	for i, k := range set.Keys {
+		pub, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("JWKS %s key %d: %w", path, i, err)
+		}
+		keys[k.Kid] = pub
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS %s has no keys", path)
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid n: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid e: %w", err)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x: %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y: %w", err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+func newAuthTestMux(t *testing.T, cfg config) (*httptest.Server, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	mr.Set(createTransactionKey("t1", "https://s"), `{"apiList":[]}`)
+	auth, err := newHTTPAuth(cfg, rdb)
+	if err != nil {
+		t.Fatalf("newHTTPAuth() error = %v", err)
+	}
+	srv := httptest.NewServer(buildHTTPMux(httpDeps{rdb: rdb, auth: auth}))
+	t.Cleanup(srv.Close)
+	return srv, mr
+}
+
+func doFormRequest(t *testing.T, srv *httptest.Server, body string, headers map[string]string) int {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/html-form", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+const authTestForm = `{"transaction_id":"t1","subscriber_url":"https://s","form_action_id":"f1"}`
+
+func TestHTTPAuthAPIKey(t *testing.T) {
+	srv, mr := newAuthTestMux(t, config{
+		HTTPAuthRoutes:   map[string][]string{"/html-form": {"apikey"}, "/health": {"apikey"}},
+		HTTPAPIKeyHeader: "X-API-Key",
+		HTTPAPIKeys:      map[string]string{"secret-1": "form-service"},
+	})
+
+	if code := doFormRequest(t, srv, authTestForm, nil); code != http.StatusUnauthorized {
+		t.Errorf("no key: status = %d, want 401", code)
+	}
+	if code := doFormRequest(t, srv, authTestForm, map[string]string{"X-API-Key": "wrong"}); code != http.StatusUnauthorized {
+		t.Errorf("wrong key: status = %d, want 401", code)
+	}
+	if code := doFormRequest(t, srv, authTestForm, map[string]string{"X-API-Key": "secret-1"}); code != http.StatusOK {
+		t.Errorf("valid key: status = %d, want 200", code)
+	}
+
+	var txn map[string]any
+	val, _ := mr.Get(createTransactionKey("t1", "https://s"))
+	_ = json.Unmarshal([]byte(val), &txn)
+	if entry := txn["apiList"].([]any)[0].(map[string]any); entry["caller"] != "apikey:form-service" {
+		t.Errorf("caller = %v, want apikey:form-service", entry["caller"])
+	}
+
+	resp, err := http.Get(srv.URL + "/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("health status = %d, want 200 without credentials", resp.StatusCode)
+	}
+}
+
+func TestHTTPAuthHMAC(t *testing.T) {
+	secret := "shared-secret"
+	srv, _ := newAuthTestMux(t, config{
+		HTTPAuthRoutes:  map[string][]string{"/html-form": {"hmac"}},
+		HTTPHMACSecret:  secret,
+		HTTPHMACMaxSkew: time.Minute,
+	})
+	signed := func(at time.Time, body string) map[string]string {
+		ts := strconv.FormatInt(at.Unix(), 10)
+		return map[string]string{
+			hmacTimestampHeader: ts,
+			hmacSignatureHeader: signHMACRequest([]byte(secret), ts, http.MethodPost, "/html-form", "", []byte(body)),
+		}
+	}
+
+	headers := signed(time.Now(), authTestForm)
+	if code := doFormRequest(t, srv, authTestForm, headers); code != http.StatusOK {
+		t.Fatalf("signed: status = %d, want 200", code)
+	}
+	if code := doFormRequest(t, srv, authTestForm, headers); code != http.StatusUnauthorized {
+		t.Errorf("replay: status = %d, want 401", code)
+	}
+	if code := doFormRequest(t, srv, authTestForm, signed(time.Now().Add(-5*time.Minute), authTestForm)); code != http.StatusUnauthorized {
+		t.Errorf("stale timestamp: status = %d, want 401", code)
+	}
+	tampered := strings.Replace(authTestForm, "f1", "f2", 1)
+	if code := doFormRequest(t, srv, tampered, signed(time.Now().Add(time.Second), authTestForm)); code != http.StatusUnauthorized {
+		t.Errorf("tampered body: status = %d, want 401", code)
+	}
+}
+
+func TestSignHMACRequestQuery(t *testing.T) {
+	secret := []byte("shared-secret")
+	sig := signHMACRequest(secret, "1", http.MethodPost, "/html-form", "b=2&a=1", nil)
+	if got := signHMACRequest(secret, "1", http.MethodPost, "/html-form", "a=1&b=%32", nil); got != sig {
+		t.Error("signature depends on query order or escaping")
+	}
+	if got := signHMACRequest(secret, "1", http.MethodPost, "/html-form", "a=1&b=3", nil); got == sig {
+		t.Error("signature does not cover the query")
+	}
+}
+
+func TestHTTPAuthJWT(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, _ := json.Marshal(map[string]any{"keys": []map[string]any{{
+		"kty": "RSA",
+		"kid": "k1",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwks, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	srv, _ := newAuthTestMux(t, config{
+		HTTPAuthRoutes:   map[string][]string{"/html-form": {"apikey", "jwt"}},
+		HTTPAPIKeyHeader: "X-API-Key",
+		HTTPAPIKeys:      map[string]string{"secret-1": "ops"},
+		HTTPJWKSFile:     path,
+		HTTPJWTIssuer:    "https://issuer.example.com",
+	})
+	sign := func(claims jwt.MapClaims) string {
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		tok.Header["kid"] = "k1"
+		s, err := tok.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + s
+	}
+
+	valid := sign(jwt.MapClaims{"sub": "form-service", "iss": "https://issuer.example.com", "exp": time.Now().Add(time.Minute).Unix()})
+	if code := doFormRequest(t, srv, authTestForm, map[string]string{"Authorization": valid}); code != http.StatusOK {
+		t.Errorf("valid token: status = %d, want 200", code)
+	}
+	expired := sign(jwt.MapClaims{"sub": "form-service", "iss": "https://issuer.example.com", "exp": time.Now().Add(-time.Minute).Unix()})
+	if code := doFormRequest(t, srv, authTestForm, map[string]string{"Authorization": expired}); code != http.StatusUnauthorized {
+		t.Errorf("expired token: status = %d, want 401", code)
+	}
+	wrongIssuer := sign(jwt.MapClaims{"sub": "form-service", "iss": "https://other", "exp": time.Now().Add(time.Minute).Unix()})
+	if code := doFormRequest(t, srv, authTestForm, map[string]string{"Authorization": wrongIssuer}); code != http.StatusUnauthorized {
+		t.Errorf("wrong issuer: status = %d, want 401", code)
+	}
+	// Any configured method is enough.
+	if code := doFormRequest(t, srv, authTestForm, map[string]string{"X-API-Key": "secret-1"}); code != http.StatusOK {
+		t.Errorf("api key on jwt route: status = %d, want 200", code)
+	}
+}
+
+func TestNewHTTPAuthRejectsIncompleteConfig(t *testing.T) {
+	for _, method := range []string{"apikey", "hmac", "jwt", "basic"} {
+		if _, err := newHTTPAuth(config{HTTPAuthRoutes: map[string][]string{"/html-form": {method}}}, nil); err == nil {
+			t.Errorf("newHTTPAuth(%s) without settings: want error", method)
+		}
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,18 +15,73 @@ import (
 )
 
 type formHandler struct {
-	rdb *redis.Client
+	rdb        *redis.Client
+	flowStatus *flowStatusMachine
+	limits     *rateLimiter
+	jsonLimits jsonLimits
+}
+
+// httpDeps are the dependencies of the HTTP API.
+type httpDeps struct {
+	rdb        *redis.Client
+	flowStatus *flowStatusMachine
+	auth       map[string][]httpAuthenticator // by route
+	limits     *rateLimiter
+	shedder    *loadShedder
+	maxBody    int64 // request body limit in bytes; 0 = unlimited
+	jsonLimits jsonLimits
+	admin      *adminAPI // mounted only when /admin requires auth
+}
+
+// protect wraps h with the authenticators configured for route, if any.
+func (d httpDeps) protect(route string, h http.HandlerFunc) http.HandlerFunc {
+	if auths := d.auth[route]; len(auths) > 0 {
+		return requireAuth(auths, h)
+	}
+	return h
 }
 
 func newHTTPMux(rdb *redis.Client) *http.ServeMux {
+	return buildHTTPMux(httpDeps{rdb: rdb})
+}
+
+func buildHTTPMux(deps httpDeps) *http.ServeMux {
+	rdb := deps.rdb
 	mux := http.NewServeMux()
-	fh := &formHandler{rdb: rdb}
+	fh := &formHandler{rdb: rdb, flowStatus: deps.flowStatus, limits: deps.limits, jsonLimits: deps.jsonLimits}
 	hc := &healthChecker{rdb: rdb}
-	mux.HandleFunc("/html-form", loggingMiddleware(fh.htmlForm))
+	mux.HandleFunc("/html-form", loggingMiddleware(limitBody(deps.maxBody, deps.protect("/html-form", shedMiddleware(deps.shedder, fh.htmlForm)))))
 	mux.HandleFunc("/health", hc.handle)
+	mux.HandleFunc("/metrics", deps.protect("/metrics", metricsHandler))
+	if deps.admin != nil {
+		if len(deps.auth["/admin"]) == 0 {
+			fmt.Printf("[ADMIN] Admin API disabled: add /admin to RECORDER_HTTP_AUTH_ROUTES to enable it\n")
+		} else {
+			deps.admin.register(mux, func(h http.HandlerFunc) http.HandlerFunc {
+				return loggingMiddleware(limitBody(deps.maxBody, deps.protect("/admin", h)))
+			})
+		}
+	}
 	return mux
 }
 
+// shedMiddleware rejects requests beyond the shedder's concurrency cap with 503.
+func shedMiddleware(l *loadShedder, next http.HandlerFunc) http.HandlerFunc {
+	if l == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		release, ok := l.acquire()
+		if !ok {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Server overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		defer release()
+		next(w, r)
+	}
+}
+
 // loggingMiddleware logs HTTP requests
 func loggingMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -64,23 +121,29 @@ func (h *formHandler) htmlForm(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	fmt.Printf("[FORM] Processing form submission request\n")
 	
-	// Mirror Express route: POST only.
+	// Mirror Express route for submissions (POST); GET lists what was recorded.
+	if r.Method == http.MethodGet {
+		h.listSubmissions(w, r)
+		return
+	}
 	if r.Method != http.MethodPost {
-		fmt.Printf("[FORM] ERROR: Invalid method %s, only POST allowed\n", r.Method)
+		fmt.Printf("[FORM] ERROR: Invalid method %s, only GET and POST allowed\n", r.Method)
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 
-	var formData map[string]any
-	dec := json.NewDecoder(r.Body)
-	dec.UseNumber()
-	if err := dec.Decode(&formData); err != nil || formData == nil {
+	formData, files, err := parseFormSubmission(r, h.jsonLimits)
+	if isTooLarge(err) {
+		rejectTooLarge(w, r, err)
+		return
+	}
+	if err != nil {
 		fmt.Printf("[FORM] ERROR: Failed to decode form data: %v\n", err)
 		http.Error(w, "Invalid form data", http.StatusBadRequest)
 		return
 	}
 	
-	fmt.Printf("[FORM] Received form data with %d fields\n", len(formData))
+	fmt.Printf("[FORM] Received form data with %d fields and %d files\n", len(formData), len(files))
 	_ = ctx
 
 	transactionID, ok1 := formData["transaction_id"].(string)
@@ -94,6 +157,13 @@ func (h *formHandler) htmlForm(w http.ResponseWriter, r *http.Request) {
 
 	fmt.Printf("[FORM] Transaction ID: %s, Subscriber URL: %s, Form Action ID: %s\n", transactionID, subscriberURL, formActionID)
 
+	if ok, retry, scope := h.limits.allow(subscriberURL, transactionID); !ok {
+		fmt.Printf("[FORM] Rate limit (%s) exceeded for %s; retry in %v\n", scope, subscriberURL, retry)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		return
+	}
+
 	formType, _ := formData["form_type"].(string)
 
 	// TS controller passes formData.submissionId (camelCase)
@@ -105,14 +175,35 @@ func (h *formHandler) htmlForm(w http.ResponseWriter, r *http.Request) {
 	errVal := formData["error"]
 
 	fmt.Printf("[FORM] Appending form entry to Redis...\n")
-	if err := appendFormEntryAtomically(r.Context(), h.rdb, transactionID, subscriberURL, formActionID, formType, submissionID, errVal); err != nil {
+	entry := formEntryInput{
+		TransactionID: transactionID,
+		SubscriberURL: subscriberURL,
+		FormID:        formActionID,
+		FormType:      formType,
+		SubmissionID:  submissionID,
+		Error:         errVal,
+		Fields:        extraFormFields(formData),
+		Files:         files,
+	}
+	if id, ok := callerIdentityFrom(ctx); ok {
+		entry.Caller = id.String()
+	}
+	err = appendFormEntry(r.Context(), h.rdb, entry)
+	if errors.Is(err, errDuplicate) {
+		fmt.Printf("[FORM] Submission %s for form %s already recorded; skipping\n", submissionID, formActionID)
+		w.Header().Set("X-Recorder-Result", recorderResultDup)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("Form submitted successfully"))
+		return
+	}
+	if err != nil {
 		// TS controller catches and returns 500.
 		fmt.Printf("[FORM] ERROR: Failed to append form entry: %v\n", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
-	// set status available 
-	if err := setFlowStatusIfExists(ctx,h.rdb,transactionID,subscriberURL,"AVAILABLE",0); err != nil {
+	fev := flowStatusEvent{EntryType: "FORM", FormID: formActionID, FormError: errVal != nil}
+	if err := applyFlowStatus(ctx, h.rdb, h.flowStatus, transactionID, subscriberURL, fev); err != nil {
 		fmt.Printf("[FORM] ERROR: Failed to set flow status: %v\n", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
@@ -123,8 +214,53 @@ func (h *formHandler) htmlForm(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write([]byte("Form submitted successfully"))
 }
 
-func appendFormEntryAtomically(ctx context.Context, rdb *redis.Client, transactionID, subscriberURL, formID, formType, submissionID string, errVal any) error {
-	key := createTransactionKey(transactionID, subscriberURL)
+// formEntryInput is a form submission to append to a transaction's apiList as a FORM entry.
+type formEntryInput struct {
+	TransactionID string
+	SubscriberURL string
+	FormID        string
+	FormType      string
+	SubmissionID  string
+	Error         any
+	Fields        map[string]any // submitted fields other than the standard ones
+	Files         []formFile
+	Caller        string // authenticated caller, when the route requires auth
+}
+
+// listSubmissions serves GET /html-form?transaction_id=&subscriber_url=&form_action_id= with the
+// FORM entries recorded for that form.
+func (h *formHandler) listSubmissions(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	transactionID := strings.TrimSpace(q.Get("transaction_id"))
+	subscriberURL := strings.TrimSpace(q.Get("subscriber_url"))
+	formActionID := strings.TrimSpace(q.Get("form_action_id"))
+	if transactionID == "" || subscriberURL == "" || formActionID == "" {
+		http.Error(w, "Missing required query parameters: transaction_id, subscriber_url, form_action_id", http.StatusBadRequest)
+		return
+	}
+
+	submissions, err := listFormSubmissions(r.Context(), h.rdb, transactionID, subscriberURL, formActionID)
+	if errors.Is(err, errNotFound) {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Printf("[FORM] ERROR: Failed to load submissions: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"transactionId": transactionID,
+		"subscriberUrl": subscriberURL,
+		"formId":        formActionID,
+		"submissions":   submissions,
+	})
+}
+
+func appendFormEntry(ctx context.Context, rdb *redis.Client, in formEntryInput) error {
+	key := createTransactionKey(in.TransactionID, in.SubscriberURL)
 	if key == "" {
 		return fmt.Errorf("invalid key")
 	}
@@ -157,18 +293,30 @@ func appendFormEntryAtomically(ctx context.Context, rdb *redis.Client, transacti
 			if !ok || apiList == nil {
 				apiList = []any{}
 			}
+			if hasDuplicateFormEntry(apiList, in.FormID, in.SubmissionID) {
+				return errDuplicate
+			}
 
 			entry := map[string]any{
 				"entryType": "FORM",
-				"formId":    strings.TrimSpace(formID),
+				"formId":    strings.TrimSpace(in.FormID),
 				"timestamp": tsISOStringNow(),
-				"formType":  strings.TrimSpace(formType),
+				"formType":  strings.TrimSpace(in.FormType),
+			}
+			if strings.TrimSpace(in.SubmissionID) != "" {
+				entry["submissionId"] = strings.TrimSpace(in.SubmissionID)
 			}
-			if strings.TrimSpace(submissionID) != "" {
-				entry["submissionId"] = strings.TrimSpace(submissionID)
+			if in.Error != nil {
+				entry["error"] = in.Error
 			}
-			if errVal != nil {
-				entry["error"] = errVal
+			if len(in.Fields) > 0 {
+				entry["fields"] = in.Fields
+			}
+			if len(in.Files) > 0 {
+				entry["files"] = in.Files
+			}
+			if in.Caller != "" {
+				entry["caller"] = in.Caller
 			}
 
 			apiList = append(apiList, entry)
@@ -193,7 +341,7 @@ func appendFormEntryAtomically(ctx context.Context, rdb *redis.Client, transacti
 		if err == nil {
 			return nil
 		}
-		if errors.Is(err, errNotFound) {
+		if errors.Is(err, errNotFound) || errors.Is(err, errDuplicate) {
 			return err
 		}
 		if errors.Is(err, redis.TxFailedErr) {
@@ -204,6 +352,43 @@ func appendFormEntryAtomically(ctx context.Context, rdb *redis.Client, transacti
 	return errAborted
 }
 
+// hasDuplicateFormEntry reports whether apiList already has a FORM entry for formID with the
+// same (non-empty) submissionID.
+func hasDuplicateFormEntry(apiList []any, formID, submissionID string) bool {
+	formID, submissionID = strings.TrimSpace(formID), strings.TrimSpace(submissionID)
+	if submissionID == "" {
+		return false
+	}
+	for _, it := range apiList {
+		entry, ok := it.(map[string]any)
+		if ok && getString(entry, "entryType") == "FORM" && getString(entry, "formId") == formID && getString(entry, "submissionId") == submissionID {
+			return true
+		}
+	}
+	return false
+}
+
+// listFormSubmissions returns the FORM entries recorded for formID, oldest first. It returns
+// errNotFound when the transaction does not exist.
+func listFormSubmissions(ctx context.Context, rdb *redis.Client, transactionID, subscriberURL, formID string) ([]any, error) {
+	txn, err := loadTransactionMap(ctx, rdb, createTransactionKey(transactionID, subscriberURL))
+	if err != nil {
+		return nil, err
+	}
+	if txn == nil {
+		return nil, errNotFound
+	}
+	apiList, _ := txn["apiList"].([]any)
+	submissions := []any{}
+	for _, it := range apiList {
+		entry, ok := it.(map[string]any)
+		if ok && getString(entry, "entryType") == "FORM" && getString(entry, "formId") == strings.TrimSpace(formID) {
+			submissions = append(submissions, entry)
+		}
+	}
+	return submissions, nil
+}
+
 // JS Date().toISOString() shape: 2006-01-02T15:04:05.000Z
 func tsISOStringNow() string {
 	return time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
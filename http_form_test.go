@@ -19,14 +19,15 @@ func TestHTTPFormMethodNotAllowed(t *testing.T) {
 	srv := httptest.NewServer(newHTTPMux(rdb))
 	defer srv.Close()
 
-	resp, err := http.Get(srv.URL + "/html-form")
+	req, _ := http.NewRequest(http.MethodPut, srv.URL+"/html-form", nil)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		t.Fatalf("GET request error: %v", err)
+		t.Fatalf("PUT request error: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusMethodNotAllowed {
-		t.Errorf("GET status = %v, want %v", resp.StatusCode, http.StatusMethodNotAllowed)
+		t.Errorf("PUT status = %v, want %v", resp.StatusCode, http.StatusMethodNotAllowed)
 	}
 }
 
@@ -301,6 +302,97 @@ func TestHTTPFormOptionalFields(t *testing.T) {
 	}
 }
 
+func TestHTTPFormDedupesSubmissions(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	key := createTransactionKey("t1", "https://s")
+	mr.Set(key, `{"apiList":[]}`)
+
+	srv := httptest.NewServer(newHTTPMux(rdb))
+	defer srv.Close()
+
+	post := func(formID, submissionID string) *http.Response {
+		b, _ := json.Marshal(map[string]any{"transaction_id": "t1", "subscriber_url": "https://s", "form_action_id": formID, "submissionId": submissionID})
+		resp, err := http.Post(srv.URL+"/html-form", "application/json", bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("POST request error: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %v, want %v", resp.StatusCode, http.StatusOK)
+		}
+		return resp
+	}
+	post("f1", "sub-1")
+	if got := post("f1", "sub-1").Header.Get("X-Recorder-Result"); got != "duplicate" {
+		t.Errorf("X-Recorder-Result = %q, want duplicate", got)
+	}
+	post("f2", "sub-1") // same submission ID on another form is distinct
+	post("f1", "")      // no submission ID: never deduped
+	post("f1", "")
+
+	got, _ := loadTransactionMap(ctx, rdb, key)
+	if n := len(got["apiList"].([]any)); n != 4 {
+		t.Errorf("apiList length = %d, want 4", n)
+	}
+}
+
+func TestHTTPFormListSubmissions(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	mr.Set(createTransactionKey("t1", "https://s"), `{"apiList":[
+		{"entryType":"API","action":"search"},
+		{"entryType":"FORM","formId":"f1","submissionId":"sub-1"},
+		{"entryType":"FORM","formId":"f2","submissionId":"sub-2"},
+		{"entryType":"FORM","formId":"f1","submissionId":"sub-3"}
+	]}`)
+
+	srv := httptest.NewServer(newHTTPMux(rdb))
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantSubs   []string
+	}{
+		{"form submissions", "transaction_id=t1&subscriber_url=https://s/&form_action_id=f1", http.StatusOK, []string{"sub-1", "sub-3"}},
+		{"no submissions", "transaction_id=t1&subscriber_url=https://s&form_action_id=f9", http.StatusOK, []string{}},
+		{"missing transaction", "transaction_id=t9&subscriber_url=https://s&form_action_id=f1", http.StatusNotFound, nil},
+		{"missing parameter", "transaction_id=t1&subscriber_url=https://s", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + "/html-form?" + tt.query)
+			if err != nil {
+				t.Fatalf("GET request error: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %v, want %v", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantSubs == nil {
+				return
+			}
+			var body struct {
+				Submissions []map[string]any `json:"submissions"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if len(body.Submissions) != len(tt.wantSubs) {
+				t.Fatalf("submissions = %#v, want %v", body.Submissions, tt.wantSubs)
+			}
+			for i, want := range tt.wantSubs {
+				if body.Submissions[i]["submissionId"] != want {
+					t.Errorf("submissions[%d] = %#v, want %s", i, body.Submissions[i], want)
+				}
+			}
+		})
+	}
+}
+
 func TestLoggingMiddleware(t *testing.T) {
 	// Test that logging middleware doesn't break the handler
 	called := false
@@ -2,9 +2,13 @@ package main
 
 import (
 	"context"
+	"flag"
+	"io"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/beckn-one/beckn-onix/pkg/log"
@@ -12,13 +16,36 @@ import (
 	"google.golang.org/grpc/keepalive"
 )
 
+// shutdownGrace is how long in-flight gRPC calls may run after a shutdown signal.
+const shutdownGrace = 30 * time.Second
+
 func main() {
-	ctx := context.Background()
-	cfg, err := loadConfig()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(runReplay(ctx, os.Args[2:], os.Stdout, os.Stderr))
+	}
+	configFile := flag.String("config", "", "YAML or JSON config file; env vars override its values (default $RECORDER_CONFIG_FILE)")
+	printConfig := flag.Bool("print-config", false, "print the effective config with secrets masked and exit")
+	flag.Parse()
+	if *configFile != "" {
+		os.Setenv("RECORDER_CONFIG_FILE", *configFile)
+	}
+
+	// With --print-config the dump stays alone on stdout.
+	configLog := io.Writer(os.Stdout)
+	if *printConfig {
+		configLog = os.Stderr
+	}
+	cfg, err := readConfig(configLog)
 	if err != nil {
 		log.Errorf(ctx, err, "automation-recorder: invalid config")
 		os.Exit(2)
 	}
+	if *printConfig {
+		printEffectiveConfig(os.Stdout, cfg)
+		return
+	}
 
 	rdb := newRedisClient(cfg.RedisAddr)
 	if err := rdb.Ping(ctx).Err(); err != nil {
@@ -26,15 +53,38 @@ func main() {
 		os.Exit(2)
 	}
 
-	// HTTP API (form endpoint)
-	if cfg.HTTPListenAddr != "" {
-		go func() {
-			log.Infof(ctx, "automation-recorder: http listening on %s", cfg.HTTPListenAddr)
-			if err := http.ListenAndServe(cfg.HTTPListenAddr, newHTTPMux(rdb)); err != nil {
-				log.Errorf(ctx, err, "automation-recorder: http serve failed")
-				os.Exit(1)
-			}
-		}()
+	flowStatus := defaultFlowStatusMachine()
+	if cfg.FlowStatusRulesFile != "" {
+		flowStatus, err = loadFlowStatusMachine(cfg.FlowStatusRulesFile)
+		if err != nil {
+			log.Errorf(ctx, err, "automation-recorder: failed to load flow status rules")
+			os.Exit(2)
+		}
+		log.Infof(ctx, "automation-recorder: loaded %d flow status rules", len(flowStatus.Rules))
+	}
+
+	limitRules := rateLimitRules{Subscriber: cfg.RateLimitSubscriber, Transaction: cfg.RateLimitTransaction}
+	if cfg.RateLimitFile != "" {
+		limitRules, err = loadRateLimitRules(cfg.RateLimitFile, limitRules)
+		if err != nil {
+			log.Errorf(ctx, err, "automation-recorder: failed to load rate limits")
+			os.Exit(2)
+		}
+	}
+	var limits *rateLimiter
+	if limitRules.Subscriber.enabled() || limitRules.Transaction.enabled() || len(limitRules.Subscribers) > 0 {
+		limits = newRateLimiter(limitRules)
+	}
+	var shedder *loadShedder
+	if cfg.MaxInFlight > 0 || cfg.ShedRedisLatency > 0 {
+		shedder = newLoadShedder(cfg.MaxInFlight, cfg.ShedMaxInFlight, cfg.ShedRedisLatency)
+		rdb.AddHook(shedder.redisHook())
+	}
+
+	httpAuth, err := newHTTPAuth(cfg, rdb)
+	if err != nil {
+		log.Errorf(ctx, err, "automation-recorder: invalid HTTP auth config")
+		os.Exit(2)
 	}
 
 	lsn, err := net.Listen("tcp", cfg.ListenAddr)
@@ -43,10 +93,35 @@ func main() {
 		os.Exit(2)
 	}
 
+	var validator payloadValidator
+	if cfg.SchemaValidationMode != schemaValidationOff {
+		v, err := newDirSchemaValidator(cfg.SchemaDir)
+		if err != nil {
+			log.Errorf(ctx, err, "automation-recorder: failed to load schema bundles")
+			os.Exit(2)
+		}
+		validator = v
+	}
+
+	var flows flowCatalog
+	if cfg.FlowsFile != "" {
+		flows, err = loadFlowCatalog(cfg.FlowsFile)
+		if err != nil {
+			log.Errorf(ctx, err, "automation-recorder: failed to load flows")
+			os.Exit(2)
+		}
+		log.Infof(ctx, "automation-recorder: loaded %d flow definitions", len(flows))
+	}
+
+	if cfg.CallbackTTLTracking {
+		go runCallbackSweeper(ctx, rdb, cfg.CallbackSweepInterval)
+	}
+
 	dispatcher := newAsyncDispatcher(ctx, cfg.AsyncQueueSize, cfg.AsyncWorkerCount, cfg.DropOnQueueFull)
+	dispatcher.pauseBacklog = cfg.AsyncPauseBacklog
 
-	srv := grpc.NewServer(
-		grpc.ChainUnaryInterceptor(recoveryUnaryInterceptor),
+	serverOpts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unaryInterceptors(cfg, shedder)...),
 		grpc.KeepaliveParams(keepalive.ServerParameters{
 			Time:    2 * time.Minute,
 			Timeout: 20 * time.Second,
@@ -55,14 +130,74 @@ func main() {
 			MinTime:             30 * time.Second,
 			PermitWithoutStream: true,
 		}),
-	)
+	}
+	creds, err := grpcServerCredentials(cfg)
+	if err != nil {
+		log.Errorf(ctx, err, "automation-recorder: invalid gRPC TLS config")
+		os.Exit(2)
+	}
+	if cfg.GRPCMaxMsgBytes > 0 {
+		serverOpts = append(serverOpts, grpc.MaxRecvMsgSize(cfg.GRPCMaxMsgBytes))
+	}
+	if creds != nil {
+		serverOpts = append(serverOpts, grpc.Creds(creds))
+	}
+	srv := grpc.NewServer(serverOpts...)
 
-	httpClient := &http.Client{Timeout: 10 * time.Second}
-	registerAuditService(srv, &recorderServer{rdb: rdb, cfg: cfg, httpClient: httpClient, async: dispatcher})
+	// Shared by every sink; each call sets its own (hot-reloadable) timeout on the request
+	// context, so the client itself carries none.
+	httpClient := &http.Client{}
+	recorder := &recorderServer{rdb: rdb, cfg: cfg, httpClient: httpClient, async: dispatcher, validator: validator, flows: flows, flowStatus: flowStatus, limits: limits}
+	sinks, err := newSinks(cfg.Sinks, sinkDeps{conf: recorder.currentConfig, rdb: rdb, httpClient: httpClient})
+	if err != nil {
+		log.Errorf(ctx, err, "automation-recorder: invalid sink config")
+		os.Exit(2)
+	}
+	recorder.sinks = sinks
+	if cfg.ParkingEnabled {
+		recorder.parking = newParkingLot(rdb, cfg.ParkingTTL, cfg.ParkingMaxEvents, cfg.ParkingRetryMin, cfg.ParkingRetryMax, func(ctx context.Context, ev *auditEvent) error {
+			_, err := recorder.recordEvent(ctx, ev)
+			return err
+		})
+		go recorder.parking.run(ctx)
+	}
+	go recorder.watchConfig(ctx, cfg.ConfigFile, cfg.ConfigWatchInterval)
+
+	admin := &adminAPI{rdb: rdb, recorder: recorder, async: dispatcher}
+	// HTTP API (form endpoint, metrics, admin)
+	if cfg.HTTPListenAddr != "" {
+		go func() {
+			log.Infof(ctx, "automation-recorder: http listening on %s", cfg.HTTPListenAddr)
+			if err := http.ListenAndServe(cfg.HTTPListenAddr, buildHTTPMux(httpDeps{rdb: rdb, flowStatus: flowStatus, auth: httpAuth, limits: limits, shedder: shedder, maxBody: cfg.HTTPMaxBodyBytes, jsonLimits: cfg.JSONLimits, admin: admin})); err != nil {
+				log.Errorf(ctx, err, "automation-recorder: http serve failed")
+				os.Exit(1)
+			}
+		}()
+	}
+
+	registerAuditService(srv, recorder)
+
+	// On SIGINT or SIGTERM, finish in-flight calls (for at most shutdownGrace), stop the
+	// background work and close the sinks so the archive is flushed.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-stop
+		log.Infof(ctx, "automation-recorder: %v received, shutting down", sig)
+		force := time.AfterFunc(shutdownGrace, srv.Stop)
+		srv.GracefulStop()
+		force.Stop()
+	}()
 
 	log.Infof(ctx, "automation-recorder: listening on %s", cfg.ListenAddr)
 	if err := srv.Serve(lsn); err != nil {
 		log.Errorf(ctx, err, "automation-recorder: grpc serve failed")
 		os.Exit(1)
 	}
+	cancel()
+	if err := closeSinks(sinks); err != nil {
+		log.Errorf(ctx, err, "automation-recorder: failed to close sinks")
+		os.Exit(1)
+	}
+	log.Infof(ctx, "automation-recorder: stopped")
 }
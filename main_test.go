@@ -16,6 +16,7 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
 	"google.golang.org/protobuf/types/known/emptypb"
@@ -410,8 +411,8 @@ func TestFlowStatusKeyUpdatedOnlyIfExists(t *testing.T) {
 
 	// When key doesn't exist, it must not be created.
 	missingKey := createFlowStatusCacheKey("t1", "https://s")
-	if err := setFlowStatusIfExists(ctx, rdb, "t1", "https://s", "AVAILABLE", 5*time.Hour); err != nil {
-		t.Fatalf("setFlowStatusIfExists missing: %v", err)
+	if err := applyFlowStatus(ctx, rdb, nil, "t1", "https://s", flowStatusEvent{EntryType: "API", Action: "search"}); err != nil {
+		t.Fatalf("applyFlowStatus missing: %v", err)
 	}
 	if mr.Exists(missingKey) {
 		t.Fatalf("expected flow status key to not be created")
@@ -420,8 +421,8 @@ func TestFlowStatusKeyUpdatedOnlyIfExists(t *testing.T) {
 	// When key exists, it must be updated with ttl.
 	existingKey := createFlowStatusCacheKey("t2", "https://s")
 	mr.Set(existingKey, "{}")
-	if err := setFlowStatusIfExists(ctx, rdb, "t2", "https://s", "AVAILABLE", 5*time.Hour); err != nil {
-		t.Fatalf("setFlowStatusIfExists existing: %v", err)
+	if err := applyFlowStatus(ctx, rdb, nil, "t2", "https://s", flowStatusEvent{EntryType: "API", Action: "search"}); err != nil {
+		t.Fatalf("applyFlowStatus existing: %v", err)
 	}
 	val, err := rdb.Get(ctx, existingKey).Result()
 	if err != nil {
@@ -514,7 +515,7 @@ func TestSavePayloadToDB_MatchesTSDataService(t *testing.T) {
 		StatusCode:    201,
 	}
 
-	if err := savePayloadToDB(ctx, cfg, srv.Client(), rdb, d, requestBody, responseBody, additionalData); err != nil {
+	if err := savePayloadToDB(ctx, cfg, srv.Client(), rdb, nil, d, requestBody, responseBody, additionalData); err != nil {
 		t.Fatalf("savePayloadToDB: %v", err)
 	}
 
@@ -544,3 +545,71 @@ func TestSavePayloadToDB_MatchesTSDataService(t *testing.T) {
 		t.Fatalf("httpStatus: %#v", savedPayload["httpStatus"])
 	}
 }
+
+func TestGrpcLogEventRetryIsIdempotent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	key := createTransactionKey("t1", "https://s")
+	seedB, _ := json.Marshal(map[string]any{"messageIds": []string{}, "apiList": []any{}})
+	if err := rdb.Set(ctx, key, string(seedB), 0).Err(); err != nil {
+		t.Fatalf("seed set: %v", err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	registerAuditService(gs, &recorderServer{rdb: rdb, cfg: config{SkipNOPush: true, SkipDBSave: true, DedupeEvents: true, DedupeMarkerTTL: time.Minute, Env: "test"}, httpClient: http.DefaultClient, async: newAsyncDispatcher(ctx, 10, 1, true)})
+	go func() { _ = gs.Serve(lis) }()
+	t.Cleanup(gs.Stop)
+
+	dialer := func(context.Context, string) (net.Conn, error) { return lis.Dial() }
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(dialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	payload := map[string]any{
+		"requestBody":  map[string]any{"context": map[string]any{"transaction_id": "t1", "message_id": "m1"}},
+		"responseBody": map[string]any{"ok": true},
+		"additionalData": map[string]any{
+			"payload_id":     "pid-1",
+			"transaction_id": "t1",
+			"subscriber_url": "https://s",
+			"action":         "on_search",
+		},
+	}
+	b, _ := json.Marshal(payload)
+
+	results := []string{}
+	for i := 0; i < 2; i++ {
+		var header metadata.MD
+		if err := conn.Invoke(ctx, grpcFullMethod, wrapperspb.Bytes(b), &emptypb.Empty{}, grpc.Header(&header)); err != nil {
+			t.Fatalf("invoke %d: %v", i, err)
+		}
+		if v := header.Get(recorderResultHeader); len(v) == 1 {
+			results = append(results, v[0])
+		}
+	}
+
+	if len(results) != 2 || results[0] != recorderResultOK || results[1] != recorderResultDup {
+		t.Fatalf("%s headers = %v, want [%s %s]", recorderResultHeader, results, recorderResultOK, recorderResultDup)
+	}
+
+	val, err := rdb.Get(ctx, key).Result()
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal([]byte(val), &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if apiList := got["apiList"].([]any); len(apiList) != 1 {
+		t.Fatalf("apiList length = %d, want 1", len(apiList))
+	}
+	if !mr.Exists(createEventMarkerKey(key, "pid-1")) {
+		t.Fatalf("expected event marker to be set")
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// metric is a process-wide counter or gauge served on /metrics in the Prometheus text format.
+type metric struct {
+	name  string
+	help  string
+	kind  string
+	value atomic.Int64
+}
+
+func (m *metric) Inc()         { m.value.Add(1) }
+func (m *metric) Add(n int64)  { m.value.Add(n) }
+func (m *metric) Set(n int64)  { m.value.Store(n) }
+func (m *metric) Value() int64 { return m.value.Load() }
+
+var metricsRegistry struct {
+	mu      sync.Mutex
+	metrics []*metric
+}
+
+func newCounter(name, help string) *metric { return registerMetric(name, help, "counter") }
+
+func newGauge(name, help string) *metric { return registerMetric(name, help, "gauge") }
+
+func registerMetric(name, help, kind string) *metric {
+	m := &metric{name: name, help: help, kind: kind}
+	metricsRegistry.mu.Lock()
+	defer metricsRegistry.mu.Unlock()
+	metricsRegistry.metrics = append(metricsRegistry.metrics, m)
+	return m
+}
+
+func writeMetrics(w io.Writer) {
+	metricsRegistry.mu.Lock()
+	metrics := append([]*metric(nil), metricsRegistry.metrics...)
+	metricsRegistry.mu.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name < metrics[j].name })
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", m.name, m.help, m.name, m.kind, m.name, m.Value())
+	}
+}
+
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeMetrics(w)
+}
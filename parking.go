@@ -0,0 +1,186 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	parkingParkedTotal    = newCounter("recorder_parking_parked_total", "Events parked because their transaction did not exist yet.")
+	parkingRecoveredTotal = newCounter("recorder_parking_recovered_total", "Parked events recorded after their transaction appeared.")
+	parkingExpiredTotal   = newCounter("recorder_parking_expired_total", "Parked events dropped because their transaction never appeared.")
+	parkingRejectedTotal  = newCounter("recorder_parking_rejected_total", "Events not parked because the parking buffer was full.")
+	parkingPending        = newGauge("recorder_parking_pending", "Events currently parked.")
+)
+
+// parkingLot holds events whose transaction key does not exist yet. This covers the race where
+// the audit event reaches the recorder before the API service has written the transaction:
+// parked events are replayed once their key appears, or dropped when their TTL runs out.
+type parkingLot struct {
+	rdb        *redis.Client
+	ttl        time.Duration
+	maxEvents  int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	replay     func(ctx context.Context, ev *auditEvent) error
+
+	mu     sync.Mutex
+	seq    uint64
+	events []*parkedEvent // ordered by seq
+}
+
+type parkedEvent struct {
+	seq      uint64
+	ev       *auditEvent
+	expires  time.Time
+	nextTry  time.Time
+	attempts int
+}
+
+func newParkingLot(rdb *redis.Client, ttl time.Duration, maxEvents int, minBackoff, maxBackoff time.Duration, replay func(ctx context.Context, ev *auditEvent) error) *parkingLot {
+	if minBackoff <= 0 {
+		minBackoff = 50 * time.Millisecond
+	}
+	if maxBackoff < minBackoff {
+		maxBackoff = minBackoff
+	}
+	return &parkingLot{rdb: rdb, ttl: ttl, maxEvents: maxEvents, minBackoff: minBackoff, maxBackoff: maxBackoff, replay: replay}
+}
+
+// park holds ev until its key exists. It returns false when the buffer is full.
+func (p *parkingLot) park(ev *auditEvent) bool {
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.maxEvents > 0 && len(p.events) >= p.maxEvents {
+		parkingRejectedTotal.Inc()
+		return false
+	}
+	p.seq++
+	p.events = append(p.events, &parkedEvent{seq: p.seq, ev: ev, expires: now.Add(p.ttl), nextTry: now.Add(p.minBackoff)})
+	parkingParkedTotal.Inc()
+	parkingPending.Set(int64(len(p.events)))
+	return true
+}
+
+func (p *parkingLot) len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.events)
+}
+
+// retryDue drops expired events and checks the keys of events due for a retry at now. When a key
+// exists, all events parked for it are replayed in parking order; otherwise they back off
+// exponentially up to maxBackoff.
+func (p *parkingLot) retryDue(ctx context.Context, now time.Time) {
+	var keys []string
+	p.mu.Lock()
+	kept := p.events[:0]
+	for _, pe := range p.events {
+		if !now.Before(pe.expires) {
+			parkingExpiredTotal.Inc()
+			fmt.Printf("[PARK] Dropping event %s: transaction %s did not appear within %v\n", pe.ev.derived.PayloadID, pe.ev.key, p.ttl)
+			continue
+		}
+		if !now.Before(pe.nextTry) && !slices.Contains(keys, pe.ev.key) {
+			keys = append(keys, pe.ev.key)
+		}
+		kept = append(kept, pe)
+	}
+	clear(p.events[len(kept):])
+	p.events = kept
+	parkingPending.Set(int64(len(p.events)))
+	p.mu.Unlock()
+
+	for _, key := range keys {
+		n, err := p.rdb.Exists(ctx, key).Result()
+		if err != nil {
+			fmt.Printf("[PARK] ERROR: Failed to check transaction %s: %v\n", key, err)
+		}
+		if err != nil || n == 0 {
+			p.backoff(key, now)
+			continue
+		}
+		p.replayKey(ctx, key, now)
+	}
+}
+
+func (p *parkingLot) replayKey(ctx context.Context, key string, now time.Time) {
+	events := p.take(key)
+	for i, pe := range events {
+		pe.ev.replay = true
+		if err := p.replay(ctx, pe.ev); err != nil {
+			// Keep the failed event and everything parked after it, so the key's order is preserved.
+			fmt.Printf("[PARK] ERROR: Replay of event %s for %s failed: %v\n", pe.ev.derived.PayloadID, key, err)
+			p.requeue(events[i:])
+			p.backoff(key, now)
+			return
+		}
+		parkingRecoveredTotal.Inc()
+		fmt.Printf("[PARK] Recovered event %s for %s after %d retries\n", pe.ev.derived.PayloadID, key, pe.attempts)
+	}
+}
+
+// take removes and returns the events parked for key, in parking order.
+func (p *parkingLot) take(key string) []*parkedEvent {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var taken []*parkedEvent
+	p.events = slices.DeleteFunc(p.events, func(pe *parkedEvent) bool {
+		if pe.ev.key == key {
+			taken = append(taken, pe)
+			return true
+		}
+		return false
+	})
+	parkingPending.Set(int64(len(p.events)))
+	return taken
+}
+
+func (p *parkingLot) requeue(events []*parkedEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, pe := range events {
+		i, _ := slices.BinarySearchFunc(p.events, pe.seq, func(e *parkedEvent, seq uint64) int {
+			return cmp.Compare(e.seq, seq)
+		})
+		p.events = slices.Insert(p.events, i, pe)
+	}
+	parkingPending.Set(int64(len(p.events)))
+}
+
+func (p *parkingLot) backoff(key string, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, pe := range p.events {
+		if pe.ev.key != key {
+			continue
+		}
+		pe.attempts++
+		delay := p.maxBackoff
+		if pe.attempts < 16 {
+			delay = min(p.minBackoff<<pe.attempts, p.maxBackoff)
+		}
+		pe.nextTry = now.Add(delay)
+	}
+}
+
+// run retries parked events until ctx is done.
+func (p *parkingLot) run(ctx context.Context) {
+	ticker := time.NewTicker(p.minBackoff)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			p.retryDue(ctx, now)
+		}
+	}
+}
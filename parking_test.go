@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func newParkingTestServer(rdb *redis.Client, maxEvents int) *recorderServer {
+	s := &recorderServer{rdb: rdb, cfg: config{SkipNOPush: true, SkipDBSave: true, DedupeEvents: true, DedupeMarkerTTL: time.Minute, Env: "test"}, httpClient: http.DefaultClient}
+	s.parking = newParkingLot(rdb, 5*time.Second, maxEvents, 50*time.Millisecond, time.Second, func(ctx context.Context, ev *auditEvent) error {
+		_, err := s.recordEvent(ctx, ev)
+		return err
+	})
+	return s
+}
+
+func parkingTestPayload(payloadID, action string) []byte {
+	b, _ := json.Marshal(map[string]any{
+		"requestBody":  map[string]any{"context": map[string]any{"action": action}},
+		"responseBody": map[string]any{},
+		"additionalData": map[string]any{
+			"payload_id":     payloadID,
+			"transaction_id": "t1",
+			"subscriber_url": "https://s",
+			"action":         action,
+		},
+	})
+	return b
+}
+
+func TestLogEventParksUntilTransactionExists(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	s := newParkingTestServer(rdb, 10)
+	recovered := parkingRecoveredTotal.Value()
+
+	for _, ev := range []struct{ id, action string }{{"p1", "search"}, {"p2", "on_search"}} {
+		if _, err := s.LogEvent(ctx, wrapperspb.Bytes(parkingTestPayload(ev.id, ev.action))); err != nil {
+			t.Fatalf("LogEvent(%s) error = %v", ev.id, err)
+		}
+	}
+	if n := s.parking.len(); n != 2 {
+		t.Fatalf("parked events = %d, want 2", n)
+	}
+
+	// The key is still missing: events stay parked.
+	s.parking.retryDue(ctx, time.Now().Add(100*time.Millisecond))
+	if n := s.parking.len(); n != 2 {
+		t.Fatalf("parked events after miss = %d, want 2", n)
+	}
+
+	key := createTransactionKey("t1", "https://s")
+	mr.Set(key, `{"apiList":[]}`)
+	s.parking.retryDue(ctx, time.Now().Add(time.Second))
+	if n := s.parking.len(); n != 0 {
+		t.Fatalf("parked events after recovery = %d, want 0", n)
+	}
+	if got := parkingRecoveredTotal.Value() - recovered; got != 2 {
+		t.Errorf("recovered = %d, want 2", got)
+	}
+
+	txn, _ := loadTransactionMap(ctx, rdb, key)
+	apiList := txn["apiList"].([]any)
+	if len(apiList) != 2 || apiList[0].(map[string]any)["payloadId"] != "p1" || apiList[1].(map[string]any)["payloadId"] != "p2" {
+		t.Errorf("apiList = %#v, want p1 then p2", apiList)
+	}
+}
+
+func TestParkingLotExpiresAndRejects(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	s := newParkingTestServer(rdb, 1)
+	expired := parkingExpiredTotal.Value()
+
+	if _, err := s.LogEvent(ctx, wrapperspb.Bytes(parkingTestPayload("p1", "search"))); err != nil {
+		t.Fatalf("LogEvent() error = %v", err)
+	}
+	// The buffer is full: the caller gets NOT_FOUND as before.
+	if _, err := s.LogEvent(ctx, wrapperspb.Bytes(parkingTestPayload("p2", "select"))); status.Code(err) != codes.NotFound {
+		t.Fatalf("LogEvent() code = %v, want NotFound", status.Code(err))
+	}
+
+	s.parking.retryDue(ctx, time.Now().Add(10*time.Second))
+	if n := s.parking.len(); n != 0 {
+		t.Fatalf("parked events after TTL = %d, want 0", n)
+	}
+	if got := parkingExpiredTotal.Value() - expired; got != 1 {
+		t.Errorf("expired = %d, want 1", got)
+	}
+}
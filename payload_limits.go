@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+var payloadRejectedTotal = newCounter("recorder_payload_rejected_total", "Requests rejected by the size and JSON complexity limits.")
+
+var errJSONTooComplex = errors.New("JSON too complex")
+
+// jsonLimits bounds the nesting depth and array length of decoded JSON (0 = unlimited).
+type jsonLimits struct {
+	MaxDepth    int
+	MaxArrayLen int
+}
+
+// check walks b token by token, so an over-limit document is rejected without building it.
+// Syntax errors are left to the caller's decoder.
+func (l jsonLimits) check(b []byte) error {
+	if l.MaxDepth <= 0 && l.MaxArrayLen <= 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	// lens[i] counts the values seen in the i-th open container; -1 marks an object.
+	var lens []int
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		if len(lens) > 0 && lens[len(lens)-1] >= 0 {
+			if d, ok := tok.(json.Delim); !ok || d == '[' || d == '{' {
+				lens[len(lens)-1]++
+				if l.MaxArrayLen > 0 && lens[len(lens)-1] > l.MaxArrayLen {
+					return fmt.Errorf("%w: array longer than %d elements", errJSONTooComplex, l.MaxArrayLen)
+				}
+			}
+		}
+		switch tok {
+		case json.Delim('['), json.Delim('{'):
+			open := -1
+			if tok == json.Delim('[') {
+				open = 0
+			}
+			lens = append(lens, open)
+			if l.MaxDepth > 0 && len(lens) > l.MaxDepth {
+				return fmt.Errorf("%w: nested deeper than %d levels", errJSONTooComplex, l.MaxDepth)
+			}
+		case json.Delim(']'), json.Delim('}'):
+			lens = lens[:len(lens)-1]
+		}
+	}
+}
+
+// limitBody caps the request body at maxBytes (0 = unlimited). It wraps authentication too,
+// since HMAC verification reads the whole body.
+func limitBody(maxBytes int64, next http.HandlerFunc) http.HandlerFunc {
+	if maxBytes <= 0 {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > maxBytes {
+			rejectTooLarge(w, r, fmt.Errorf("body of %d bytes exceeds the %d byte limit", r.ContentLength, maxBytes))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		next(w, r)
+	}
+}
+
+// isTooLarge reports whether err comes from the body or JSON complexity limits.
+func isTooLarge(err error) bool {
+	var maxBytes *http.MaxBytesError
+	return errors.As(err, &maxBytes) || errors.Is(err, errJSONTooComplex)
+}
+
+func rejectTooLarge(w http.ResponseWriter, r *http.Request, err error) {
+	payloadRejectedTotal.Inc()
+	fmt.Printf("[HTTP] Rejected %s %s from %s: %v\n", r.Method, r.URL.Path, r.RemoteAddr, err)
+	http.Error(w, "Request too large: "+err.Error(), http.StatusRequestEntityTooLarge)
+}
+
+// readLimitedJSON reads a JSON body and checks it against l before it is decoded.
+func readLimitedJSON(body io.Reader, l jsonLimits) ([]byte, error) {
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	return b, l.check(b)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestJSONLimitsCheck(t *testing.T) {
+	l := jsonLimits{MaxDepth: 3, MaxArrayLen: 3}
+	cases := []struct {
+		name string
+		json string
+		ok   bool
+	}{
+		{"flat", `{"a":1,"b":"x","c":[1,2,3]}`, true},
+		{"depth at limit", `{"a":{"b":[1]}}`, true},
+		{"too deep", `{"a":{"b":{"c":[1]}}}`, false},
+		{"array too long", `{"a":[1,2,3,4]}`, false},
+		{"nested containers count as elements", `[[],{},[],{}]`, false},
+		{"object keys are not elements", `{"a":1,"b":2,"c":3,"d":4}`, true},
+		{"syntax errors are left to the decoder", `{"a":`, true},
+	}
+	for _, tc := range cases {
+		err := l.check([]byte(tc.json))
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: check() error = %v, want ok=%v", tc.name, err, tc.ok)
+		}
+		if err != nil && !errors.Is(err, errJSONTooComplex) {
+			t.Errorf("%s: error %v is not errJSONTooComplex", tc.name, err)
+		}
+	}
+	if err := (jsonLimits{}).check([]byte(strings.Repeat("[", 1000))); err != nil {
+		t.Errorf("zero limits check() error = %v, want nil", err)
+	}
+}
+
+func TestLogEventRejectsOversizedAndComplexPayloads(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	mr.Set(createTransactionKey("t1", "https://s"), `{"apiList":[]}`)
+
+	payload := parkingTestPayload("p1", "search")
+	s := &recorderServer{rdb: rdb, cfg: config{SkipNOPush: true, SkipDBSave: true, Env: "test", GRPCMaxRecvBytes: len(payload) - 1}, httpClient: http.DefaultClient}
+	rejected := payloadRejectedTotal.Value()
+
+	if _, err := s.LogEvent(ctx, wrapperspb.Bytes(payload)); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("oversized payload code = %v, want InvalidArgument", status.Code(err))
+	}
+
+	s.cfg.GRPCMaxRecvBytes = 0
+	s.cfg.JSONLimits = jsonLimits{MaxDepth: 2}
+	if _, err := s.LogEvent(ctx, wrapperspb.Bytes(payload)); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("deep payload code = %v, want InvalidArgument", status.Code(err))
+	}
+	if got := payloadRejectedTotal.Value() - rejected; got != 2 {
+		t.Errorf("payload rejected delta = %d, want 2", got)
+	}
+
+	s.cfg.JSONLimits = jsonLimits{MaxDepth: 8, MaxArrayLen: 100}
+	if _, err := s.LogEvent(ctx, wrapperspb.Bytes(payload)); err != nil {
+		t.Fatalf("LogEvent within limits error = %v", err)
+	}
+}
+
+func TestHTTPFormBodyLimits(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	mr.Set(createTransactionKey("t1", "https://s"), `{"apiList":[]}`)
+
+	srv := httptest.NewServer(buildHTTPMux(httpDeps{rdb: rdb, maxBody: 256, jsonLimits: jsonLimits{MaxDepth: 3, MaxArrayLen: 5}}))
+	defer srv.Close()
+
+	post := func(contentType, body string) int {
+		resp, err := http.Post(srv.URL+"/html-form", contentType, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST request error: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	base := `"transaction_id":"t1","subscriber_url":"https://s","form_action_id":"f1"`
+	cases := []struct {
+		name, contentType, body string
+		want                    int
+	}{
+		{"within limits", "application/json", `{` + base + `,"tags":["a","b"]}`, http.StatusOK},
+		{"body too large", "application/json", `{` + base + `,"pad":"` + strings.Repeat("x", 300) + `"}`, http.StatusRequestEntityTooLarge},
+		{"too deep", "application/json", `{` + base + `,"a":{"b":{"c":[1]}}}`, http.StatusRequestEntityTooLarge},
+		{"array too long", "application/json", `{` + base + `,"tags":[1,2,3,4,5,6]}`, http.StatusRequestEntityTooLarge},
+		{"urlencoded too large", "application/x-www-form-urlencoded", "transaction_id=t1&pad=" + strings.Repeat("x", 300), http.StatusRequestEntityTooLarge},
+	}
+	for _, tc := range cases {
+		if got := post(tc.contentType, tc.body); got != tc.want {
+			t.Errorf("%s: status = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestHTTPBodyLimitAppliesBeforeAuth(t *testing.T) {
+	auth := map[string][]httpAuthenticator{"/html-form": {&hmacAuth{secret: []byte("s"), maxSkew: time.Minute}}}
+	srv := httptest.NewServer(buildHTTPMux(httpDeps{maxBody: 16, auth: auth}))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/html-form", bytes.NewReader(bytes.Repeat([]byte("x"), 64)))
+	req.ContentLength = -1 // force a streamed body so the limit trips while HMAC reads it
+	ts := time.Now().Unix()
+	req.Header.Set("X-Signature-Timestamp", strconv.FormatInt(ts, 10))
+	req.Header.Set("X-Signature", "sig")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %v, want %v", resp.StatusCode, http.StatusRequestEntityTooLarge)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/time/rate"
+)
+
+const rateLimitIdleTTL = 10 * time.Minute
+
+var (
+	rateLimitedTotal = newCounter("recorder_rate_limited_total", "Requests rejected by the per-subscriber or per-transaction rate limits.")
+	loadShedTotal    = newCounter("recorder_load_shed_total", "Requests rejected by the concurrency limiter.")
+	inFlightGauge    = newGauge("recorder_inflight_requests", "Requests currently being processed.")
+	redisLatencyEWMA = newGauge("recorder_redis_latency_ewma_us", "Moving average of Redis command latency, in microseconds.")
+)
+
+// rateLimit is a token bucket: RPS tokens per second, up to Burst.
+type rateLimit struct {
+	RPS   float64 `json:"rps"`
+	Burst int     `json:"burst"`
+}
+
+func (l rateLimit) enabled() bool { return l.RPS > 0 }
+
+// rateLimitRules are the token buckets applied per subscriber_url and per transaction.
+// Subscribers overrides the per-subscriber bucket for specific subscriber URLs.
+type rateLimitRules struct {
+	Subscriber  rateLimit            `json:"subscriber"`
+	Transaction rateLimit            `json:"transaction"`
+	Subscribers map[string]rateLimit `json:"subscribers"`
+}
+
+// loadRateLimitRules reads rules from a JSON file over the env defaults in base.
+func loadRateLimitRules(path string, base rateLimitRules) (rateLimitRules, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return base, err
+	}
+	rules := base
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return base, fmt.Errorf("parse rate limits %s: %w", path, err)
+	}
+	normalized := map[string]rateLimit{}
+	for u, l := range rules.Subscribers {
+		normalized[strings.TrimRight(strings.TrimSpace(u), "/")] = l
+	}
+	rules.Subscribers = normalized
+	return rules, nil
+}
+
+type rateBucket struct {
+	lim      *rate.Limiter
+	lastSeen time.Time
+}
+
+// rateLimiter keeps one token bucket per subscriber and per transaction; idle buckets are
+// dropped after rateLimitIdleTTL.
+type rateLimiter struct {
+	rules rateLimitRules
+
+	mu        sync.Mutex
+	buckets   map[string]*rateBucket
+	lastSweep time.Time
+}
+
+func newRateLimiter(rules rateLimitRules) *rateLimiter {
+	return &rateLimiter{rules: rules, buckets: map[string]*rateBucket{}}
+}
+
+// allow takes a token from the subscriber's and the transaction's buckets. When either is
+// empty it takes none and returns the scope that refused and how long until a token is free.
+func (rl *rateLimiter) allow(subscriberURL, transactionID string) (bool, time.Duration, string) {
+	if rl == nil {
+		return true, 0, ""
+	}
+	now := time.Now()
+	subscriberURL = strings.TrimRight(strings.TrimSpace(subscriberURL), "/")
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if now.Sub(rl.lastSweep) > time.Minute {
+		for k, b := range rl.buckets {
+			if now.Sub(b.lastSeen) > rateLimitIdleTTL {
+				delete(rl.buckets, k)
+			}
+		}
+		rl.lastSweep = now
+	}
+
+	subLimit := rl.rules.Subscriber
+	if l, ok := rl.rules.Subscribers[subscriberURL]; ok {
+		subLimit = l
+	}
+	checks := []struct {
+		scope, key string
+		limit      rateLimit
+	}{
+		{"subscriber", "s::" + subscriberURL, subLimit},
+		{"transaction", "t::" + createTransactionKey(transactionID, subscriberURL), rl.rules.Transaction},
+	}
+	var taken []*rate.Reservation
+	for _, c := range checks {
+		if !c.limit.enabled() {
+			continue
+		}
+		r := rl.bucket(c.key, c.limit, now).ReserveN(now, 1)
+		if delay := r.DelayFrom(now); !r.OK() || delay > 0 {
+			r.CancelAt(now)
+			for _, t := range taken {
+				t.CancelAt(now)
+			}
+			if !r.OK() {
+				delay = time.Second
+			}
+			rateLimitedTotal.Inc()
+			return false, delay, c.scope
+		}
+		taken = append(taken, r)
+	}
+	return true, 0, ""
+}
+
+func (rl *rateLimiter) bucket(key string, limit rateLimit, now time.Time) *rate.Limiter {
+	b, ok := rl.buckets[key]
+	if !ok {
+		burst := limit.Burst
+		if burst <= 0 {
+			burst = int(math.Max(1, math.Ceil(limit.RPS)))
+		}
+		b = &rateBucket{lim: rate.NewLimiter(rate.Limit(limit.RPS), burst)}
+		rl.buckets[key] = b
+	}
+	b.lastSeen = now
+	return b.lim
+}
+
+// loadShedder caps concurrent requests. The cap is maxInFlight (0 = unlimited) normally, and
+// drops to degradedMaxInFlight while the moving average of Redis latency is above
+// latencyThreshold (0 disables shedding on latency).
+type loadShedder struct {
+	maxInFlight         int64
+	degradedMaxInFlight int64
+	latencyThreshold    time.Duration
+
+	inFlight atomic.Int64
+	ewma     atomic.Int64 // nanoseconds
+}
+
+func newLoadShedder(maxInFlight, degradedMaxInFlight int, latencyThreshold time.Duration) *loadShedder {
+	return &loadShedder{maxInFlight: int64(maxInFlight), degradedMaxInFlight: int64(degradedMaxInFlight), latencyThreshold: latencyThreshold}
+}
+
+func (l *loadShedder) degraded() bool {
+	return l.latencyThreshold > 0 && time.Duration(l.ewma.Load()) > l.latencyThreshold
+}
+
+func (l *loadShedder) limit() int64 {
+	if l.degraded() && (l.maxInFlight == 0 || l.degradedMaxInFlight < l.maxInFlight) {
+		return l.degradedMaxInFlight
+	}
+	return l.maxInFlight
+}
+
+// acquire admits a request if it fits under the current cap; the caller must call release.
+func (l *loadShedder) acquire() (release func(), ok bool) {
+	if l == nil {
+		return func() {}, true
+	}
+	n := l.inFlight.Add(1)
+	if limit := l.limit(); limit > 0 && n > limit {
+		l.inFlight.Add(-1)
+		loadShedTotal.Inc()
+		return nil, false
+	}
+	inFlightGauge.Set(n)
+	return func() { inFlightGauge.Set(l.inFlight.Add(-1)) }, true
+}
+
+// observe folds a Redis command latency into the moving average (weight 1/8).
+func (l *loadShedder) observe(d time.Duration) {
+	for {
+		old := l.ewma.Load()
+		next := old + (int64(d)-old)/8
+		if old == 0 {
+			next = int64(d)
+		}
+		if l.ewma.CompareAndSwap(old, next) {
+			redisLatencyEWMA.Set(next / int64(time.Microsecond))
+			return
+		}
+	}
+}
+
+// redisHook feeds the latency of every Redis command and pipeline into the shedder.
+func (l *loadShedder) redisHook() redis.Hook { return redisLatencyHook{l} }
+
+type redisLatencyHook struct{ l *loadShedder }
+
+func (h redisLatencyHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h redisLatencyHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		h.l.observe(time.Since(start))
+		return err
+	}
+}
+
+func (h redisLatencyHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+		h.l.observe(time.Since(start))
+		return err
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestRateLimiterPerSubscriberAndTransaction(t *testing.T) {
+	rl := newRateLimiter(rateLimitRules{
+		Subscriber:  rateLimit{RPS: 1, Burst: 3},
+		Transaction: rateLimit{RPS: 1, Burst: 2},
+	})
+	for i := 0; i < 2; i++ {
+		if ok, _, _ := rl.allow("https://s", "t1"); !ok {
+			t.Fatalf("allow #%d = false, want true", i)
+		}
+	}
+	ok, retry, scope := rl.allow("https://s", "t1")
+	if ok || scope != "transaction" || retry <= 0 {
+		t.Fatalf("allow = (%v, %v, %q), want transaction refusal with a retry hint", ok, retry, scope)
+	}
+	// The refused call did not consume the subscriber token.
+	if ok, _, _ := rl.allow("https://s/", "t2"); !ok {
+		t.Fatal("allow for a new transaction = false, want true")
+	}
+	if ok, _, scope := rl.allow("https://s", "t3"); ok || scope != "subscriber" {
+		t.Fatalf("allow = (%v, %q), want subscriber refusal", ok, scope)
+	}
+	if ok, _, _ := rl.allow("https://other", "t1"); !ok {
+		t.Fatal("allow for another subscriber = false, want true")
+	}
+}
+
+func TestRateLimiterNilAllowsEverything(t *testing.T) {
+	var rl *rateLimiter
+	if ok, _, _ := rl.allow("https://s", "t1"); !ok {
+		t.Fatal("nil limiter refused a call")
+	}
+}
+
+func TestLoadRateLimitRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limits.json")
+	os.WriteFile(path, []byte(`{"transaction":{"rps":2},"subscribers":{" https://vip/ ":{"rps":100,"burst":200}}}`), 0o600)
+
+	rules, err := loadRateLimitRules(path, rateLimitRules{Subscriber: rateLimit{RPS: 5, Burst: 5}})
+	if err != nil {
+		t.Fatalf("loadRateLimitRules error = %v", err)
+	}
+	if rules.Subscriber.RPS != 5 || rules.Transaction.RPS != 2 {
+		t.Errorf("rules = %+v, want env subscriber limit kept and transaction limit from file", rules)
+	}
+	if l := rules.Subscribers["https://vip"]; l.RPS != 100 || l.Burst != 200 {
+		t.Errorf("subscriber override = %+v", l)
+	}
+
+	os.WriteFile(path, []byte(`{`), 0o600)
+	if _, err := loadRateLimitRules(path, rateLimitRules{}); err == nil {
+		t.Error("expected parse error")
+	}
+}
+
+func TestLoadShedderDegradesOnRedisLatency(t *testing.T) {
+	l := newLoadShedder(3, 1, 10*time.Millisecond)
+	release, ok := l.acquire()
+	if !ok {
+		t.Fatal("first acquire refused")
+	}
+	if _, ok := l.acquire(); !ok {
+		t.Fatal("second acquire refused under the normal cap")
+	}
+	l.inFlight.Add(-1)
+
+	l.observe(50 * time.Millisecond)
+	shed := loadShedTotal.Value()
+	if _, ok := l.acquire(); ok {
+		t.Fatal("acquire admitted above the degraded cap")
+	}
+	if got := loadShedTotal.Value() - shed; got != 1 {
+		t.Errorf("load shed delta = %d, want 1", got)
+	}
+	release()
+
+	for i := 0; i < 40; i++ {
+		l.observe(time.Millisecond)
+	}
+	if l.degraded() {
+		t.Error("still degraded after latency recovered")
+	}
+}
+
+func TestLogEventRateLimited(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	mr.Set(createTransactionKey("t1", "https://s"), `{"apiList":[]}`)
+
+	s := &recorderServer{rdb: rdb, cfg: config{SkipNOPush: true, SkipDBSave: true, Env: "test"}, httpClient: http.DefaultClient}
+	s.limits = newRateLimiter(rateLimitRules{Subscriber: rateLimit{RPS: 0.5, Burst: 1}})
+
+	if _, err := s.LogEvent(ctx, wrapperspb.Bytes(parkingTestPayload("p1", "search"))); err != nil {
+		t.Fatalf("LogEvent error = %v", err)
+	}
+	_, err := s.LogEvent(ctx, wrapperspb.Bytes(parkingTestPayload("p2", "on_search")))
+	st := status.Convert(err)
+	if st.Code() != codes.ResourceExhausted {
+		t.Fatalf("code = %v, want ResourceExhausted", st.Code())
+	}
+	var retry *errdetails.RetryInfo
+	for _, d := range st.Details() {
+		if ri, ok := d.(*errdetails.RetryInfo); ok {
+			retry = ri
+		}
+	}
+	if retry == nil || retry.GetRetryDelay().AsDuration() <= 0 {
+		t.Errorf("RetryInfo = %v, want a positive retry delay", retry)
+	}
+}
+
+func TestLoadShedUnaryInterceptor(t *testing.T) {
+	l := newLoadShedder(1, 1, 0)
+	intercept := loadShedUnaryInterceptor(l)
+	info := &grpc.UnaryServerInfo{FullMethod: "/beckn.audit.v1.AuditService/LogEvent"}
+
+	_, err := intercept(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+		_, err := intercept(ctx, nil, info, func(context.Context, any) (any, error) { return nil, nil })
+		return nil, err
+	})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("nested call code = %v, want ResourceExhausted", status.Code(err))
+	}
+	if n := l.inFlight.Load(); n != 0 {
+		t.Errorf("in flight after calls = %d, want 0", n)
+	}
+}
+
+func TestUnaryInterceptorsAuthenticateBeforeShedding(t *testing.T) {
+	l := newLoadShedder(1, 1, 0)
+	release, _ := l.acquire()
+	defer release()
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/beckn.audit.v1.AuditService/LogEvent"}
+	interceptors := unaryInterceptors(config{GRPCAuthTokens: map[string]string{"tok": "svc"}}, l)
+	var handler grpc.UnaryHandler = func(context.Context, any) (any, error) { return nil, nil }
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		intercept, next := interceptors[i], handler
+		handler = func(ctx context.Context, req any) (any, error) { return intercept(ctx, req, info, next) }
+	}
+	shed := loadShedTotal.Value()
+	if _, err := handler(context.Background(), nil); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("unauthenticated call while saturated: code = %v, want Unauthenticated", status.Code(err))
+	}
+	if got := loadShedTotal.Value() - shed; got != 0 {
+		t.Errorf("shed count = %d, want 0 (rejected before shedding)", got)
+	}
+}
+
+func TestHTTPFormRateLimited(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	mr.Set(createTransactionKey("t1", "https://s"), `{"apiList":[]}`)
+
+	limits := newRateLimiter(rateLimitRules{Transaction: rateLimit{RPS: 0.1, Burst: 1}})
+	srv := httptest.NewServer(buildHTTPMux(httpDeps{rdb: rdb, limits: limits}))
+	defer srv.Close()
+
+	post := func() *http.Response {
+		b, _ := json.Marshal(map[string]any{"transaction_id": "t1", "subscriber_url": "https://s", "form_action_id": "f1"})
+		resp, err := http.Post(srv.URL+"/html-form", "application/json", bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("POST request error: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	if resp := post(); resp.StatusCode != http.StatusOK {
+		t.Fatalf("first status = %v, want %v", resp.StatusCode, http.StatusOK)
+	}
+	resp := post()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("second status = %v, want %v", resp.StatusCode, http.StatusTooManyRequests)
+	}
+	if got := resp.Header.Get("Retry-After"); got == "" || got == "0" {
+		t.Errorf("Retry-After = %q, want a positive number of seconds", got)
+	}
+}
+
+func TestHTTPFormShedsLoad(t *testing.T) {
+	l := newLoadShedder(1, 1, 0)
+	release, _ := l.acquire()
+	defer release()
+
+	srv := httptest.NewServer(buildHTTPMux(httpDeps{shedder: l}))
+	defer srv.Close()
+	resp, err := http.Post(srv.URL+"/html-form", "application/json", bytes.NewReader([]byte(`{}`)))
+	if err != nil {
+		t.Fatalf("POST request error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") != "1" {
+		t.Errorf("status = %v, Retry-After = %q; want 503 with Retry-After 1", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// replayEvent is one event to re-send, in the LogEvent JSON shape. Archive lines (see
+// sink_archive.go) and exported LogEvent payloads both decode into it.
+type replayEvent struct {
+	RequestBody    map[string]any `json:"requestBody"`
+	ResponseBody   map[string]any `json:"responseBody"`
+	AdditionalData map[string]any `json:"additionalData"`
+
+	// ReceivedAt (archive lines) or else additionalData.timestamp paces the replay.
+	ReceivedAt string `json:"receivedAt,omitempty"`
+	// Result is the recorder's outcome on archive lines; duplicates are not replayed.
+	Result string `json:"result,omitempty"`
+}
+
+func (e *replayEvent) at() time.Time {
+	for _, s := range []string{e.ReceivedAt, getString(e.AdditionalData, "timestamp")} {
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (e *replayEvent) transactionID() string { return getString(e.AdditionalData, "transaction_id") }
+func (e *replayEvent) action() string        { return getString(e.AdditionalData, "action") }
+
+// replayOptions select and reshape the events to replay.
+type replayOptions struct {
+	// Speed scales the original gaps between events: 1 replays them in real time, 2 twice as
+	// fast; 0 sends as fast as possible.
+	Speed float64
+	// Actions keeps only these actions (empty = all).
+	Actions map[string]bool
+	// RewriteTransaction replaces the transaction ID: "auto" gives each original transaction a
+	// fresh UUID, any other non-empty value is used as is. Rewritten events get new payload IDs,
+	// and the db sink saves nothing for them unless the new transaction is already cached.
+	RewriteTransaction string
+	DryRun             bool
+}
+
+// replayTarget receives replayed events.
+type replayTarget interface {
+	send(ctx context.Context, ev *replayEvent) error
+}
+
+// readReplayFile reads one event per line; blank lines and archived duplicates are skipped.
+func readReplayFile(r io.Reader) ([]*replayEvent, error) {
+	var events []*replayEvent
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64<<10), 64<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		var ev replayEvent
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if ev.RequestBody == nil || ev.AdditionalData == nil {
+			return nil, fmt.Errorf("line %d: requestBody and additionalData are required", n)
+		}
+		if ev.Result == recorderResultDup {
+			continue
+		}
+		if ev.ResponseBody == nil {
+			ev.ResponseBody = map[string]any{}
+		}
+		events = append(events, &ev)
+	}
+	return events, sc.Err()
+}
+
+// readRedisEvents rebuilds events from a transaction's apiList. The cache keeps responses but
+// not request bodies, so each requestBody carries only a context built from the entry.
+func readRedisEvents(ctx context.Context, rdb *redis.Client, transactionID, subscriberURL string) ([]*replayEvent, error) {
+	key := createTransactionKey(transactionID, subscriberURL)
+	if key == "" {
+		return nil, fmt.Errorf("transaction ID and subscriber URL are required")
+	}
+	val, err := rdb.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("transaction %s not found", key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var txn map[string]any
+	if err := json.Unmarshal([]byte(val), &txn); err != nil {
+		return nil, fmt.Errorf("transaction %s: %w", key, err)
+	}
+	apiList, _ := txn["apiList"].([]any)
+	var events []*replayEvent
+	for _, it := range apiList {
+		entry, ok := it.(map[string]any)
+		if !ok || (getString(entry, "entryType") != "" && getString(entry, "entryType") != "API") {
+			continue
+		}
+		response, _ := entry["response"].(map[string]any)
+		if response == nil {
+			response = map[string]any{}
+		}
+		ad := map[string]any{
+			"payload_id":     getString(entry, "payloadId"),
+			"transaction_id": getString(txn, "transactionId"),
+			"message_id":     getString(entry, "messageId"),
+			"subscriber_url": getString(txn, "subscriberUrl"),
+			"action":         getString(entry, "action"),
+			"timestamp":      getString(entry, "timestamp"),
+		}
+		if ad["transaction_id"] == "" {
+			ad["transaction_id"] = strings.TrimSpace(transactionID)
+		}
+		if ad["subscriber_url"] == "" {
+			ad["subscriber_url"] = strings.TrimRight(strings.TrimSpace(subscriberURL), "/")
+		}
+		if getBool(entry, "isMock") {
+			ad["is_mock"] = true
+		}
+		if ttl := getInt64(entry, "ttl"); ttl > 0 {
+			ad["ttl_seconds"] = ttl
+		}
+		reqContext := map[string]any{
+			"transaction_id": ad["transaction_id"],
+			"message_id":     ad["message_id"],
+			"action":         ad["action"],
+			"timestamp":      ad["timestamp"],
+		}
+		events = append(events, &replayEvent{
+			RequestBody:    map[string]any{"context": reqContext},
+			ResponseBody:   response,
+			AdditionalData: ad,
+			ReceivedAt:     getString(entry, "realTimestamp"),
+		})
+	}
+	return events, nil
+}
+
+// prepareReplay filters events by action and applies the transaction ID rewrite.
+func prepareReplay(events []*replayEvent, opts replayOptions) ([]*replayEvent, error) {
+	rewritten := map[string]string{}
+	var out []*replayEvent
+	for _, ev := range events {
+		if len(opts.Actions) > 0 && !opts.Actions[ev.action()] {
+			continue
+		}
+		if opts.RewriteTransaction != "" {
+			old := ev.transactionID()
+			id, ok := rewritten[old]
+			if !ok {
+				id = opts.RewriteTransaction
+				if id == "auto" {
+					var err error
+					if id, err = uuidV4(); err != nil {
+						return nil, err
+					}
+				}
+				rewritten[old] = id
+			}
+			ev.AdditionalData["transaction_id"] = id
+			delete(ev.AdditionalData, "payload_id")
+			if c, ok := ev.RequestBody["context"].(map[string]any); ok {
+				c["transaction_id"] = id
+			}
+		}
+		out = append(out, ev)
+	}
+	return out, nil
+}
+
+// replayDelay is how long to wait before sending an event at cur after one at prev.
+func replayDelay(prev, cur time.Time, speed float64) time.Duration {
+	if speed <= 0 || prev.IsZero() || cur.IsZero() || !cur.After(prev) {
+		return 0
+	}
+	return time.Duration(float64(cur.Sub(prev)) / speed)
+}
+
+// replay sends events to target in order, paced by opts.Speed, and returns how many were sent
+// and failed. In dry-run mode events are only printed.
+func replay(ctx context.Context, events []*replayEvent, target replayTarget, opts replayOptions, out io.Writer) (sent, failed int) {
+	var prev time.Time
+	for i, ev := range events {
+		at := ev.at()
+		if d := replayDelay(prev, at, opts.Speed); d > 0 && !opts.DryRun {
+			select {
+			case <-ctx.Done():
+				return sent, failed
+			case <-time.After(d):
+			}
+		}
+		if !at.IsZero() {
+			prev = at
+		}
+		if opts.DryRun {
+			fmt.Fprintf(out, "[REPLAY] dry-run %d/%d: transaction %s action %s payload %s\n", i+1, len(events), ev.transactionID(), ev.action(), getString(ev.AdditionalData, "payload_id"))
+			sent++
+			continue
+		}
+		if err := target.send(ctx, ev); err != nil {
+			fmt.Fprintf(out, "[REPLAY] ERROR: %d/%d transaction %s action %s: %v\n", i+1, len(events), ev.transactionID(), ev.action(), err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(out, "[REPLAY] Sent %d/%d: transaction %s action %s\n", i+1, len(events), ev.transactionID(), ev.action())
+		sent++
+	}
+	return sent, failed
+}
+
+// grpcReplayTarget calls LogEvent on a recorder.
+type grpcReplayTarget struct {
+	conn  *grpc.ClientConn
+	token string
+}
+
+func (t *grpcReplayTarget) send(ctx context.Context, ev *replayEvent) error {
+	b, err := json.Marshal(auditPayload{RequestBody: ev.RequestBody, ResponseBody: ev.ResponseBody, AdditionalData: ev.AdditionalData})
+	if err != nil {
+		return err
+	}
+	if t.token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+t.token)
+	}
+	return t.conn.Invoke(ctx, grpcFullMethod, wrapperspb.Bytes(b), &emptypb.Empty{})
+}
+
+// sinkReplayTarget hands events straight to sinks, bypassing the cache.
+type sinkReplayTarget struct {
+	sinks []Sink
+	rdb   *redis.Client
+}
+
+func (t *sinkReplayTarget) send(ctx context.Context, ev *replayEvent) error {
+	derived, err := deriveFields(auditPayload{RequestBody: ev.RequestBody, ResponseBody: ev.ResponseBody, AdditionalData: ev.AdditionalData})
+	if err != nil {
+		return err
+	}
+	if derived.PayloadID == "" {
+		derived.PayloadID, err = replayPayloadID(ev)
+		if err != nil {
+			return err
+		}
+	}
+	sev := &sinkEvent{Derived: derived, RequestBody: ev.RequestBody, ResponseBody: ev.ResponseBody, AdditionalData: ev.AdditionalData, ReceivedAt: time.Now()}
+	var errs []error
+	for _, sink := range t.sinks {
+		if !sink.Enabled(sev) {
+			continue
+		}
+		// The db sink quietly saves nothing for a transaction missing from the cache (always
+		// the case after --rewrite-transaction); count that as a failure, not a send.
+		if sink.Name() == "db" {
+			key := createTransactionKey(derived.TransactionID, derived.SubscriberURL)
+			txn, err := loadTransactionMap(ctx, t.rdb, key)
+			if err == nil && txn == nil {
+				err = fmt.Errorf("transaction %s not in the cache, nothing would be saved", key)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", sink.Name(), err))
+				continue
+			}
+		}
+		if err := sink.Handle(ctx, sev); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sink.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// replayPayloadID derives a payload ID for an event that has none from its transaction,
+// message, action and bodies, so replaying the same file twice does not duplicate payloads.
+func replayPayloadID(ev *replayEvent) (string, error) {
+	b, err := json.Marshal([]any{ev.transactionID(), getString(ev.AdditionalData, "subscriber_url"), getString(ev.AdditionalData, "message_id"), ev.action(), ev.RequestBody, ev.ResponseBody})
+	if err != nil {
+		return "", err
+	}
+	return uuidFromName(string(b)), nil
+}
+
+// runReplay implements `automationrecorder replay`. It returns the process exit code.
+func runReplay(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: automationrecorder replay [flags] [events.jsonl ...]\n\n")
+		fmt.Fprintf(stderr, "Re-sends events from JSONL files (archive lines or LogEvent payloads) or from a\n")
+		fmt.Fprintf(stderr, "transaction's apiList in Redis, to a recorder over gRPC or to the configured sinks.\n\n")
+		fs.PrintDefaults()
+	}
+	transactionID := fs.String("transaction", "", "read events from this transaction's apiList in Redis (needs --subscriber)")
+	subscriberURL := fs.String("subscriber", "", "subscriber URL of --transaction")
+	target := fs.String("target", "", "recorder gRPC address to send LogEvent to, e.g. localhost:8089")
+	toSinks := fs.Bool("to-sinks", false, "hand events to the sinks in RECORDER_SINKS instead of a recorder")
+	token := fs.String("token", "", "bearer token for --target")
+	useTLS := fs.Bool("tls", false, "use TLS to --target")
+	tlsCA := fs.String("tls-ca", "", "CA bundle to verify --target (implies --tls)")
+	speed := fs.Float64("speed", 0, "pacing: 0 = as fast as possible, 1 = original timing, 2 = twice as fast")
+	actions := fs.String("actions", "", "comma-separated actions to replay (default all)")
+	rewrite := fs.String("rewrite-transaction", "", `new transaction ID for replayed events, or "auto" for a fresh UUID per transaction`)
+	dryRun := fs.Bool("dry-run", false, "print the events that would be sent and exit")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	files := fs.Args()
+	switch {
+	case len(files) == 0 && *transactionID == "":
+		fmt.Fprintln(stderr, "replay: give JSONL files or --transaction")
+		return 2
+	case len(files) > 0 && *transactionID != "":
+		fmt.Fprintln(stderr, "replay: give JSONL files or --transaction, not both")
+		return 2
+	case !*dryRun && (*target == "") == !*toSinks:
+		fmt.Fprintln(stderr, "replay: give exactly one of --target and --to-sinks (or --dry-run)")
+		return 2
+	case *speed < 0:
+		fmt.Fprintln(stderr, "replay: --speed must be >= 0")
+		return 2
+	}
+	opts := replayOptions{Speed: *speed, Actions: parseEnvSet(*actions), RewriteTransaction: strings.TrimSpace(*rewrite), DryRun: *dryRun}
+
+	// Redis and the sinks are set up from the recorder config; keep its log off stdout.
+	var cfg config
+	if *transactionID != "" || *toSinks {
+		c, err := readConfig(stderr)
+		if err != nil {
+			fmt.Fprintf(stderr, "replay: invalid config: %v\n", err)
+			return 2
+		}
+		cfg = c
+	}
+	var rdb *redis.Client
+	if *transactionID != "" || (*toSinks && !*dryRun) {
+		rdb = newRedisClient(cfg.RedisAddr)
+		defer rdb.Close()
+	}
+
+	var events []*replayEvent
+	if *transactionID != "" {
+		evs, err := readRedisEvents(ctx, rdb, *transactionID, *subscriberURL)
+		if err != nil {
+			fmt.Fprintf(stderr, "replay: %v\n", err)
+			return 1
+		}
+		events = evs
+	}
+	for _, path := range files {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "replay: %v\n", err)
+			return 1
+		}
+		evs, err := readReplayFile(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(stderr, "replay: %s: %v\n", path, err)
+			return 1
+		}
+		events = append(events, evs...)
+	}
+	events, err := prepareReplay(events, opts)
+	if err != nil {
+		fmt.Fprintf(stderr, "replay: %v\n", err)
+		return 1
+	}
+
+	var dst replayTarget
+	switch {
+	case opts.DryRun:
+	case *toSinks:
+		sinks, err := newSinks(cfg.Sinks, sinkDeps{conf: func() config { return cfg }, rdb: rdb, httpClient: &http.Client{}})
+		if err != nil {
+			fmt.Fprintf(stderr, "replay: %v\n", err)
+			return 2
+		}
+		defer closeSinks(sinks)
+		dst = &sinkReplayTarget{sinks: sinks, rdb: rdb}
+	default:
+		creds := insecure.NewCredentials()
+		if *useTLS || *tlsCA != "" {
+			tc := &tls.Config{MinVersion: tls.VersionTLS12}
+			if *tlsCA != "" {
+				pem, err := os.ReadFile(*tlsCA)
+				if err != nil {
+					fmt.Fprintf(stderr, "replay: %v\n", err)
+					return 2
+				}
+				tc.RootCAs = x509.NewCertPool()
+				if !tc.RootCAs.AppendCertsFromPEM(pem) {
+					fmt.Fprintf(stderr, "replay: no certificates in %s\n", *tlsCA)
+					return 2
+				}
+			}
+			creds = credentials.NewTLS(tc)
+		}
+		conn, err := grpc.NewClient(*target, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			fmt.Fprintf(stderr, "replay: %v\n", err)
+			return 2
+		}
+		defer conn.Close()
+		dst = &grpcReplayTarget{conn: conn, token: *token}
+	}
+
+	sent, failed := replay(ctx, events, dst, opts, stdout)
+	fmt.Fprintf(stdout, "[REPLAY] Done: %d sent, %d failed, %d total\n", sent, failed, len(events))
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+)
+
+func writeReplayFile(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func replayLine(payloadID, txn, action, receivedAt string) string {
+	b, _ := json.Marshal(map[string]any{
+		"receivedAt":   receivedAt,
+		"derived":      map[string]any{"payload_id": payloadID},
+		"requestBody":  map[string]any{"context": map[string]any{"transaction_id": txn, "action": action}},
+		"responseBody": map[string]any{"message": map[string]any{"ack": map[string]any{"status": "ACK"}}},
+		"additionalData": map[string]any{
+			"payload_id":     payloadID,
+			"transaction_id": txn,
+			"subscriber_url": "https://s",
+			"action":         action,
+		},
+	})
+	return string(b)
+}
+
+func TestReadReplayFile(t *testing.T) {
+	in := replayLine("p1", "t1", "search", "2026-01-07T10:00:00Z") + "\n\n" +
+		`{"requestBody":{},"additionalData":{"action":"on_search","timestamp":"2026-01-07T10:00:02Z"}}` + "\n" +
+		`{"requestBody":{},"additionalData":{"action":"search"},"result":"duplicate"}` + "\n"
+	events, err := readReplayFile(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("readReplayFile() error = %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("events = %d, want 2 (the duplicate skipped)", len(events))
+	}
+	if events[0].transactionID() != "t1" || events[1].action() != "on_search" || events[1].ResponseBody == nil {
+		t.Errorf("events = %+v, %+v", events[0], events[1])
+	}
+	if got := events[1].at().Sub(events[0].at()); got != 2*time.Second {
+		t.Errorf("gap = %v, want 2s (receivedAt, then timestamp)", got)
+	}
+
+	if _, err := readReplayFile(strings.NewReader("{}\nnot json\n")); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("readReplayFile(bad) error = %v, want line 1", err)
+	}
+}
+
+func TestPrepareReplay(t *testing.T) {
+	read := func() []*replayEvent {
+		evs, _ := readReplayFile(strings.NewReader(strings.Join([]string{
+			replayLine("p1", "t1", "search", ""),
+			replayLine("p2", "t1", "on_search", ""),
+			replayLine("p3", "t9", "search", ""),
+		}, "\n")))
+		return evs
+	}
+
+	got, _ := prepareReplay(read(), replayOptions{Actions: map[string]bool{"search": true}, RewriteTransaction: "auto"})
+	if len(got) != 2 {
+		t.Fatalf("filtered events = %d, want 2", len(got))
+	}
+	a, b := got[0].transactionID(), got[1].transactionID()
+	if a == "t1" || b == "t9" || a == b {
+		t.Errorf("auto rewrite gave %q and %q, want two fresh IDs", a, b)
+	}
+	if c := got[0].RequestBody["context"].(map[string]any); c["transaction_id"] != a {
+		t.Errorf("context transaction_id = %v, want %v", c["transaction_id"], a)
+	}
+	if _, ok := got[0].AdditionalData["payload_id"]; ok {
+		t.Error("rewritten event kept its payload_id")
+	}
+
+	got, _ = prepareReplay(read(), replayOptions{RewriteTransaction: "t-new"})
+	for _, ev := range got {
+		if ev.transactionID() != "t-new" {
+			t.Errorf("transaction = %q, want t-new", ev.transactionID())
+		}
+	}
+}
+
+func TestReplayDelay(t *testing.T) {
+	t0 := time.Date(2026, 1, 7, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		prev, cur time.Time
+		speed     float64
+		want      time.Duration
+	}{
+		{t0, t0.Add(4 * time.Second), 1, 4 * time.Second},
+		{t0, t0.Add(4 * time.Second), 2, 2 * time.Second},
+		{t0, t0.Add(4 * time.Second), 0, 0},
+		{t0, t0.Add(-time.Second), 1, 0},
+		{time.Time{}, t0, 1, 0},
+	}
+	for _, tt := range tests {
+		if got := replayDelay(tt.prev, tt.cur, tt.speed); got != tt.want {
+			t.Errorf("replayDelay(%v, %v, %v) = %v, want %v", tt.prev, tt.cur, tt.speed, got, tt.want)
+		}
+	}
+}
+
+func TestReadRedisEvents(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	mr.Set(createTransactionKey("t1", "https://s"), `{"transactionId":"t1","subscriberUrl":"https://s","apiList":[
+		{"entryType":"API","action":"search","payloadId":"p1","messageId":"m1","timestamp":"2026-01-07T10:00:00Z","response":{"ok":true},"isMock":true},
+		{"entryType":"FORM","formId":"f1"},
+		{"entryType":"API","action":"on_search","payloadId":"p2","messageId":"m1","timestamp":"2026-01-07T10:00:01Z","ttl":30}
+	]}`)
+
+	events, err := readRedisEvents(ctx, rdb, "t1", "https://s/")
+	if err != nil {
+		t.Fatalf("readRedisEvents() error = %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("events = %d, want 2 API entries", len(events))
+	}
+	first := events[0]
+	if first.action() != "search" || getString(first.AdditionalData, "payload_id") != "p1" || !getBool(first.AdditionalData, "is_mock") {
+		t.Errorf("first event additionalData = %v", first.AdditionalData)
+	}
+	if first.ResponseBody["ok"] != true {
+		t.Errorf("first event responseBody = %v", first.ResponseBody)
+	}
+	if c := first.RequestBody["context"].(map[string]any); c["message_id"] != "m1" || c["transaction_id"] != "t1" {
+		t.Errorf("first event context = %v", c)
+	}
+	if _, err := readRedisEvents(ctx, rdb, "missing", "https://s"); err == nil {
+		t.Error("readRedisEvents(missing) succeeded")
+	}
+}
+
+func TestSinkReplayTarget(t *testing.T) {
+	on := &fakeSink{name: "on", enabled: true, done: make(chan struct{}, 1)}
+	off := &fakeSink{name: "off", done: make(chan struct{}, 1)}
+	events, _ := readReplayFile(strings.NewReader(replayLine("p1", "t1", "search", "")))
+
+	if err := (&sinkReplayTarget{sinks: []Sink{on, off}}).send(context.Background(), events[0]); err != nil {
+		t.Fatalf("send() error = %v", err)
+	}
+	if len(on.events) != 1 || on.events[0].Derived.TransactionID != "t1" || on.events[0].Derived.PayloadID != "p1" {
+		t.Errorf("enabled sink events = %+v", on.events)
+	}
+	if len(off.events) != 0 {
+		t.Errorf("disabled sink called %d times", len(off.events))
+	}
+}
+
+func TestSinkReplayTargetDBNeedsCachedTransaction(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	db := &fakeSink{name: "db", enabled: true, done: make(chan struct{}, 2)}
+	target := &sinkReplayTarget{sinks: []Sink{db}, rdb: rdb}
+	events, _ := readReplayFile(strings.NewReader(replayLine("p1", "t1", "search", "")))
+
+	if err := target.send(context.Background(), events[0]); err == nil || !strings.Contains(err.Error(), "not in the cache") {
+		t.Fatalf("send() for an uncached transaction error = %v", err)
+	}
+	if len(db.events) != 0 {
+		t.Fatalf("db sink called %d times for an uncached transaction", len(db.events))
+	}
+
+	mr.Set(createTransactionKey("t1", "https://s"), `{"apiList":[]}`)
+	if err := target.send(context.Background(), events[0]); err != nil {
+		t.Fatalf("send() error = %v", err)
+	}
+	if len(db.events) != 1 {
+		t.Errorf("db sink called %d times, want 1", len(db.events))
+	}
+}
+
+func TestSinkReplayTargetDerivesPayloadID(t *testing.T) {
+	sink := &fakeSink{name: "on", enabled: true, done: make(chan struct{}, 4)}
+	target := &sinkReplayTarget{sinks: []Sink{sink}}
+	lines := []string{replayLine("", "t1", "search", ""), replayLine("", "t1", "search", ""), replayLine("", "t1", "select", "")}
+	for _, line := range lines {
+		events, _ := readReplayFile(strings.NewReader(line))
+		if err := target.send(context.Background(), events[0]); err != nil {
+			t.Fatalf("send() error = %v", err)
+		}
+	}
+	first, again, other := sink.events[0].Derived.PayloadID, sink.events[1].Derived.PayloadID, sink.events[2].Derived.PayloadID
+	if first == "" || first != again {
+		t.Errorf("payload IDs for the same event = %q, %q; want equal and non-empty", first, again)
+	}
+	if other == first {
+		t.Errorf("payload ID for a different event = %q, same as the first", other)
+	}
+}
+
+func TestRunReplayToRecorder(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	mr.Set(createTransactionKey("t2", "https://s"), `{"apiList":[]}`)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := grpc.NewServer()
+	registerAuditService(gs, &recorderServer{rdb: rdb, cfg: config{SkipNOPush: true, SkipDBSave: true, Env: "test"}, httpClient: http.DefaultClient})
+	go func() { _ = gs.Serve(lis) }()
+	t.Cleanup(gs.Stop)
+
+	path := writeReplayFile(t,
+		replayLine("p1", "t1", "search", "2026-01-07T10:00:00Z"),
+		replayLine("p2", "t1", "on_search", "2026-01-07T10:00:00.05Z"),
+		replayLine("p3", "t1", "select", "2026-01-07T10:00:00.1Z"),
+	)
+	var out, errOut bytes.Buffer
+	code := runReplay(ctx, []string{"--target", lis.Addr().String(), "--rewrite-transaction", "t2", "--actions", "search,on_search", "--speed", "1", path}, &out, &errOut)
+	if code != 0 {
+		t.Fatalf("runReplay() = %d, stdout %q, stderr %q", code, out.String(), errOut.String())
+	}
+	if !strings.Contains(out.String(), "2 sent, 0 failed") {
+		t.Errorf("stdout = %q", out.String())
+	}
+
+	var txn map[string]any
+	json.Unmarshal([]byte(mustGet(t, mr, createTransactionKey("t2", "https://s"))), &txn)
+	apiList, _ := txn["apiList"].([]any)
+	if len(apiList) != 2 {
+		t.Fatalf("t2 apiList has %d entries, want 2", len(apiList))
+	}
+	if a := apiList[1].(map[string]any)["action"]; a != "on_search" {
+		t.Errorf("second entry action = %v", a)
+	}
+}
+
+func TestRunReplayDryRunAndUsage(t *testing.T) {
+	path := writeReplayFile(t, replayLine("p1", "t1", "search", ""))
+	var out, errOut bytes.Buffer
+	if code := runReplay(context.Background(), []string{"--dry-run", path}, &out, &errOut); code != 0 {
+		t.Fatalf("dry run = %d, stderr %q", code, errOut.String())
+	}
+	if !strings.Contains(out.String(), "dry-run 1/1: transaction t1 action search payload p1") {
+		t.Errorf("dry-run stdout = %q", out.String())
+	}
+
+	for _, args := range [][]string{
+		{path},
+		{"--target", "x:1", "--to-sinks", path},
+		{"--dry-run"},
+		{"--dry-run", "--speed", "-1", path},
+	} {
+		out.Reset()
+		errOut.Reset()
+		if code := runReplay(context.Background(), args, &out, &errOut); code != 2 {
+			t.Errorf("runReplay(%v) = %d, want 2", args, code)
+		}
+	}
+}
+
+func mustGet(t *testing.T, mr *miniredis.Miniredis, key string) string {
+	t.Helper()
+	v, err := mr.Get(key)
+	if err != nil {
+		t.Fatalf("get %s: %v", key, err)
+	}
+	return v
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// Schema validation modes (RECORDER_SCHEMA_VALIDATION).
+const (
+	schemaValidationOff   = "off"
+	schemaValidationSync  = "sync"
+	schemaValidationAsync = "async"
+)
+
+// payloadValidator checks a recorded requestBody against the schema for its action, domain and
+// version. It returns nil when no schema applies, so the payload is left unannotated.
+type payloadValidator interface {
+	Validate(action, domain, version string, payload map[string]any) *schemaValidationResult
+}
+
+// schemaValidationResult is stored on the apiList entry and sent to the DB as schemaValidation.
+type schemaValidationResult struct {
+	Valid  bool          `json:"valid"`
+	Schema string        `json:"schema"`
+	Errors []schemaError `json:"errors,omitempty"`
+}
+
+type schemaError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// dirSchemaValidator loads schema bundles laid out as <dir>/<domain>/<version>/<action>.json.
+// Schemas are compiled on first use and cached, as are compile failures; a missing file is
+// looked up again each time.
+type dirSchemaValidator struct {
+	dir string
+
+	mu       sync.Mutex
+	compiler *jsonschema.Compiler
+	schemas  map[string]compiledSchema // by path relative to dir
+}
+
+// compiledSchema is a schema file's compile result: the schema, or why it failed to compile.
+type compiledSchema struct {
+	sch *jsonschema.Schema
+	err error
+}
+
+func newDirSchemaValidator(dir string) (*dirSchemaValidator, error) {
+	dir = strings.TrimSpace(dir)
+	if dir == "" {
+		return nil, fmt.Errorf("schema directory is required")
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("schema path %s is not a directory", dir)
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &dirSchemaValidator{dir: abs, compiler: jsonschema.NewCompiler(), schemas: map[string]compiledSchema{}}, nil
+}
+
+func (v *dirSchemaValidator) Validate(action, domain, version string, payload map[string]any) *schemaValidationResult {
+	action, domain, version = strings.TrimSpace(action), strings.TrimSpace(domain), strings.TrimSpace(version)
+	if action == "" || domain == "" || version == "" {
+		return nil
+	}
+	rel := filepath.Join(domain, version, action+".json")
+	sch, err := v.schema(rel)
+	if err != nil {
+		fmt.Printf("[SCHEMA] ERROR: Failed to compile schema %s: %v\n", rel, err)
+		return &schemaValidationResult{Valid: false, Schema: rel, Errors: []schemaError{{Path: "", Message: "schema compile failed: " + err.Error()}}}
+	}
+	if sch == nil {
+		return nil
+	}
+
+	res := &schemaValidationResult{Valid: true, Schema: rel}
+	if err := sch.Validate(any(payload)); err != nil {
+		res.Valid = false
+		if ve, ok := err.(*jsonschema.ValidationError); ok {
+			res.Errors = flattenSchemaErrors(ve, nil)
+		} else {
+			res.Errors = []schemaError{{Path: "", Message: err.Error()}}
+		}
+	}
+	return res
+}
+
+// schema returns the compiled schema at rel, or nil if the bundle has no such file. Misses are
+// not cached: rel comes from the payload, so callers could otherwise grow the map at will.
+// Compile failures are, since they name a file that exists in the bundle.
+func (v *dirSchemaValidator) schema(rel string) (*jsonschema.Schema, error) {
+	v.mu.Lock()
+	c, ok := v.schemas[rel]
+	v.mu.Unlock()
+	if ok {
+		return c.sch, c.err
+	}
+	path := filepath.Join(v.dir, rel)
+	// Keep lookups inside the bundle; domain/version/action come from the payload.
+	if !strings.HasPrefix(path, v.dir+string(filepath.Separator)) {
+		return nil, fmt.Errorf("schema path %s escapes %s", rel, v.dir)
+	}
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// The compiler is not safe for concurrent use; this runs once per schema file.
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if c, ok := v.schemas[rel]; ok {
+		return c.sch, c.err
+	}
+	sch, err := v.compiler.Compile(path)
+	v.schemas[rel] = compiledSchema{sch: sch, err: err}
+	return sch, err
+}
+
+var schemaErrorPrinter = message.NewPrinter(language.English)
+
+// flattenSchemaErrors returns the leaf causes of ve as JSON-pointer paths and messages.
+func flattenSchemaErrors(ve *jsonschema.ValidationError, out []schemaError) []schemaError {
+	if len(ve.Causes) == 0 {
+		path := ""
+		for _, tok := range ve.InstanceLocation {
+			path += "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(tok)
+		}
+		return append(out, schemaError{Path: path, Message: ve.ErrorKind.LocalizedString(schemaErrorPrinter)})
+	}
+	for _, c := range ve.Causes {
+		out = flattenSchemaErrors(c, out)
+	}
+	return out
+}
+
+// schemaCheck runs a validation at most once and shares the result between the cache append,
+// the async annotate job and the DB save, whichever asks first.
+type schemaCheck struct {
+	once   sync.Once
+	run    func() *schemaValidationResult
+	result *schemaValidationResult
+}
+
+func newSchemaCheck(v payloadValidator, action string, requestBody map[string]any) *schemaCheck {
+	if v == nil {
+		return nil
+	}
+	return &schemaCheck{run: func() *schemaValidationResult {
+		return v.Validate(action, getContextString(requestBody, "domain"), getContextVersion(requestBody), requestBody)
+	}}
+}
+
+func (c *schemaCheck) Result() *schemaValidationResult {
+	if c == nil {
+		return nil
+	}
+	c.once.Do(func() { c.result = c.run() })
+	return c.result
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const testSearchSchema = `{
+	"type": "object",
+	"required": ["context", "message"],
+	"properties": {
+		"context": {
+			"type": "object",
+			"required": ["ttl"],
+			"properties": {"ttl": {"type": "string"}}
+		},
+		"message": {"type": "object"}
+	}
+}`
+
+func writeTestSchema(t *testing.T, domain, version, action, schema string) string {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, domain, version)
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(path, action+".json"), []byte(schema), 0o644); err != nil {
+		t.Fatalf("write schema: %v", err)
+	}
+	return dir
+}
+
+func TestDirSchemaValidator(t *testing.T) {
+	dir := writeTestSchema(t, "ONDC:RET10", "2.0.0", "search", testSearchSchema)
+	v, err := newDirSchemaValidator(dir)
+	if err != nil {
+		t.Fatalf("newDirSchemaValidator() error = %v", err)
+	}
+
+	valid := map[string]any{"context": map[string]any{"ttl": "PT30S"}, "message": map[string]any{}}
+	res := v.Validate("search", "ONDC:RET10", "2.0.0", valid)
+	if res == nil || !res.Valid || len(res.Errors) != 0 {
+		t.Fatalf("Validate(valid) = %#v, want valid", res)
+	}
+
+	invalid := map[string]any{"context": map[string]any{"ttl": float64(30)}}
+	res = v.Validate("search", "ONDC:RET10", "2.0.0", invalid)
+	if res == nil || res.Valid {
+		t.Fatalf("Validate(invalid) = %#v, want invalid", res)
+	}
+	paths := map[string]bool{}
+	for _, e := range res.Errors {
+		paths[e.Path] = true
+	}
+	if !paths[""] || !paths["/context/ttl"] {
+		t.Errorf("error paths = %v, want root (missing message) and /context/ttl", res.Errors)
+	}
+
+	if res := v.Validate("select", "ONDC:RET10", "2.0.0", valid); res != nil {
+		t.Errorf("Validate() without schema = %#v, want nil", res)
+	}
+	for i := range 5 {
+		v.Validate(fmt.Sprintf("made_up_%d", i), "ONDC:RET10", "2.0.0", valid)
+	}
+	if n := len(v.schemas); n != 1 {
+		t.Errorf("cached schemas = %d after misses, want 1", n)
+	}
+	if res := v.Validate("search", "..", "..", valid); res == nil || res.Valid {
+		t.Errorf("Validate() escaping the bundle = %#v, want failure", res)
+	}
+}
+
+func TestDirSchemaValidatorCachesCompileFailures(t *testing.T) {
+	dir := writeTestSchema(t, "ONDC:RET10", "2.0.0", "search", `{"type": `)
+	v, err := newDirSchemaValidator(dir)
+	if err != nil {
+		t.Fatalf("newDirSchemaValidator() error = %v", err)
+	}
+	payload := map[string]any{"context": map[string]any{}}
+	if res := v.Validate("search", "ONDC:RET10", "2.0.0", payload); res == nil || res.Valid {
+		t.Fatalf("Validate() with a broken schema = %#v, want failure", res)
+	}
+
+	// The failure is remembered: fixing the file needs a restart, as for compiled schemas.
+	if err := os.WriteFile(filepath.Join(dir, "ONDC:RET10", "2.0.0", "search.json"), []byte(testSearchSchema), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if res := v.Validate("search", "ONDC:RET10", "2.0.0", payload); res == nil || res.Valid || len(res.Errors) != 1 {
+		t.Errorf("Validate() after a cached compile failure = %#v, want the same failure", res)
+	}
+}
+
+func TestNewDirSchemaValidatorInvalidDir(t *testing.T) {
+	if _, err := newDirSchemaValidator(""); err == nil {
+		t.Error("expected error for empty dir")
+	}
+	if _, err := newDirSchemaValidator(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected error for missing dir")
+	}
+}
+
+func TestSchemaCheckRunsOnce(t *testing.T) {
+	calls := 0
+	c := &schemaCheck{run: func() *schemaValidationResult {
+		calls++
+		return &schemaValidationResult{Valid: true}
+	}}
+	c.Result()
+	c.Result()
+	if calls != 1 {
+		t.Errorf("run called %d times, want 1", calls)
+	}
+	var nilCheck *schemaCheck
+	if nilCheck.Result() != nil {
+		t.Error("nil schemaCheck should return nil result")
+	}
+}
+
+func TestLogEventSyncSchemaValidation(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	key := createTransactionKey("t1", "https://s")
+	mr.Set(key, `{"apiList":[]}`)
+
+	v, err := newDirSchemaValidator(writeTestSchema(t, "ONDC:RET10", "2.0.0", "search", testSearchSchema))
+	if err != nil {
+		t.Fatalf("newDirSchemaValidator() error = %v", err)
+	}
+	s := &recorderServer{rdb: rdb, cfg: config{SkipNOPush: true, SkipDBSave: true, SchemaValidationMode: schemaValidationSync}, httpClient: http.DefaultClient, validator: v}
+
+	payload := map[string]any{
+		"requestBody":    map[string]any{"context": map[string]any{"domain": "ONDC:RET10", "version": "2.0.0"}},
+		"responseBody":   map[string]any{},
+		"additionalData": map[string]any{"transaction_id": "t1", "subscriber_url": "https://s", "action": "search"},
+	}
+	b, _ := json.Marshal(payload)
+	if _, err := s.LogEvent(ctx, wrapperspb.Bytes(b)); err != nil {
+		t.Fatalf("LogEvent() error = %v", err)
+	}
+
+	txn, _ := loadTransactionMap(ctx, rdb, key)
+	entry := txn["apiList"].([]any)[0].(map[string]any)
+	result, ok := entry["schemaValidation"].(map[string]any)
+	if !ok {
+		t.Fatalf("schemaValidation missing: %#v", entry)
+	}
+	if result["valid"] != false {
+		t.Errorf("schemaValidation.valid = %v, want false", result["valid"])
+	}
+	if errs, _ := result["errors"].([]any); len(errs) == 0 {
+		t.Errorf("schemaValidation.errors empty")
+	}
+}
+
+func TestPatchAPIEntryAtomically(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	key := createTransactionKey("t1", "https://s")
+	mr.Set(key, `{"apiList":[{"entryType":"API","payloadId":"p1"},{"entryType":"API","payloadId":"p2"}]}`)
+
+	if err := patchAPIEntryAtomically(ctx, rdb, key, "p2", map[string]any{"schemaValidation": map[string]any{"valid": true}}); err != nil {
+		t.Fatalf("patchAPIEntryAtomically() error = %v", err)
+	}
+	txn, _ := loadTransactionMap(ctx, rdb, key)
+	apiList := txn["apiList"].([]any)
+	if _, ok := apiList[0].(map[string]any)["schemaValidation"]; ok {
+		t.Error("p1 should not be patched")
+	}
+	if _, ok := apiList[1].(map[string]any)["schemaValidation"]; !ok {
+		t.Error("p2 should be patched")
+	}
+
+	if err := patchAPIEntryAtomically(ctx, rdb, key, "missing", map[string]any{"x": 1}); err != errNotFound {
+		t.Errorf("patch of unknown payloadId error = %v, want errNotFound", err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	sessionCacheHitsTotal   = newCounter("recorder_db_session_cache_hits_total", "DB sessions found in the session cache, skipping the existence check.")
+	sessionCacheMissesTotal = newCounter("recorder_db_session_cache_misses_total", "DB sessions checked (and created if missing) against the data service.")
+)
+
+// sessionCache remembers DB sessions known to exist, in a bounded in-process LRU and
+// optionally in Redis (shared across replicas), both expiring after ttl so a session deleted
+// in the data service is re-created eventually. Checks for the same session run once at a
+// time, so concurrent workers do not both create it.
+type sessionCache struct {
+	known *expirable.LRU[string, struct{}] // nil = no in-process cache
+	rdb   *redis.Client                    // nil = no Redis markers
+	ttl   time.Duration
+	group singleflight.Group
+}
+
+func newSessionCache(size int, rdb *redis.Client, ttl time.Duration) *sessionCache {
+	c := &sessionCache{rdb: rdb, ttl: ttl}
+	if size > 0 {
+		c.known = expirable.NewLRU[string, struct{}](size, nil, ttl)
+	}
+	return c
+}
+
+// sessionCheckTimeout bounds a shared session check. It runs apart from the context of the
+// worker that started it, so that worker's deadline or cancellation does not fail the others
+// waiting on the same session.
+const sessionCheckTimeout = 15 * time.Second
+
+func sessionMarkerKey(sessionID string) string { return "RECORDER_DB_SESSION_" + sessionID }
+
+// ensure returns once sessionID is known to exist, calling checkAndCreate when it is not
+// cached. A nil cache just calls checkAndCreate.
+func (c *sessionCache) ensure(ctx context.Context, sessionID string, checkAndCreate func(context.Context) error) error {
+	if c == nil {
+		return checkAndCreate(ctx)
+	}
+	if c.known != nil && c.known.Contains(sessionID) {
+		sessionCacheHitsTotal.Inc()
+		return nil
+	}
+	_, err, _ := c.group.Do(sessionID, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sessionCheckTimeout)
+		defer cancel()
+		if c.known != nil && c.known.Contains(sessionID) {
+			sessionCacheHitsTotal.Inc()
+			return nil, nil
+		}
+		if c.rdb != nil {
+			n, err := c.rdb.Exists(ctx, sessionMarkerKey(sessionID)).Result()
+			if err != nil {
+				fmt.Printf("[DB] WARNING: Session marker lookup failed: %v\n", err)
+			} else if n > 0 {
+				sessionCacheHitsTotal.Inc()
+				c.remember(ctx, sessionID, false)
+				return nil, nil
+			}
+		}
+		sessionCacheMissesTotal.Inc()
+		if err := checkAndCreate(ctx); err != nil {
+			return nil, err
+		}
+		c.remember(ctx, sessionID, true)
+		return nil, nil
+	})
+	return err
+}
+
+func (c *sessionCache) remember(ctx context.Context, sessionID string, mark bool) {
+	if c.known != nil {
+		c.known.Add(sessionID, struct{}{})
+	}
+	if mark && c.rdb != nil {
+		if err := c.rdb.Set(ctx, sessionMarkerKey(sessionID), "1", c.ttl).Err(); err != nil {
+			fmt.Printf("[DB] WARNING: Failed to store session marker: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestSavePayloadToDBCachesSessions(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	mr.Set(createTransactionKey("t1", "https://s"), `{"sessionId":"s1","subscriberType":"BAP"}`)
+
+	fake := &fakeDataService{}
+	// A slow session check lets concurrent saves overlap.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/sessions/check/") {
+			time.Sleep(50 * time.Millisecond)
+		}
+		fake.handler().ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	cfg := newDBTestConfig(srv.URL)
+	sessions := newSessionCache(100, nil, time.Hour)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d := derivedFields{TransactionID: "t1", SubscriberURL: "https://s", Action: "search", PayloadID: "p1"}
+			errs <- savePayloadToDB(ctx, cfg, srv.Client(), rdb, sessions, d, map[string]any{}, map[string]any{}, nil)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("savePayloadToDB() error = %v", err)
+		}
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.checks) != 1 || len(fake.sessions) != 1 {
+		t.Errorf("session checks = %d, creates = %d; want 1 and 1", len(fake.checks), len(fake.sessions))
+	}
+	if len(fake.payloads) != 20 {
+		t.Errorf("payloads = %d, want 20", len(fake.payloads))
+	}
+}
+
+func TestSessionCacheRedisMarker(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	calls := 0
+	create := func(context.Context) error { calls++; return nil }
+
+	if err := newSessionCache(10, rdb, time.Minute).ensure(ctx, "s1", create); err != nil {
+		t.Fatalf("ensure() error = %v", err)
+	}
+	if ttl := mr.TTL(sessionMarkerKey("s1")); ttl != time.Minute {
+		t.Errorf("marker TTL = %v, want 1m", ttl)
+	}
+
+	// Another replica (empty LRU) finds the marker and skips the check.
+	other := newSessionCache(10, rdb, time.Minute)
+	if err := other.ensure(ctx, "s1", create); err != nil {
+		t.Fatalf("ensure() error = %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("checkAndCreate calls = %d, want 1", calls)
+	}
+
+	mr.FastForward(2 * time.Minute)
+	if err := newSessionCache(10, rdb, time.Minute).ensure(ctx, "s1", create); err != nil {
+		t.Fatalf("ensure() error = %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("checkAndCreate calls after marker expiry = %d, want 2", calls)
+	}
+}
+
+func TestSessionCacheSharedCheckOutlivesCaller(t *testing.T) {
+	c := newSessionCache(10, nil, time.Minute)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	check := func(ctx context.Context) error {
+		close(started)
+		<-release
+		return ctx.Err()
+	}
+
+	// The caller that starts the check gives up; the check, and a second caller waiting on
+	// it, are unaffected.
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() { first <- c.ensure(ctx, "s1", check) }()
+	<-started
+	second := make(chan error, 1)
+	go func() { second <- c.ensure(context.Background(), "s1", check) }()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	close(release)
+	for _, ch := range []chan error{first, second} {
+		if err := <-ch; err != nil {
+			t.Errorf("ensure() error = %v, want nil", err)
+		}
+	}
+}
+
+func TestSessionCacheFailuresAndDisabled(t *testing.T) {
+	ctx := context.Background()
+	calls := 0
+	fail := func(context.Context) error { calls++; return errors.New("data service down") }
+
+	c := newSessionCache(10, nil, time.Minute)
+	for i := 0; i < 2; i++ {
+		if err := c.ensure(ctx, "s1", fail); err == nil {
+			t.Fatal("ensure() succeeded with a failing check")
+		}
+	}
+	if calls != 2 {
+		t.Errorf("failed checks = %d, want 2 (failures are not cached)", calls)
+	}
+
+	calls = 0
+	ok := func(context.Context) error { calls++; return nil }
+	for _, c := range []*sessionCache{nil, newSessionCache(0, nil, time.Minute)} {
+		for i := 0; i < 2; i++ {
+			if err := c.ensure(ctx, "s1", ok); err != nil {
+				t.Fatalf("ensure() error = %v", err)
+			}
+		}
+	}
+	if calls != 4 {
+		t.Errorf("checks with caching off = %d, want 4", calls)
+	}
+}
@@ -17,18 +17,9 @@ import (
 
 func sendLogsToNO(ctx context.Context, cfg config, client *http.Client, d derivedFields, requestBody, responseBody map[string]any) error {
 	fmt.Printf("[NO] Sending logs to Network Observability for transaction: %s\n", d.TransactionID)
-	if strings.TrimSpace(cfg.NOURL) == "" {
-		fmt.Printf("[NO] Skipping: NO URL not configured\n")
-		return nil
-	}
-	if len(cfg.NOEnabledIn) > 0 && !cfg.NOEnabledIn[cfg.Env] {
-		fmt.Printf("[NO] Skipping: Not enabled for environment '%s'\n", cfg.Env)
-		return nil
-	}
 	if client == nil {
 		client = http.DefaultClient
 	}
-	client.Timeout = cfg.NOTimeout
 
 	endpoint, err := url.JoinPath(cfg.NOURL, "/v1/api/push-txn-logs")
 	if err != nil {
@@ -46,7 +37,12 @@ func sendLogsToNO(ctx context.Context, cfg config, client *http.Client, d derive
 
 	// Send request log.
 	fmt.Printf("[NO] Posting request log to %s\n", endpoint)
-	if err := postJSON(ctx, client, endpoint, cfg.NOToken, mergeMaps(common, map[string]any{"type": "request", "request": requestBody})); err != nil {
+	post := func(payload any) error {
+		ctx, cancel := withRequestTimeout(ctx, cfg.NOTimeout)
+		defer cancel()
+		return postJSON(ctx, client, endpoint, cfg.NOToken, payload)
+	}
+	if err := post(mergeMaps(common, map[string]any{"type": "request", "request": requestBody})); err != nil {
 		fmt.Printf("[NO] ERROR: Failed to post request log: %v\n", err)
 		return err
 	}
@@ -54,7 +50,14 @@ func sendLogsToNO(ctx context.Context, cfg config, client *http.Client, d derive
 	
 	// Send response log.
 	fmt.Printf("[NO] Posting response log to %s\n", endpoint)
-	if err := postJSON(ctx, client, endpoint, cfg.NOToken, mergeMaps(common, map[string]any{"type": "response", "response": responseBody, "statusCode": d.StatusCode})); err != nil {
+	responseLog := map[string]any{"type": "response", "response": responseBody, "statusCode": d.StatusCode}
+	if d.AckStatus != "" {
+		responseLog["ackStatus"] = d.AckStatus
+	}
+	if d.ResponseError != nil {
+		responseLog["responseError"] = d.ResponseError
+	}
+	if err := post(mergeMaps(common, responseLog)); err != nil {
 		fmt.Printf("[NO] ERROR: Failed to post response log: %v\n", err)
 		return err
 	}
@@ -62,20 +65,11 @@ func sendLogsToNO(ctx context.Context, cfg config, client *http.Client, d derive
 	return nil
 }
 
-func savePayloadToDB(ctx context.Context, cfg config, client *http.Client, rdb *redis.Client, d derivedFields, requestBody, responseBody map[string]any, additionalData map[string]any) error {
+func savePayloadToDB(ctx context.Context, cfg config, client *http.Client, rdb *redis.Client, sessions *sessionCache, d derivedFields, requestBody, responseBody map[string]any, additionalData map[string]any) error {
 	fmt.Printf("[DB] Saving payload to database for transaction: %s\n", d.TransactionID)
-	if strings.TrimSpace(cfg.DBBaseURL) == "" {
-		fmt.Printf("[DB] Skipping: DB URL not configured\n")
-		return nil
-	}
-	if len(cfg.DBEnabledIn) > 0 && !cfg.DBEnabledIn[cfg.Env] {
-		fmt.Printf("[DB] Skipping: Not enabled for environment '%s'\n", cfg.Env)
-		return nil
-	}
 	if client == nil {
 		client = http.DefaultClient
 	}
-	client.Timeout = cfg.DBTimeout
 
 	// Load transaction from Redis; if it doesn't exist, match TS behavior and skip DB save.
 	fmt.Printf("[DB] Loading transaction from Redis...\n")
@@ -98,39 +92,54 @@ func savePayloadToDB(ctx context.Context, cfg config, client *http.Client, rdb *
 		// Matches TS: key = sha256(transactionKey)
 		sessionId = sha256Hex(createTransactionKey(d.TransactionID, d.SubscriberURL))
 	}
-
-	// Check/Create session in DB
-	checkURL, err := url.JoinPath(cfg.DBBaseURL, cfg.DBSessionPath, "check", sessionId)
-	if err != nil {
-		return err
+	sessionType := "AUTOMATION"
+	if d.IsMock && cfg.MockDBSessionType != "" {
+		// Keep mock payloads out of the real session unless the caller named one explicitly.
+		sessionType = cfg.MockDBSessionType
+		sessionId = sessionId + "-" + strings.ToLower(sessionType)
 	}
-	exists, err := getBoolJSON(ctx, client, checkURL, cfg.DBAPIKey)
-	if err != nil {
-		return err
+	// The plugin's session_id is authoritative when present.
+	if explicit := strings.TrimSpace(d.SessionID); explicit != "" {
+		sessionId = explicit
 	}
-	if !exists {
+
+	// Check/Create session in DB, unless the session is already known to exist
+	err = sessions.ensure(ctx, sessionId, func(ctx context.Context) error {
+		checkURL, err := url.JoinPath(cfg.DBBaseURL, cfg.DBSessionPath, "check", sessionId)
+		if err != nil {
+			return err
+		}
+		checkCtx, cancel := withRequestTimeout(ctx, cfg.DBTimeout)
+		exists, err := getBoolJSON(checkCtx, client, checkURL, cfg.DBAPIKey)
+		cancel()
+		if err != nil || exists {
+			return err
+		}
 		createURL, err := url.JoinPath(cfg.DBBaseURL, cfg.DBSessionPath)
 		if err != nil {
 			return err
 		}
 		domain := getContextString(requestBody, "domain")
-		version := getContextString(requestBody, "version")
-		if strings.TrimSpace(version) == "" {
-			version = getContextString(requestBody, "core_version")
-		}
+		version := getContextVersion(requestBody)
 		sessionPayload := map[string]any{
 			"sessionId":     sessionId,
 			"npType":        npType,
 			"npId":          strings.TrimSpace(d.SubscriberURL),
 			"domain":        domain,
 			"version":       version,
-			"sessionType":   "AUTOMATION",
+			"sessionType":   sessionType,
 			"sessionActive": true,
 		}
-		if err := postJSONWithAPIKey(ctx, client, createURL, cfg.DBAPIKey, sessionPayload); err != nil {
+		createCtx, cancel := withRequestTimeout(ctx, cfg.DBTimeout)
+		defer cancel()
+		if err := postJSONWithAPIKey(createCtx, client, createURL, cfg.DBAPIKey, sessionPayload); err != nil {
 			fmt.Printf("[DB] ERROR: Failed to create session in DB: %v\n", err)
 			return err
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
 	// Save payload
@@ -189,10 +198,30 @@ func savePayloadToDB(ctx context.Context, cfg config, client *http.Client, rdb *
 			"sessionId": sessionId,
 		},
 	}
+	if d.AckStatus != "" {
+		requestPayload["ackStatus"] = d.AckStatus
+	}
+	if d.ResponseError != nil {
+		requestPayload["responseError"] = d.ResponseError
+	}
+	if result := d.Schema.Result(); result != nil {
+		requestPayload["schemaValidation"] = result
+	}
 
+	ctx, cancel := withRequestTimeout(ctx, cfg.DBTimeout)
+	defer cancel()
 	return postJSONWithAPIKey(ctx, client, payloadURL, cfg.DBAPIKey, requestPayload)
 }
 
+// withRequestTimeout bounds one outbound request by d (unbounded when d <= 0). Timeouts are
+// applied per call rather than on the http.Client, which every sink and worker shares.
+func withRequestTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
 func getContextString(requestBody map[string]any, key string) string {
 	ctxObj, _ := requestBody["context"].(map[string]any)
 	if ctxObj == nil {
@@ -201,6 +230,15 @@ func getContextString(requestBody map[string]any, key string) string {
 	return getString(ctxObj, key)
 }
 
+// getContextVersion returns context.version, falling back to the pre-2.0 context.core_version.
+func getContextVersion(requestBody map[string]any) string {
+	version := getContextString(requestBody, "version")
+	if strings.TrimSpace(version) == "" {
+		version = getContextString(requestBody, "core_version")
+	}
+	return version
+}
+
 func getBoolJSON(ctx context.Context, client *http.Client, endpoint string, apiKey string) (bool, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
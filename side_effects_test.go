@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeDataService records the calls savePayloadToDB makes against the data service.
+type fakeDataService struct {
+	mu       sync.Mutex
+	checks   []string
+	sessions []map[string]any
+	payloads []map[string]any
+}
+
+func (f *fakeDataService) handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/api/sessions/check/"):
+			f.checks = append(f.checks, strings.TrimPrefix(r.URL.Path, "/api/sessions/check/"))
+			_, _ = w.Write([]byte("false"))
+		case r.Method == http.MethodPost && r.URL.Path == "/api/sessions":
+			var body map[string]any
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			f.sessions = append(f.sessions, body)
+		case r.Method == http.MethodPost && r.URL.Path == "/api/sessions/payload":
+			var body map[string]any
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			f.payloads = append(f.payloads, body)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+func newDBTestConfig(baseURL string) config {
+	return config{
+		Env:           "test",
+		DBBaseURL:     baseURL,
+		DBTimeout:     2 * time.Second,
+		DBSessionPath: "/api/sessions",
+		DBPayloadPath: "/api/sessions/payload",
+	}
+}
+
+func TestSavePayloadToDBSessionRouting(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	key := createTransactionKey("t1", "https://s")
+	mr.Set(key, `{"sessionId":"cached-session","subscriberType":"BAP"}`)
+
+	tests := []struct {
+		name        string
+		mockType    string
+		d           derivedFields
+		wantSession string
+		wantType    string
+	}{
+		{"cached session", "", derivedFields{}, "cached-session", "AUTOMATION"},
+		{"additionalData session_id wins", "", derivedFields{SessionID: "sess-from-plugin"}, "sess-from-plugin", "AUTOMATION"},
+		{"mock routed to separate session type", "MOCK", derivedFields{IsMock: true}, "cached-session-mock", "MOCK"},
+		{"explicit session_id wins for mock traffic", "MOCK", derivedFields{IsMock: true, SessionID: "sess-from-plugin"}, "sess-from-plugin", "MOCK"},
+		{"mock without session type", "", derivedFields{IsMock: true}, "cached-session", "AUTOMATION"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeDataService{}
+			srv := httptest.NewServer(fake.handler())
+			defer srv.Close()
+			cfg := newDBTestConfig(srv.URL)
+			cfg.MockDBSessionType = tt.mockType
+
+			d := tt.d
+			d.TransactionID, d.SubscriberURL, d.Action, d.PayloadID = "t1", "https://s", "search", "p1"
+			if err := savePayloadToDB(ctx, cfg, srv.Client(), rdb, nil, d, map[string]any{}, map[string]any{}, nil); err != nil {
+				t.Fatalf("savePayloadToDB() error = %v", err)
+			}
+
+			if len(fake.checks) != 1 || fake.checks[0] != tt.wantSession {
+				t.Errorf("session checks = %v, want [%s]", fake.checks, tt.wantSession)
+			}
+			if len(fake.sessions) != 1 || fake.sessions[0]["sessionType"] != tt.wantType {
+				t.Errorf("created sessions = %v, want sessionType %s", fake.sessions, tt.wantType)
+			}
+			details, _ := fake.payloads[0]["sessionDetails"].(map[string]any)
+			if details["sessionId"] != tt.wantSession {
+				t.Errorf("payload sessionId = %v, want %s", details["sessionId"], tt.wantSession)
+			}
+		})
+	}
+}
+
+func TestMockTrafficSkips(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	mr.Set(createTransactionKey("t1", "https://s"), `{}`)
+
+	cfg := newDBTestConfig("http://db.invalid")
+	cfg.NOURL = "http://no.invalid"
+	cfg.MockSkipNO = true
+	cfg.MockSkipDB = true
+	ev := &sinkEvent{Derived: derivedFields{TransactionID: "t1", SubscriberURL: "https://s", IsMock: true}}
+
+	sinks, err := newSinks([]string{"no", "db"}, sinkDeps{conf: func() config { return cfg }, rdb: rdb})
+	if err != nil {
+		t.Fatalf("newSinks() error = %v", err)
+	}
+	for _, sink := range sinks {
+		if sink.Enabled(ev) {
+			t.Errorf("%s sink enabled for mock traffic", sink.Name())
+		}
+	}
+}
+
+func TestSendLogsToNOTimesOutPerCall(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client := &http.Client{}
+	cfg := config{NOURL: srv.URL, NOTimeout: 50 * time.Millisecond}
+	start := time.Now()
+	err := sendLogsToNO(context.Background(), cfg, client, derivedFields{TransactionID: "t1"}, map[string]any{}, map[string]any{})
+	if err == nil {
+		t.Fatal("sendLogsToNO() error = nil, want a timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("sendLogsToNO() took %v, want about the 50ms NO timeout", elapsed)
+	}
+	if client.Timeout != 0 {
+		t.Errorf("shared client Timeout = %v, want it left alone", client.Timeout)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// sinkEvent is a recorded API event as handed to sinks.
+type sinkEvent struct {
+	Derived        derivedFields
+	RequestBody    map[string]any
+	ResponseBody   map[string]any
+	AdditionalData map[string]any
+	ReceivedAt     time.Time
+
+	// Result is the event's outcome (recorded, duplicate, parked or failed, with Err saying
+	// why). Only inline sinks are given it; they see every event, async sinks recorded ones.
+	Result string
+	Err    string
+}
+
+// Sink is a destination recorded events are forwarded to off the request path. Enabled is
+// checked when the event is recorded; Handle runs later on the async dispatcher, as a job
+// named after the sink.
+type Sink interface {
+	Name() string
+	Enabled(ev *sinkEvent) bool
+	Handle(ctx context.Context, ev *sinkEvent) error
+}
+
+// inlineSink is implemented by sinks that must see every event, such as the archive. They are
+// handled on the request path rather than the async dispatcher, so a full queue cannot drop
+// their events and they cannot be paused.
+type inlineSink interface {
+	Sink
+	inline()
+}
+
+func isInlineSink(s Sink) bool {
+	_, ok := s.(inlineSink)
+	return ok
+}
+
+// closeSinks closes the sinks that hold resources (those implementing io.Closer).
+func closeSinks(sinks []Sink) error {
+	var errs []error
+	for _, s := range sinks {
+		if c, ok := s.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("sink %s: %w", s.Name(), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sinkDeps are what sink factories build from. conf returns the current (hot-reloadable)
+// config, so sinks see flag, URL and token changes without a restart.
+type sinkDeps struct {
+	conf       func() config
+	rdb        *redis.Client
+	httpClient *http.Client
+}
+
+// sinkFactories builds the sinks that RECORDER_SINKS can name.
+var sinkFactories = map[string]func(sinkDeps) (Sink, error){
+	"no":      func(d sinkDeps) (Sink, error) { return &noSink{deps: d}, nil },
+	"db":      newDBSink,
+	"archive": newArchiveSink,
+	"webhook": newWebhookSink,
+}
+
+// newSinks instantiates the named sinks in order.
+func newSinks(names []string, deps sinkDeps) ([]Sink, error) {
+	var sinks []Sink
+	for _, name := range names {
+		factory, ok := sinkFactories[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown sink %q (known: %s)", name, strings.Join(sinkNames(), ", "))
+		}
+		if slices.ContainsFunc(sinks, func(s Sink) bool { return s.Name() == name }) {
+			continue
+		}
+		sink, err := factory(deps)
+		if err != nil {
+			return nil, fmt.Errorf("sink %s: %w", name, err)
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+func sinkNames() []string {
+	names := make([]string, 0, len(sinkFactories))
+	for name := range sinkFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// enabledInEnv reports whether a sink limited to envs (empty = all) runs in env.
+func enabledInEnv(envs map[string]bool, env string) bool {
+	return len(envs) == 0 || envs[env]
+}
+
+// noSink pushes request and response logs to Network Observability.
+type noSink struct{ deps sinkDeps }
+
+func (s *noSink) Name() string { return "no" }
+
+func (s *noSink) Enabled(ev *sinkEvent) bool {
+	cfg := s.deps.conf()
+	switch {
+	case cfg.SkipNOPush:
+		fmt.Printf("[NO] Skipping: SkipNOPush=true\n")
+	case strings.TrimSpace(cfg.NOURL) == "":
+		fmt.Printf("[NO] Skipping: NO URL not configured\n")
+	case !enabledInEnv(cfg.NOEnabledIn, cfg.Env):
+		fmt.Printf("[NO] Skipping: Not enabled for environment '%s'\n", cfg.Env)
+	case ev.Derived.IsMock && cfg.MockSkipNO:
+		fmt.Printf("[NO] Skipping: mock traffic (RECORDER_MOCK_SKIP_NO=true)\n")
+	default:
+		return true
+	}
+	return false
+}
+
+func (s *noSink) Handle(ctx context.Context, ev *sinkEvent) error {
+	return sendLogsToNO(ctx, s.deps.conf(), s.deps.httpClient, ev.Derived, ev.RequestBody, ev.ResponseBody)
+}
+
+// dbSink saves the payload to the automation data service.
+type dbSink struct {
+	deps     sinkDeps
+	sessions *sessionCache
+}
+
+func newDBSink(d sinkDeps) (Sink, error) {
+	cfg := d.conf()
+	var rdb *redis.Client
+	if cfg.DBSessionCacheRedis {
+		rdb = d.rdb
+	}
+	return &dbSink{deps: d, sessions: newSessionCache(cfg.DBSessionCacheSize, rdb, cfg.DBSessionCacheTTL)}, nil
+}
+
+func (s *dbSink) Name() string { return "db" }
+
+func (s *dbSink) Enabled(ev *sinkEvent) bool {
+	cfg := s.deps.conf()
+	switch {
+	case cfg.SkipDBSave:
+		fmt.Printf("[DB] Skipping: SkipDBSave=true\n")
+	case strings.TrimSpace(cfg.DBBaseURL) == "":
+		fmt.Printf("[DB] Skipping: DB URL not configured\n")
+	case !enabledInEnv(cfg.DBEnabledIn, cfg.Env):
+		fmt.Printf("[DB] Skipping: Not enabled for environment '%s'\n", cfg.Env)
+	case ev.Derived.IsMock && cfg.MockSkipDB:
+		fmt.Printf("[DB] Skipping: mock traffic (RECORDER_MOCK_SKIP_DB=true)\n")
+	default:
+		return true
+	}
+	return false
+}
+
+func (s *dbSink) Handle(ctx context.Context, ev *sinkEvent) error {
+	return savePayloadToDB(ctx, s.deps.conf(), s.deps.httpClient, s.deps.rdb, s.sessions, ev.Derived, ev.RequestBody, ev.ResponseBody, ev.AdditionalData)
+}
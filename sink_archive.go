@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	archiveFsyncAlways   = "always"
+	archiveFsyncInterval = "interval"
+	archiveFsyncNever    = "never"
+)
+
+var (
+	archiveWrittenTotal = newCounter("recorder_archive_events_total", "Events written to the local JSONL archive.")
+	archiveErrorsTotal  = newCounter("recorder_archive_errors_total", "Archive writes or fsyncs that failed.")
+)
+
+// archiveConfig is the local JSONL archive: the active file, its rotation limits (rotated
+// files are named after their rotation time, gzipped when Compress is set) and when data
+// is fsynced: after every event, every FsyncInterval, or when the OS decides.
+type archiveConfig struct {
+	Path          string
+	MaxSizeMB     int
+	MaxAgeDays    int // 0 = keep rotated files regardless of age
+	MaxBackups    int // 0 = keep all rotated files
+	Compress      bool
+	Fsync         string
+	FsyncInterval time.Duration
+}
+
+// archiveRecord is one line of the archive. Replaying it needs only the three bodies; Derived
+// is what the recorder made of them.
+type archiveRecord struct {
+	ReceivedAt     string         `json:"receivedAt"`
+	Derived        archiveDerived `json:"derived"`
+	RequestBody    map[string]any `json:"requestBody"`
+	ResponseBody   map[string]any `json:"responseBody"`
+	AdditionalData map[string]any `json:"additionalData"`
+
+	// Result is the recorder's outcome for the event, and Error why it failed; both are empty
+	// in webhook bodies.
+	Result string `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type archiveDerived struct {
+	PayloadID     string         `json:"payload_id"`
+	TransactionID string         `json:"transaction_id"`
+	MessageID     string         `json:"message_id,omitempty"`
+	SubscriberURL string         `json:"subscriber_url"`
+	Action        string         `json:"action"`
+	Timestamp     string         `json:"timestamp,omitempty"`
+	APIName       string         `json:"api_name,omitempty"`
+	StatusCode    int64          `json:"status_code,omitempty"`
+	TTLSecs       int64          `json:"ttl_seconds,omitempty"`
+	CacheTTLSecs  int64          `json:"cache_ttl_seconds,omitempty"`
+	IsMock        bool           `json:"is_mock,omitempty"`
+	SessionID     string         `json:"session_id,omitempty"`
+	AckStatus     string         `json:"ack_status,omitempty"`
+	ResponseError map[string]any `json:"response_error,omitempty"`
+	Caller        string         `json:"caller,omitempty"`
+}
+
+// archiveSink appends every event to a rotating JSONL file, with its outcome: recorded,
+// duplicate, parked or failed. It is an inlineSink: events are written on the request path, so
+// none are lost to a full or paused async queue or skipped as duplicates.
+type archiveSink struct {
+	cfg archiveConfig
+	out *lumberjack.Logger
+
+	mu       sync.Mutex
+	dirty    bool
+	closed   bool
+	syncFile *os.File // a handle on the active file, used only to fsync it
+	stop     chan struct{}
+}
+
+func newArchiveSink(d sinkDeps) (Sink, error) {
+	cfg := d.conf().Archive
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("RECORDER_ARCHIVE_PATH is required")
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0o755); err != nil {
+		return nil, err
+	}
+	s := &archiveSink{
+		cfg: cfg,
+		out: &lumberjack.Logger{
+			Filename:   cfg.Path,
+			MaxSize:    cfg.MaxSizeMB,
+			MaxAge:     cfg.MaxAgeDays,
+			MaxBackups: cfg.MaxBackups,
+			Compress:   cfg.Compress,
+		},
+		stop: make(chan struct{}),
+	}
+	if cfg.Fsync == archiveFsyncInterval && cfg.FsyncInterval > 0 {
+		go s.syncLoop(cfg.FsyncInterval)
+	}
+	return s, nil
+}
+
+func (s *archiveSink) Name() string { return "archive" }
+
+func (s *archiveSink) Enabled(ev *sinkEvent) bool { return true }
+
+func (s *archiveSink) inline() {}
+
+// newArchiveRecord is ev as an archive line; the webhook sink builds its bodies from it too.
+func newArchiveRecord(ev *sinkEvent) archiveRecord {
+	d := ev.Derived
+	return archiveRecord{
+		ReceivedAt: ev.ReceivedAt.UTC().Format(time.RFC3339Nano),
+		Result:     ev.Result,
+		Error:      ev.Err,
+		Derived: archiveDerived{
+			PayloadID: d.PayloadID, TransactionID: d.TransactionID, MessageID: d.MessageID,
+			SubscriberURL: d.SubscriberURL, Action: d.Action, Timestamp: d.Timestamp,
+			APIName: d.APIName, StatusCode: d.StatusCode, TTLSecs: d.TTLSecs, CacheTTLSecs: d.CacheTTLSecs,
+			IsMock: d.IsMock, SessionID: d.SessionID, AckStatus: d.AckStatus, ResponseError: d.ResponseError,
+			Caller: d.Caller,
+		},
+		RequestBody:    ev.RequestBody,
+		ResponseBody:   ev.ResponseBody,
+		AdditionalData: ev.AdditionalData,
+	}
+}
+
+func (s *archiveSink) Handle(ctx context.Context, ev *sinkEvent) error {
+	line, err := json.Marshal(newArchiveRecord(ev))
+	if err != nil {
+		archiveErrorsTotal.Inc()
+		return fmt.Errorf("archive: marshal: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		archiveErrorsTotal.Inc()
+		return fmt.Errorf("archive: closed")
+	}
+	if _, err := s.out.Write(append(line, '\n')); err != nil {
+		archiveErrorsTotal.Inc()
+		return fmt.Errorf("archive: write: %w", err)
+	}
+	archiveWrittenTotal.Inc()
+	s.dirty = true
+	if s.cfg.Fsync == archiveFsyncAlways {
+		return s.syncLocked()
+	}
+	return nil
+}
+
+// syncLocked fsyncs the active file. lumberjack does not expose its file, so a second handle
+// on the same path is kept; fsync flushes the file, not the handle. After a rotation the old
+// file, which may hold unsynced writes from before it was rotated, is fsynced through the
+// stale handle before a handle on the new file is opened.
+func (s *archiveSink) syncLocked() error {
+	if !s.dirty {
+		return nil
+	}
+	if s.syncFile != nil {
+		cur, err1 := s.syncFile.Stat()
+		now, err2 := os.Stat(s.cfg.Path)
+		if err1 != nil || err2 != nil || !os.SameFile(cur, now) {
+			err := s.syncFile.Sync()
+			s.syncFile.Close()
+			s.syncFile = nil
+			if err != nil {
+				archiveErrorsTotal.Inc()
+				return fmt.Errorf("archive: fsync rotated file: %w", err)
+			}
+		}
+	}
+	if s.syncFile == nil {
+		f, err := os.Open(s.cfg.Path)
+		if err != nil {
+			archiveErrorsTotal.Inc()
+			return fmt.Errorf("archive: fsync: %w", err)
+		}
+		s.syncFile = f
+	}
+	if err := s.syncFile.Sync(); err != nil {
+		archiveErrorsTotal.Inc()
+		return fmt.Errorf("archive: fsync: %w", err)
+	}
+	s.dirty = false
+	return nil
+}
+
+func (s *archiveSink) syncLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			if err := s.syncLocked(); err != nil {
+				fmt.Printf("[ARCHIVE] ERROR: %v\n", err)
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// Close flushes and closes the archive; later events are rejected.
+func (s *archiveSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.stop)
+	err := s.syncLocked()
+	if s.syncFile != nil {
+		s.syncFile.Close()
+	}
+	if cerr := s.out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
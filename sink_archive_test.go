@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func newArchiveTestSink(t *testing.T, cfg archiveConfig) *archiveSink {
+	t.Helper()
+	sink, err := newArchiveSink(sinkDeps{conf: func() config { return config{Archive: cfg} }})
+	if err != nil {
+		t.Fatalf("newArchiveSink() error = %v", err)
+	}
+	s := sink.(*archiveSink)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestArchiveSinkWritesJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive", "events.jsonl")
+	s := newArchiveTestSink(t, archiveConfig{Path: path, MaxSizeMB: 1, Fsync: archiveFsyncAlways})
+	written := archiveWrittenTotal.Value()
+
+	received := time.Date(2026, 1, 7, 10, 0, 0, 0, time.UTC)
+	for _, id := range []string{"p1", "p2"} {
+		ev := &sinkEvent{
+			Derived:        derivedFields{PayloadID: id, TransactionID: "t1", SubscriberURL: "https://s", Action: "search", IsMock: true},
+			RequestBody:    map[string]any{"context": map[string]any{"action": "search"}},
+			ResponseBody:   map[string]any{"message": map[string]any{"ack": map[string]any{"status": "ACK"}}},
+			AdditionalData: map[string]any{"payload_id": id},
+			ReceivedAt:     received,
+		}
+		if err := s.Handle(context.Background(), ev); err != nil {
+			t.Fatalf("Handle(%s) error = %v", id, err)
+		}
+	}
+	if got := archiveWrittenTotal.Value() - written; got != 2 {
+		t.Errorf("archive events counter delta = %d, want 2", got)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var recs []archiveRecord
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rec archiveRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("line %q: %v", sc.Text(), err)
+		}
+		recs = append(recs, rec)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("archive has %d lines, want 2", len(recs))
+	}
+	rec := recs[1]
+	if rec.Derived.PayloadID != "p2" || rec.Derived.TransactionID != "t1" || !rec.Derived.IsMock {
+		t.Errorf("derived = %+v", rec.Derived)
+	}
+	if rec.ReceivedAt != "2026-01-07T10:00:00Z" {
+		t.Errorf("receivedAt = %q", rec.ReceivedAt)
+	}
+	if rec.RequestBody["context"] == nil || rec.ResponseBody["message"] == nil || rec.AdditionalData["payload_id"] != "p2" {
+		t.Errorf("bodies = %v, %v, %v", rec.RequestBody, rec.ResponseBody, rec.AdditionalData)
+	}
+	if s.dirty {
+		t.Error("fsync=always left unsynced data")
+	}
+}
+
+func TestArchiveSinkRotatesAndCompresses(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.jsonl")
+	s := newArchiveTestSink(t, archiveConfig{Path: path, MaxSizeMB: 1, Compress: true, Fsync: archiveFsyncNever})
+
+	big := strings.Repeat("x", 300<<10)
+	for i := 0; i < 5; i++ {
+		if err := s.Handle(context.Background(), &sinkEvent{RequestBody: map[string]any{"blob": big}}); err != nil {
+			t.Fatalf("Handle() error = %v", err)
+		}
+	}
+
+	// lumberjack compresses rotated files in the background.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		gz, _ := filepath.Glob(filepath.Join(dir, "events-*.jsonl.gz"))
+		if len(gz) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			entries, _ := os.ReadDir(dir)
+			t.Fatalf("no compressed backup after rotation; dir has %v", entries)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("active archive missing after rotation: %v", err)
+	}
+}
+
+func TestArchiveSinkFsyncAcrossRotation(t *testing.T) {
+	dir := t.TempDir()
+	s := newArchiveTestSink(t, archiveConfig{Path: filepath.Join(dir, "events.jsonl"), MaxSizeMB: 1, Fsync: archiveFsyncAlways})
+	errs := archiveErrorsTotal.Value()
+
+	big := strings.Repeat("x", 300<<10)
+	for i := 0; i < 5; i++ {
+		if err := s.Handle(context.Background(), &sinkEvent{RequestBody: map[string]any{"blob": big}}); err != nil {
+			t.Fatalf("Handle() error = %v", err)
+		}
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "events*.jsonl")); len(files) < 2 {
+		t.Fatalf("files = %v, want a rotation", files)
+	}
+	if d := archiveErrorsTotal.Value() - errs; d != 0 {
+		t.Errorf("archive errors = %d, want 0", d)
+	}
+}
+
+func TestArchiveSinkOnRequestPath(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	mr.Set(createTransactionKey("t1", "https://s"), `{}`)
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	archive := newArchiveTestSink(t, archiveConfig{Path: path, MaxSizeMB: 1, Fsync: archiveFsyncNever})
+
+	// No dispatcher at all: async sinks would be dropped, the archive still gets the event.
+	s := &recorderServer{rdb: rdb, cfg: config{Env: "test"}, sinks: []Sink{archive}}
+	if _, err := s.LogEvent(ctx, wrapperspb.Bytes(parkingTestPayload("p1", "search"))); err != nil {
+		t.Fatalf("LogEvent() error = %v", err)
+	}
+	if b, _ := os.ReadFile(path); !strings.Contains(string(b), `"payload_id":"p1"`) {
+		t.Errorf("archive = %q, want the p1 event", b)
+	}
+
+	if jobs := (&adminAPI{recorder: s}).jobs(); slices.Contains(jobs, "archive") {
+		t.Errorf("pausable jobs = %v, want archive excluded", jobs)
+	}
+
+	if err := closeSinks(s.sinks); err != nil {
+		t.Fatalf("closeSinks() error = %v", err)
+	}
+	if err := archive.Handle(ctx, &sinkEvent{}); err == nil {
+		t.Error("Handle() after Close succeeded")
+	}
+}
+
+func TestArchiveSinkRecordsEveryOutcome(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	key := createTransactionKey("t1", "https://s")
+	mr.Set(key, `{"apiList":[]}`)
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	archive := newArchiveTestSink(t, archiveConfig{Path: path, MaxSizeMB: 1, Fsync: archiveFsyncNever})
+	s := &recorderServer{rdb: rdb, cfg: config{Env: "test", DedupeEvents: true, DedupeMarkerTTL: time.Minute}, sinks: []Sink{archive}}
+
+	s.LogEvent(ctx, wrapperspb.Bytes(parkingTestPayload("p1", "search")))
+	s.LogEvent(ctx, wrapperspb.Bytes(parkingTestPayload("p1", "search")))
+	mr.Del(key)
+	if _, err := s.LogEvent(ctx, wrapperspb.Bytes(parkingTestPayload("p2", "select"))); err == nil {
+		t.Fatal("LogEvent() for a missing transaction succeeded")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rec archiveRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, rec.Derived.PayloadID+":"+rec.Result)
+		if rec.Result == recorderResultFailed && rec.Error == "" {
+			t.Errorf("failed line for %s has no error", rec.Derived.PayloadID)
+		}
+	}
+	if want := []string{"p1:recorded", "p1:duplicate", "p2:failed"}; !slices.Equal(got, want) {
+		t.Errorf("archived outcomes = %v, want %v", got, want)
+	}
+}
+
+func TestArchiveSinkIntervalFsync(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	s := newArchiveTestSink(t, archiveConfig{Path: path, MaxSizeMB: 1, Fsync: archiveFsyncInterval, FsyncInterval: 10 * time.Millisecond})
+
+	if err := s.Handle(context.Background(), &sinkEvent{}); err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		s.mu.Lock()
+		dirty := s.dirty
+		s.mu.Unlock()
+		if !dirty {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("interval fsync did not run")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestArchiveSinkRequiresPath(t *testing.T) {
+	if _, err := newSinks([]string{"archive"}, sinkDeps{conf: func() config { return config{} }}); err == nil {
+		t.Error("newSinks(archive) without a path succeeded")
+	}
+
+	unsetEnvForTest(t, "RECORDER_SINKS", "RECORDER_ARCHIVE_PATH")
+	t.Setenv("RECORDER_SINKS", "db,archive")
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "RECORDER_ARCHIVE_PATH") {
+		t.Errorf("loadConfig() error = %v, want RECORDER_ARCHIVE_PATH required", err)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type fakeSink struct {
+	name    string
+	enabled bool
+
+	mu     sync.Mutex
+	events []*sinkEvent
+	done   chan struct{}
+}
+
+func (s *fakeSink) Name() string               { return s.name }
+func (s *fakeSink) Enabled(ev *sinkEvent) bool { return s.enabled }
+
+func (s *fakeSink) Handle(ctx context.Context, ev *sinkEvent) error {
+	s.mu.Lock()
+	s.events = append(s.events, ev)
+	s.mu.Unlock()
+	s.done <- struct{}{}
+	return nil
+}
+
+func TestNewSinks(t *testing.T) {
+	sinks, err := newSinks([]string{"db", "no", "db"}, sinkDeps{conf: func() config { return config{} }})
+	if err != nil {
+		t.Fatalf("newSinks() error = %v", err)
+	}
+	var names []string
+	for _, s := range sinks {
+		names = append(names, s.Name())
+	}
+	if strings.Join(names, ",") != "db,no" {
+		t.Errorf("sinks = %v, want [db no]", names)
+	}
+
+	if _, err := newSinks([]string{"no", "kafka"}, sinkDeps{}); err == nil || !strings.Contains(err.Error(), "kafka") {
+		t.Errorf("newSinks(kafka) error = %v, want unknown sink", err)
+	}
+}
+
+func TestSinkEnabledFollowsConfig(t *testing.T) {
+	rec := &recorderServer{cfg: config{Env: "staging", NOURL: "http://no.invalid", DBBaseURL: "http://db.invalid", NOEnabledIn: map[string]bool{"prod": true}}}
+	sinks, err := newSinks([]string{"no", "db"}, sinkDeps{conf: rec.currentConfig})
+	if err != nil {
+		t.Fatalf("newSinks() error = %v", err)
+	}
+	no, db := sinks[0], sinks[1]
+	ev := &sinkEvent{}
+
+	if no.Enabled(ev) {
+		t.Error("no sink enabled outside RECORDER_NO_ENABLED_ENVS")
+	}
+	if !db.Enabled(ev) {
+		t.Error("db sink disabled with no env restriction")
+	}
+
+	rec.updateConfig(func(c *config) {
+		c.Env = "prod"
+		c.SkipDBSave = true
+	})
+	if !no.Enabled(ev) {
+		t.Error("no sink still disabled after env change")
+	}
+	if db.Enabled(ev) {
+		t.Error("db sink enabled with SkipDBSave=true")
+	}
+
+	rec.updateConfig(func(c *config) { c.NOURL = "" })
+	if no.Enabled(ev) {
+		t.Error("no sink enabled without a URL")
+	}
+}
+
+func TestLogEventDispatchesToSinks(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	mr.Set(createTransactionKey("t1", "https://s"), `{}`)
+
+	on := &fakeSink{name: "on", enabled: true, done: make(chan struct{}, 1)}
+	off := &fakeSink{name: "off", done: make(chan struct{}, 1)}
+	s := &recorderServer{rdb: rdb, cfg: config{Env: "test"}, async: newAsyncDispatcher(ctx, 10, 1, false), sinks: []Sink{on, off}}
+
+	if _, err := s.LogEvent(ctx, wrapperspb.Bytes(parkingTestPayload("p1", "search"))); err != nil {
+		t.Fatalf("LogEvent() error = %v", err)
+	}
+	select {
+	case <-on.done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("enabled sink not called")
+	}
+	on.mu.Lock()
+	defer on.mu.Unlock()
+	if len(on.events) != 1 || on.events[0].Derived.PayloadID != "p1" {
+		t.Errorf("enabled sink events = %+v, want p1", on.events)
+	}
+	if len(off.events) != 0 {
+		t.Errorf("disabled sink called %d times", len(off.events))
+	}
+}
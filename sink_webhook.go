@@ -0,0 +1,450 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+var (
+	webhookDeliveredTotal = newCounter("recorder_webhook_deliveries_total", "Events delivered to webhook destinations.")
+	webhookRetriesTotal   = newCounter("recorder_webhook_retries_total", "Webhook delivery attempts retried after a failure.")
+	webhookFailedTotal    = newCounter("recorder_webhook_failures_total", "Webhook deliveries that failed after all attempts.")
+)
+
+// webhookFile is RECORDER_WEBHOOK_FILE: the destinations of the webhook sink.
+type webhookFile struct {
+	Destinations []webhookDestination `json:"destinations"`
+}
+
+// webhookDestination is one endpoint events are POSTed to. The body is built by Template (a Go
+// template), else by Mapping (output field -> JSON path), else it is the archive record. Both
+// see the event as {receivedAt, env, derived, requestBody, responseBody, additionalData}.
+// Template output must be valid JSON, so values are inserted with {{json .x}}, which quotes
+// and escapes them.
+type webhookDestination struct {
+	Name     string            `json:"name"`
+	URL      string            `json:"url"`
+	Headers  map[string]string `json:"headers"`
+	Auth     webhookAuth       `json:"auth"`
+	Template string            `json:"template"`
+	Mapping  map[string]string `json:"mapping"`
+	Filter   webhookFilter     `json:"filter"`
+	// TimeoutMs bounds each attempt (default 5000).
+	TimeoutMs int          `json:"timeoutMs"`
+	Retry     webhookRetry `json:"retry"`
+
+	tmpl *template.Template
+}
+
+// webhookAuth authenticates to a destination. Values may reference env vars as ${NAME}.
+type webhookAuth struct {
+	Type     string `json:"type"` // none, bearer, basic, apikey or hmac
+	Token    string `json:"token"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Header   string `json:"header"` // apikey header (default X-API-Key)
+	Key      string `json:"key"`
+	Secret   string `json:"secret"` // hmac, signed like the HTTP API's hmac auth
+}
+
+// webhookFilter selects the events sent to a destination; empty lists match everything.
+type webhookFilter struct {
+	Actions []string `json:"actions"`
+	Domains []string `json:"domains"`
+	Envs    []string `json:"envs"`
+}
+
+// webhookRetry retries network errors, 429 and 5xx responses with exponential backoff.
+type webhookRetry struct {
+	Attempts     int `json:"attempts"`     // total attempts (default 3)
+	BackoffMs    int `json:"backoffMs"`    // first backoff (default 200)
+	MaxBackoffMs int `json:"maxBackoffMs"` // cap (default 5000)
+}
+
+// loadWebhookFile reads and validates the destinations in path.
+func loadWebhookFile(path string) ([]*webhookDestination, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f webhookFile
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("parse webhooks %s: %w", path, err)
+	}
+	if len(f.Destinations) == 0 {
+		return nil, fmt.Errorf("webhooks %s: no destinations", path)
+	}
+	names := map[string]bool{}
+	var dests []*webhookDestination
+	for i := range f.Destinations {
+		d := &f.Destinations[i]
+		if err := d.init(); err != nil {
+			return nil, fmt.Errorf("webhooks %s: destination %d: %w", path, i+1, err)
+		}
+		if names[d.Name] {
+			return nil, fmt.Errorf("webhooks %s: duplicate destination name %q", path, d.Name)
+		}
+		names[d.Name] = true
+		dests = append(dests, d)
+	}
+	return dests, nil
+}
+
+// init validates d and fills in defaults.
+func (d *webhookDestination) init() error {
+	u, err := url.Parse(d.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http(s) URL")
+	}
+	if d.Name == "" {
+		d.Name = u.Host
+	}
+	switch d.Auth.Type {
+	case "", "none":
+	case "bearer":
+		if d.Auth.Token == "" {
+			return fmt.Errorf("%s: bearer auth requires token", d.Name)
+		}
+	case "basic":
+		if d.Auth.Username == "" {
+			return fmt.Errorf("%s: basic auth requires username", d.Name)
+		}
+	case "apikey":
+		if d.Auth.Key == "" {
+			return fmt.Errorf("%s: apikey auth requires key", d.Name)
+		}
+		if d.Auth.Header == "" {
+			d.Auth.Header = "X-API-Key"
+		}
+	case "hmac":
+		if d.Auth.Secret == "" {
+			return fmt.Errorf("%s: hmac auth requires secret", d.Name)
+		}
+	default:
+		return fmt.Errorf("%s: unknown auth type %q", d.Name, d.Auth.Type)
+	}
+	if d.Template != "" {
+		if d.tmpl, err = template.New(d.Name).Funcs(template.FuncMap{"json": templateJSON}).Option("missingkey=zero").Parse(d.Template); err != nil {
+			return fmt.Errorf("%s: template: %w", d.Name, err)
+		}
+	}
+	for field, path := range d.Mapping {
+		if strings.HasPrefix(path, "$") {
+			if _, err := parseJSONPath(path); err != nil {
+				return fmt.Errorf("%s: mapping %s: %w", d.Name, field, err)
+			}
+		}
+	}
+	if d.TimeoutMs <= 0 {
+		d.TimeoutMs = 5000
+	}
+	if d.Retry.Attempts <= 0 {
+		d.Retry.Attempts = 3
+	}
+	if d.Retry.BackoffMs <= 0 {
+		d.Retry.BackoffMs = 200
+	}
+	if d.Retry.MaxBackoffMs < d.Retry.BackoffMs {
+		d.Retry.MaxBackoffMs = max(5000, d.Retry.BackoffMs)
+	}
+	return nil
+}
+
+func (f webhookFilter) match(action, domain, env string) bool {
+	in := func(list []string, v string) bool {
+		if len(list) == 0 {
+			return true
+		}
+		for _, it := range list {
+			if strings.EqualFold(strings.TrimSpace(it), v) {
+				return true
+			}
+		}
+		return false
+	}
+	return in(f.Actions, action) && in(f.Domains, domain) && in(f.Envs, env)
+}
+
+// webhookSink POSTs each event to the destinations whose filter it matches.
+type webhookSink struct {
+	deps   sinkDeps
+	dests  []*webhookDestination
+	client *http.Client
+}
+
+func newWebhookSink(d sinkDeps) (Sink, error) {
+	path := d.conf().WebhookFile
+	if path == "" {
+		return nil, fmt.Errorf("RECORDER_WEBHOOK_FILE is required")
+	}
+	dests, err := loadWebhookFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// Attempts are bounded by each destination's timeout instead of a client-wide one.
+	return &webhookSink{deps: d, dests: dests, client: &http.Client{}}, nil
+}
+
+func (s *webhookSink) Name() string { return "webhook" }
+
+func (s *webhookSink) Enabled(ev *sinkEvent) bool {
+	return len(s.matching(ev)) > 0
+}
+
+func (s *webhookSink) matching(ev *sinkEvent) []*webhookDestination {
+	env := s.deps.conf().Env
+	domain := eventDomain(ev)
+	var out []*webhookDestination
+	for _, d := range s.dests {
+		if d.Filter.match(ev.Derived.Action, domain, env) {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// Handle delivers to every matching destination concurrently; one failing or slow destination
+// does not hold up the others. Each delivery gets its own budget (see webhookDestination.budget)
+// rather than the async job's deadline, and is cut short only when ctx is canceled.
+func (s *webhookSink) Handle(ctx context.Context, ev *sinkEvent) error {
+	dests := s.matching(ev)
+	if len(dests) == 0 {
+		return nil
+	}
+	doc, err := webhookDocument(ev, s.deps.conf().Env)
+	if err != nil {
+		return err
+	}
+	errs := make([]error, len(dests))
+	var wg sync.WaitGroup
+	for i, d := range dests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.handleDestination(ctx, d, doc); err != nil {
+				webhookFailedTotal.Inc()
+				errs[i] = fmt.Errorf("webhook %s: %w", d.Name, err)
+				return
+			}
+			webhookDeliveredTotal.Inc()
+			fmt.Printf("[WEBHOOK] Delivered %s for transaction %s to %s\n", ev.Derived.Action, ev.Derived.TransactionID, d.Name)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (s *webhookSink) handleDestination(ctx context.Context, d *webhookDestination, doc map[string]any) error {
+	body, err := d.body(doc)
+	if err != nil {
+		return err
+	}
+	dctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), d.budget())
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			cancel()
+		}
+	})
+	defer stop()
+	return s.deliver(dctx, d, body)
+}
+
+// budget is the longest a delivery to d may take: every attempt timing out, plus the backoffs
+// between them.
+func (d *webhookDestination) budget() time.Duration {
+	total := time.Duration(d.Retry.Attempts*d.TimeoutMs) * time.Millisecond
+	backoff := time.Duration(d.Retry.BackoffMs) * time.Millisecond
+	for i := 1; i < d.Retry.Attempts; i++ {
+		total += backoff
+		backoff = min(2*backoff, time.Duration(d.Retry.MaxBackoffMs)*time.Millisecond)
+	}
+	return total
+}
+
+func eventDomain(ev *sinkEvent) string {
+	c, _ := ev.RequestBody["context"].(map[string]any)
+	return getString(c, "domain")
+}
+
+// webhookDocument is the event as templates and JSON paths see it.
+func webhookDocument(ev *sinkEvent, env string) (map[string]any, error) {
+	b, err := json.Marshal(newArchiveRecord(ev))
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	doc["env"] = env
+	return doc, nil
+}
+
+func (d *webhookDestination) body(doc map[string]any) ([]byte, error) {
+	switch {
+	case d.tmpl != nil:
+		var buf bytes.Buffer
+		if err := d.tmpl.Execute(&buf, doc); err != nil {
+			return nil, fmt.Errorf("template: %w", err)
+		}
+		if !json.Valid(buf.Bytes()) {
+			return nil, fmt.Errorf("template output is not valid JSON (insert values with {{json .x}})")
+		}
+		return buf.Bytes(), nil
+	case len(d.Mapping) > 0:
+		out := make(map[string]any, len(d.Mapping))
+		for field, path := range d.Mapping {
+			if !strings.HasPrefix(path, "$") {
+				out[field] = path
+				continue
+			}
+			steps, _ := parseJSONPath(path)
+			out[field] = lookupJSONPath(doc, steps)
+		}
+		return json.Marshal(out)
+	default:
+		return json.Marshal(doc)
+	}
+}
+
+// deliver POSTs body, retrying network errors, 429 and 5xx up to d.Retry.Attempts times.
+func (s *webhookSink) deliver(ctx context.Context, d *webhookDestination, body []byte) error {
+	backoff := time.Duration(d.Retry.BackoffMs) * time.Millisecond
+	var err error
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		retry, err = s.attempt(ctx, d, body)
+		if err == nil || !retry || attempt >= d.Retry.Attempts {
+			return err
+		}
+		webhookRetriesTotal.Inc()
+		fmt.Printf("[WEBHOOK] %s attempt %d/%d failed: %v; retrying in %v\n", d.Name, attempt, d.Retry.Attempts, err, backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, time.Duration(d.Retry.MaxBackoffMs)*time.Millisecond)
+	}
+}
+
+func (s *webhookSink) attempt(ctx context.Context, d *webhookDestination, body []byte) (retry bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(d.TimeoutMs)*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range d.Headers {
+		req.Header.Set(k, os.ExpandEnv(v))
+	}
+	d.Auth.apply(req, body)
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500, fmt.Errorf("status %d", res.StatusCode)
+}
+
+func (a webhookAuth) apply(req *http.Request, body []byte) {
+	switch a.Type {
+	case "bearer":
+		req.Header.Set("Authorization", "Bearer "+os.ExpandEnv(a.Token))
+	case "basic":
+		req.SetBasicAuth(os.ExpandEnv(a.Username), os.ExpandEnv(a.Password))
+	case "apikey":
+		req.Header.Set(a.Header, os.ExpandEnv(a.Key))
+	case "hmac":
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(hmacTimestampHeader, ts)
+		req.Header.Set(hmacSignatureHeader, signHMACRequest([]byte(os.ExpandEnv(a.Secret)), ts, req.Method, req.URL.Path, req.URL.RawQuery, body))
+	}
+}
+
+func templateJSON(v any) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// parseJSONPath splits a path like $.requestBody.context.domain or $.responseBody.items[0].id
+// into map keys (string) and array indexes (int).
+func parseJSONPath(path string) ([]any, error) {
+	rest, ok := strings.CutPrefix(path, "$")
+	if !ok {
+		return nil, fmt.Errorf("JSON path %q must start with $", path)
+	}
+	var steps []any
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("JSON path %q has an empty key", path)
+			}
+			steps = append(steps, rest[:end])
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("JSON path %q has an unclosed [", path)
+			}
+			n, err := strconv.Atoi(rest[1:end])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("JSON path %q has an invalid index %q", path, rest[1:end])
+			}
+			steps = append(steps, n)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("JSON path %q: unexpected %q", path, rest[0])
+		}
+	}
+	return steps, nil
+}
+
+// lookupJSONPath follows steps into doc; missing keys and out-of-range indexes give nil.
+func lookupJSONPath(doc any, steps []any) any {
+	cur := doc
+	for _, step := range steps {
+		switch s := step.(type) {
+		case string:
+			m, ok := cur.(map[string]any)
+			if !ok {
+				return nil
+			}
+			cur = m[s]
+		case int:
+			a, ok := cur.([]any)
+			if !ok || s >= len(a) {
+				return nil
+			}
+			cur = a[s]
+		}
+	}
+	return cur
+}
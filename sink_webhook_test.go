@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newWebhookTestSink(t *testing.T, env string, content string) *webhookSink {
+	t.Helper()
+	path := writeConfigFile(t, "webhooks.json", content)
+	sink, err := newWebhookSink(sinkDeps{conf: func() config { return config{Env: env, WebhookFile: path} }})
+	if err != nil {
+		t.Fatalf("newWebhookSink() error = %v", err)
+	}
+	return sink.(*webhookSink)
+}
+
+func webhookTestEvent(action, domain string) *sinkEvent {
+	return &sinkEvent{
+		Derived:        derivedFields{PayloadID: "p1", TransactionID: "t1", SubscriberURL: "https://s", Action: action},
+		RequestBody:    map[string]any{"context": map[string]any{"domain": domain, "action": action}, "message": map[string]any{"items": []any{map[string]any{"id": "i1"}}}},
+		ResponseBody:   map[string]any{"message": map[string]any{"ack": map[string]any{"status": "ACK"}}},
+		AdditionalData: map[string]any{"payload_id": "p1"},
+	}
+}
+
+func TestWebhookSinkTemplatesAndAuth(t *testing.T) {
+	type hit struct {
+		path  string
+		query string
+		hdr   http.Header
+		body  string
+	}
+	hits := make(chan hit, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		hits <- hit{r.URL.Path, r.URL.RawQuery, r.Header.Clone(), string(b)}
+	}))
+	defer srv.Close()
+	t.Setenv("WEBHOOK_TEST_TOKEN", "tok-1")
+
+	s := newWebhookTestSink(t, "staging", `{"destinations":[
+		{"name":"tmpl","url":"`+srv.URL+`/tmpl","headers":{"X-Team":"ops"},"auth":{"type":"bearer","token":"${WEBHOOK_TEST_TOKEN}"},
+		 "template":"{\"txn\":{{json .derived.transaction_id}},\"env\":{{json .env}},\"ack\":{{json .responseBody.message.ack.status}}}"},
+		{"name":"map","url":"`+srv.URL+`/map?team=ops&env=staging","auth":{"type":"hmac","secret":"s3cret"},
+		 "mapping":{"txn":"$.derived.transaction_id","item":"$.requestBody.message.items[0].id","missing":"$.requestBody.nope[3]","source":"recorder"}},
+		{"name":"other-domain","url":"`+srv.URL+`/other","filter":{"domains":["ONDC:TRV10"]}}
+	]}`)
+
+	ev := webhookTestEvent("search", "ONDC:RET10")
+	if !s.Enabled(ev) {
+		t.Fatal("Enabled() = false with matching destinations")
+	}
+	if err := s.Handle(context.Background(), ev); err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+	close(hits)
+
+	got := map[string]hit{}
+	for h := range hits {
+		got[h.path] = h
+	}
+	if len(got) != 2 || got["/other"].path != "" {
+		t.Fatalf("delivered to %v, want /tmpl and /map", got)
+	}
+
+	tmpl := got["/tmpl"]
+	if tmpl.body != `{"txn":"t1","env":"staging","ack":"ACK"}` {
+		t.Errorf("template body = %s", tmpl.body)
+	}
+	if tmpl.hdr.Get("Authorization") != "Bearer tok-1" || tmpl.hdr.Get("X-Team") != "ops" {
+		t.Errorf("template headers = %v", tmpl.hdr)
+	}
+
+	m := got["/map"]
+	var body map[string]any
+	if err := json.Unmarshal([]byte(m.body), &body); err != nil {
+		t.Fatalf("mapping body %q: %v", m.body, err)
+	}
+	if body["txn"] != "t1" || body["item"] != "i1" || body["missing"] != nil || body["source"] != "recorder" {
+		t.Errorf("mapping body = %v", body)
+	}
+	want := signHMACRequest([]byte("s3cret"), m.hdr.Get(hmacTimestampHeader), http.MethodPost, "/map", m.query, []byte(m.body))
+	if m.hdr.Get(hmacSignatureHeader) != want {
+		t.Errorf("hmac signature = %q, want %q", m.hdr.Get(hmacSignatureHeader), want)
+	}
+}
+
+func TestWebhookSinkFilters(t *testing.T) {
+	s := newWebhookTestSink(t, "prod", `{"destinations":[
+		{"name":"a","url":"http://a.invalid","filter":{"actions":["on_confirm"],"envs":["prod"]}},
+		{"name":"b","url":"http://b.invalid","filter":{"envs":["staging"]}}
+	]}`)
+	if s.Enabled(webhookTestEvent("search", "ONDC:RET10")) {
+		t.Error("Enabled() = true for an action no destination takes")
+	}
+	if got := s.matching(webhookTestEvent("on_confirm", "ONDC:RET10")); len(got) != 1 || got[0].Name != "a" {
+		t.Errorf("matching(on_confirm) = %v, want [a]", got)
+	}
+}
+
+func TestWebhookSinkRetries(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/bad":
+			calls.Add(1)
+			w.WriteHeader(http.StatusBadRequest)
+		case calls.Add(1) < 3:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	s := newWebhookTestSink(t, "test", `{"destinations":[{"url":"`+srv.URL+`/flaky","retry":{"attempts":3,"backoffMs":1}}]}`)
+	retries := webhookRetriesTotal.Value()
+	if err := s.Handle(context.Background(), webhookTestEvent("search", "")); err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+	if calls.Load() != 3 || webhookRetriesTotal.Value()-retries != 2 {
+		t.Errorf("calls = %d, retries = %d; want 3, 2", calls.Load(), webhookRetriesTotal.Value()-retries)
+	}
+
+	calls.Store(0)
+	s = newWebhookTestSink(t, "test", `{"destinations":[{"name":"bad","url":"`+srv.URL+`/bad","retry":{"attempts":3,"backoffMs":1}}]}`)
+	failed := webhookFailedTotal.Value()
+	if err := s.Handle(context.Background(), webhookTestEvent("search", "")); err == nil || !strings.Contains(err.Error(), "status 400") {
+		t.Errorf("Handle() error = %v, want status 400", err)
+	}
+	if calls.Load() != 1 || webhookFailedTotal.Value()-failed != 1 {
+		t.Errorf("4xx: calls = %d, failures = %d; want 1 attempt, 1 failure", calls.Load(), webhookFailedTotal.Value()-failed)
+	}
+}
+
+func TestWebhookSinkDestinationBudgets(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(150 * time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+	s := newWebhookTestSink(t, "test", `{"destinations":[
+		{"name":"slow-a","url":"`+srv.URL+`/slow","timeoutMs":1000},
+		{"name":"slow-b","url":"`+srv.URL+`/slow","timeoutMs":1000}
+	]}`)
+
+	// The caller's deadline is shorter than one delivery; each destination keeps its own budget
+	// and they run side by side.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := s.Handle(ctx, webhookTestEvent("search", "")); err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+	if took := time.Since(start); took > 280*time.Millisecond {
+		t.Errorf("Handle() took %v, want destinations delivered concurrently", took)
+	}
+
+	// Cancellation (shutdown) still stops deliveries.
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := s.Handle(ctx, webhookTestEvent("search", "")); err == nil {
+		t.Error("Handle() with a canceled context succeeded")
+	}
+
+	d := &webhookDestination{TimeoutMs: 1000, Retry: webhookRetry{Attempts: 3, BackoffMs: 200, MaxBackoffMs: 300}}
+	if got := d.budget(); got != 3500*time.Millisecond {
+		t.Errorf("budget() = %v, want 3.5s", got)
+	}
+}
+
+func TestWebhookSinkRejectsInvalidTemplateOutput(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { calls.Add(1) }))
+	defer srv.Close()
+	s := newWebhookTestSink(t, "test", `{"destinations":[{"url":"`+srv.URL+`","template":"{\"txn\":{{.derived.transaction_id}}}"}]}`)
+	if err := s.Handle(context.Background(), webhookTestEvent("search", "")); err == nil || !strings.Contains(err.Error(), "not valid JSON") {
+		t.Errorf("Handle() error = %v, want invalid JSON", err)
+	}
+	if calls.Load() != 0 {
+		t.Errorf("calls = %d, want none", calls.Load())
+	}
+}
+
+func TestLoadWebhookFileErrors(t *testing.T) {
+	tests := map[string]string{
+		"no destinations": `{"destinations":[]}`,
+		"relative url":    `{"destinations":[{"url":"/hook"}]}`,
+		"unknown field":   `{"destinations":[{"url":"http://a","method":"PUT"}]}`,
+		"unknown auth":    `{"destinations":[{"url":"http://a","auth":{"type":"oauth"}}]}`,
+		"bearer no token": `{"destinations":[{"url":"http://a","auth":{"type":"bearer"}}]}`,
+		"bad template":    `{"destinations":[{"url":"http://a","template":"{{.x"}}]}`,
+		"bad path":        `{"destinations":[{"url":"http://a","mapping":{"x":"$.a[b]"}}]}`,
+		"duplicate name":  `{"destinations":[{"url":"http://a"},{"url":"http://a/2"}]}`,
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := loadWebhookFile(writeConfigFile(t, "webhooks.json", content)); err == nil {
+				t.Error("loadWebhookFile() succeeded")
+			}
+		})
+	}
+}
+
+func TestParseJSONPath(t *testing.T) {
+	steps, err := parseJSONPath("$.requestBody.message.items[2].id")
+	if err != nil {
+		t.Fatalf("parseJSONPath() error = %v", err)
+	}
+	want := []any{"requestBody", "message", "items", 2, "id"}
+	if len(steps) != len(want) {
+		t.Fatalf("steps = %v, want %v", steps, want)
+	}
+	for i := range want {
+		if steps[i] != want[i] {
+			t.Errorf("step %d = %v, want %v", i, steps[i], want[i])
+		}
+	}
+	for _, bad := range []string{"requestBody", "$..a", "$.a[", "$.a[-1]", "$a"} {
+		if _, err := parseJSONPath(bad); err == nil {
+			t.Errorf("parseJSONPath(%q) succeeded", bad)
+		}
+	}
+}
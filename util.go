@@ -2,6 +2,7 @@ package main
 
 import (
 	"crypto/rand"
+	"crypto/sha1"
 	"crypto/sha256"
 	"encoding/hex"
 	"os"
@@ -104,6 +105,18 @@ func envInt(name string, def int) int {
 	return n
 }
 
+func envFloat(name string, def float64) float64 {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return def
+	}
+	return f
+}
+
 func uuidV4() (string, error) {
 	b := make([]byte, 16)
 	if _, err := rand.Read(b); err != nil {
@@ -111,7 +124,20 @@ func uuidV4() (string, error) {
 	}
 	b[6] = (b[6] & 0x0f) | 0x40
 	b[8] = (b[8] & 0x3f) | 0x80
+	return formatUUID(b), nil
+}
+
+// uuidFromName returns a name-based (version 5 style) UUID: the same name always gives the
+// same ID.
+func uuidFromName(name string) string {
+	sum := sha1.Sum([]byte(name))
+	b := sum[:16]
+	b[6] = (b[6] & 0x0f) | 0x50
+	b[8] = (b[8] & 0x3f) | 0x80
+	return formatUUID(b)
+}
 
+func formatUUID(b []byte) string {
 	buf := make([]byte, 36)
 	hex.Encode(buf[0:8], b[0:4])
 	buf[8] = '-'
@@ -122,5 +148,5 @@ func uuidV4() (string, error) {
 	hex.Encode(buf[19:23], b[8:10])
 	buf[23] = '-'
 	hex.Encode(buf[24:36], b[10:16])
-	return string(buf), nil
+	return string(buf)
 }
@@ -167,6 +167,19 @@ func TestUuidV4(t *testing.T) {
 	}
 }
 
+func TestUuidFromName(t *testing.T) {
+	a, b := uuidFromName("t1|m1|search"), uuidFromName("t1|m1|search")
+	if a != b {
+		t.Errorf("uuidFromName() not consistent: %v != %v", a, b)
+	}
+	if len(a) != 36 || a[14] != '5' {
+		t.Errorf("uuidFromName() = %v, want a version 5 UUID", a)
+	}
+	if c := uuidFromName("t1|m1|select"); c == a {
+		t.Errorf("uuidFromName() same for different names: %v", c)
+	}
+}
+
 func TestGetContextString(t *testing.T) {
 	tests := []struct {
 		name     string